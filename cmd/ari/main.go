@@ -6,12 +6,14 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
 
 	goal "codeberg.org/anaseto/goal"
 	goalcmd "codeberg.org/anaseto/goal/cmd"
 	"github.com/semperos/ari"
 	arihelp "github.com/semperos/ari/help"
+	goalsql "github.com/semperos/ari/sql"
 )
 
 func main() {
@@ -31,8 +33,24 @@ func main() {
 		}
 		return goal.NewS(strings.TrimSpace(helpFn(string(arg))))
 	})
+	handleInterrupt()
 	goalcmd.Exit(goalcmd.Run(ctx, goalcmd.Config{
 		ProgramName: "ari",
 		Help:        helpFn,
 	}))
 }
+
+// handleInterrupt makes Ctrl-C cancel the running SQL query, which then
+// returns a Goal error, instead of terminating the session. With no query
+// running, Ctrl-C exits as usual.
+func handleInterrupt() {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	go func() {
+		for range sigs {
+			if !goalsql.Interrupt() {
+				os.Exit(130)
+			}
+		}
+	}()
+}
@@ -4,6 +4,7 @@ go 1.25.0
 
 require (
 	codeberg.org/anaseto/goal v1.7.0
+	github.com/apache/arrow-go/v18 v18.1.0
 	github.com/go-resty/resty/v2 v2.17.2
 	github.com/marcboeker/go-duckdb v1.8.5
 	go.uber.org/ratelimit v0.3.1
@@ -11,7 +12,6 @@ require (
 )
 
 require (
-	github.com/apache/arrow-go/v18 v18.1.0 // indirect
 	github.com/benbjohnson/clock v1.3.5 // indirect
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/go-viper/mapstructure/v2 v2.4.0 // indirect
@@ -123,23 +123,259 @@ Client options (keys of d):
 
 // addSQLVerbHelp adds the individual sql.* verb entries.
 func addSQLVerbHelp(m map[string]string) {
-	m["sql.open"] = `sql.open "scheme://dsn"    open a database connection; returns sql.conn or error
+	m["sql.open"] = `sql.open "scheme://dsn"        open a database connection; returns sql.conn or error
+sql.open["scheme://dsn"; opts]  open with connection options dict
   sql.open "sqlite://data.db"
-  sql.open "sqlite://:memory:"`
-
-	m["sql.close"] = `sql.close db    close database connection db; returns 1i or error`
+  sql.open "sqlite://:memory:"
+  opts keys:
+    TimeoutMilli          i  default time limit of each call, in milliseconds (0: none)
+    MaxOpenConns          i  maximum open connections in the pool (0: no limit)
+    MaxIdleConns          i  maximum idle connections kept in the pool
+    ConnMaxLifetimeMilli  i  maximum time a connection may be reused (0: forever)
+    ConnMaxIdleTimeMilli  i  maximum time a connection may be idle (0: forever)
+    Cache                 i  sql.q caches its results, as sql.cached does (0/1)
+    CacheSize             i  maximum number of cached results (default 64)
+    CacheTTLMilli         i  maximum age of a cached result (0: no limit)
+    Trace                 i  log each statement (verb, duration, rows, query) to the log (0/1)
+    TraceParams           i  log parameter values, redacted as ? otherwise (0/1)
+    SharedCache           i  share sqlite://:memory: between the pool's connections (0/1)
+    Pragmas               d  SQLite pragmas, e.g. ..[journal_mode:"WAL";foreign_keys:1]
+    Settings              d  DuckDB settings, e.g. ..[threads:4;memory_limit:"4GB"]
+  The printed sql.conn shows the effective settings.
+  "sqlite://:memory:" is a database private to one connection, which runs
+  every statement of the sql.conn: a call needing another connection while
+  a transaction holds it is an error. With SharedCache:1 the connections of
+  the pool share it, but SQLite locks whole tables: writing a table an open
+  cursor or sql.rows reads, or reading one an open transaction wrote, fails
+  with SQLITE_LOCKED. A call needing a connection while open transactions,
+  cursors and sql.rows hold all MaxOpenConns is an error.`
+
+	m["sql.close"] = `sql.close db     close database connection db; returns 1i or error
+sql.close cur    close cursor cur before it is exhausted; returns 1i
+sql.close r      close sql.rows r before it is exhausted; returns 1i
+sql.close st     release prepared statement st; returns 1i`
 
 	m["sql.q"] = `sql.q[db; "SELECT …"]                  query; returns columnar dict (column name → array)
 sql.q[db; "SELECT … WHERE x=?"; args]  parameterised query; args is a Goal array
-  Result: t"col" gives column array (AI/AF/AS/AV); nan t"col" marks NULLs`
+sql.q[db; "SELECT … WHERE x=:x"; d]    named parameters; d is a dict, e.g. ..[x:1]
+sql.q[db; "SELECT …"; args; opts]      query with options dict
+  Result: t"col" gives column array (AI/AF/AS/AV); nan t"col" marks NULLs
+  opts keys:
+    Temporal      i  return DATE/TIME/TIMESTAMP columns as sql.time (0/1)
+    TimeoutMilli  i  time limit of the call in milliseconds, overriding the
+                     connection's (0: none)
+    Fill          d  values replacing NULLs per type, e.g. ..[i:-1;n:0.0;s:"NA"];
+                     with "i", integer columns with NULLs stay AI
+    NullMask      i  return ..[data:t;null:m], m"col" 1 at each NULL (0/1)
+    Arrow         i  DuckDB: read the result through Arrow record batches,
+                     faster for large results (0/1; sql.conn only)
+    Cache         i  use the connection's result cache or not, overriding
+                     sql.open's Cache option (0/1; see help"sql.cached")
+  NULLs are 0n in numeric columns (integer ones become AF, exact up to
+  2^53) and "" in strings; NullMask tells a NULL from a filled value
+  Placeholders in string literals, quoted names and comments, :: casts and
+  DuckDB slices x[a:b] are left alone; a :name missing from d is an error.
+  Arrow does not support nested, INTERVAL, UUID and TIME columns, Temporal,
+  transactions or prepared statements.`
+
+	m["sql.cached"] = `sql.cached[db; "SELECT …"]              query like sql.q, returning a cached result when there is one
+sql.cached[db; "SELECT … WHERE x=?"; args]  cached per query text and parameters
+sql.cached[db; "SELECT …"; args; opts]      with sql.q options
+  The cache is bounded by sql.open's CacheSize and CacheTTLMilli options.
+  sql.exec, sql.insert, sql.script, sql.migrate, sql.read, sql.register,
+  sql.func, commits and writing queries (e.g. INSERT … RETURNING, not
+  cached) on the connection drop cached results; sql.invalidate db drops
+  them after changes made elsewhere. Only for sql.conn (not transactions).
+  t: db sql.cached "SELECT region, sum(amount) FROM sales GROUP BY region"`
+
+	m["sql.invalidate"] = `sql.invalidate db    drop the cached query results of db; returns their number
+  See help"sql.cached".`
+
+	m["sql.stats"] = `sql.stats db    statistics of connection db; returns dict
+  Pool (database/sql): "openConnections", "inUse", "idle", "waitCount", "waitMilli",
+    "maxIdleClosed", "maxIdleTimeClosed", "maxLifetimeClosed"
+  Statements run by the sql verbs, BEGIN, COMMIT and savepoints included:
+    "statements", "errors", "rows" (with those read by sql.fetch and sql.next),
+    "cacheHits", "timeMilli", and "latency", a histogram
+    ..[maxMilli:1 10 100 1000 10000 0w;count:…]
+  sql.open[uri;..[Trace:1]] also logs each statement.`
 
 	m["sql.exec"] = `sql.exec[db; "INSERT …"]                  execute statement; returns exec-result dict
 sql.exec[db; "INSERT … VALUES(?)"; args]  parameterised exec
+sql.exec[db; "INSERT … VALUES(:a)"; d]   named parameters from dict d
   Result dict keys: "lastInsertId" (i), "rowsAffected" (i)`
 
+	m["sql.begin"] = `sql.begin db            start a transaction; returns sql.tx, open until sql.commit/sql.rollback
+sql.begin[db; opts]     with options dict, as for sql.tx (Isolation, ReadOnly)
+  tx: sql.begin db
+  tx sql.exec "DELETE FROM t WHERE …"
+  sql.rollback tx
+  sql.close db rolls back (with a warning) transactions still open.`
+
+	m["sql.commit"] = `sql.commit tx    commit a transaction started by sql.begin; returns 1i or error`
+
+	m["sql.rollback"] = `sql.rollback tx  roll back a transaction started by sql.begin; returns 1i or error`
+
+	m["sql.script"] = `sql.script[db; src]        run the ;-separated statements of SQL text src in order
+sql.script[db; src; opts]  with options dict
+  Result: columnar dict with "index", "rowsAffected" and "error" ("" on success)
+  Splits outside strings, quoted identifiers, comments, SQLite trigger bodies
+  and DuckDB $$ strings. Stops at the first failing statement.
+  The statements run on one connection, so BEGIN … COMMIT, PRAGMA, ATTACH
+  and TEMP tables work as in a .dump; a failure rolls back BEGIN.
+  opts keys:
+    Tx               i  run in one transaction, rolled back on failure (0/1)
+    ContinueOnError  i  run the remaining statements after a failure (0/1)`
+
+	m["sql.migrate"] = `sql.migrate[db; dir]        apply the pending migrations in dir (path or fs value)
+sql.migrate[db; dir; opts]  with options dict
+  Files: NNNN_name.up.sql and NNNN_name.down.sql, NNNN the version.
+  Applied versions are recorded in the ari_schema_migrations table; each
+  migration runs in its own transaction. A failure stops the run, keeping
+  the migrations before it, which its error lists (e.g. "1 up, 2 up").
+  Result: columnar dict with "version", "name" and "direction" ("up"/"down")
+  opts keys:
+    To  i  migrate up or down to this version (default: the latest)
+  sql.migrate[db; "migrations"; ..[To:0]]   roll back every migration`
+
+	m["sql.read"] = `sql.read[db; path]        load a CSV, JSON or Parquet file into a new table; returns its name
+sql.read[db; path; opts]  with options dict
+  t: db sql.read "data/events.csv"     creates the table events
+  The format follows the extension (.csv .tsv .json .ndjson .jsonl .parquet,
+  optionally .gz). DuckDB detects column types with read_csv/read_json_auto;
+  other drivers read CSV and JSON in Go, typing columns from the first 1000
+  records, in one transaction. Parquet needs DuckDB.
+  opts keys:
+    Table    s  name of the table (default: file name up to the first dot)
+    Format   s  "csv", "json" or "parquet" (default: from the extension)
+    Header   i  CSV: first line holds column names (0/1, default 1)
+    Delim    s  CSV: field delimiter (default "," or tab for .tsv)
+    Replace  i  replace the table if it exists (0/1)`
+
+	m["sql.write"] = `sql.write[db; "SELECT …"; path]        write a query's result to a file; returns exec-result dict
+sql.write[db; "SELECT …"; path; opts]  with options dict (Format, Header, Delim as in sql.read)
+  Result: "rowsAffected" is the number of rows written. JSON files hold one
+  object per line. DuckDB writes with COPY … TO; other drivers write CSV and
+  JSON (gzip for .gz paths) in Go.
+  sql.write[db; "SELECT * FROM t"; "t.parquet"]`
+
+	m["sql.register"] = `sql.register[db; "name"; t]    make columnar dict t queryable as table name; returns name
+  Loads t into a TEMP table (through Arrow on DuckDB) dropped by
+  sql.unregister or sql.close; registering name again replaces the data.
+  The table lives on one connection, pinned until sql.close, which runs
+  db's statements and the first open transaction; other transactions do
+  not see it. Column types: AI BIGINT, AF DOUBLE, AS VARCHAR, sql.time its
+  SQL type, AV its values' type.
+  sql.register[db; "users"; ..[id:1 2; name:("a";"b")]]
+  db sql.q "SELECT o.* FROM orders o JOIN users u ON o.user_id = u.id"`
+
+	m["sql.unregister"] = `db sql.unregister "name"    drop a table created by sql.register; returns 1i`
+
+	m["sql.func"] = `sql.func[db; "name"; f]        make Goal function f callable from SQL as name; returns name
+sql.func[db; "name"; f; opts]  with options dict
+  Arguments convert as query results, the result as a parameter; a Goal
+  error fails the query. Registering name again replaces f. DuckDB needs
+  Returns. SQLite functions apply process-wide: a name may be registered on
+  one open connection at a time, and pooled connections are replaced.
+  opts keys:
+    Args      s  SQL types of the arguments (default: f's rank, type ANY)
+    Returns   s  SQL type of the result, e.g. "BIGINT", "VARCHAR", "BOOLEAN"
+    Volatile  i  DuckDB: results may differ for the same arguments (0/1)
+  sql.func[db; "norm"; {_x}]
+  db sql.q "SELECT * FROM users WHERE norm(email) = 'a@b.c'"`
+
 	m["sql.tx"] = `sql.tx[db; {[tx] … }]    run lambda in a transaction
   Commits if lambda returns a non-error value; rolls back otherwise.
-  tx supports the same sql.q, sql.exec, and sql.tx interface as db.`
+  tx supports the same sql.q, sql.exec, and sql.tx interface as db.
+sql.tx[tx; {[sp] … }]    nested transaction in a SAVEPOINT (rolls back to it on error)
+  DuckDB has no SAVEPOINT support: a nested sql.tx is an error there,
+  raised before the lambda runs.
+sql.tx[db; {[tx] … }; opts]   transaction with options dict
+  opts keys:
+    Isolation  s  isolation level, e.g. "serializable", "read committed"
+    ReadOnly   i  read-only transaction (0/1)`
+
+	m["sql.cursor"] = `sql.cursor[db; "SELECT …"]                  run query; returns sql.cursor (rows not scanned)
+sql.cursor[db; "SELECT … WHERE x=?"; args]  parameterised cursor
+  Read rows in batches with sql.fetch or sql.each; sql.close cur releases it early.`
+
+	m["sql.fetch"] = `cur sql.fetch n    next (up to) n rows of cursor cur as a columnar dict
+  Returns a zero-row dict once the cursor is exhausted.
+  t: cur sql.fetch 10000`
+
+	m["sql.each"] = `sql.each[cur;n;f]    apply f to each batch of (up to) n rows of cursor cur
+  Returns the list of results, one per batch; an error from f closes the cursor.
+  total: +/sql.each[cur;10000;{+/x"amount"}]`
+
+	m["sql.rows"] = `sql.rows[db; "SELECT …"]                  run query; returns sql.rows, read with sql.next
+sql.rows[db; "SELECT … WHERE x=?"; args; opts]  parameterised, with options
+  opts keys (besides those of sql.q):
+    Batch  i  sql.next returns columnar dicts of up to n rows instead of row dicts
+  The rows close once exhausted, on error, by sql.close r, or when r is garbage collected.
+  r: db sql.rows "SELECT * FROM events"
+  {x}{say x"id"; sql.next r}/sql.next r`
+
+	m["sql.next"] = `sql.next r    next row of sql.rows r as a dict mapping column names to values
+  With ..[Batch:n], the next (up to) n rows as a columnar dict instead.
+  Returns 0i once the rows are exhausted, so {x}{…; sql.next r}/sql.next r loops over them.`
+
+	m["sql.insert"] = `sql.insert[db;"table";t]    insert every row of columnar dict t into table
+  t has the same shape as a sql.q result; columns are matched by name.
+  Runs in one transaction (DuckDB uses its Appender API when columns match).
+  Returns exec-result dict; "rowsAffected" is the number of rows inserted.
+  sql.insert[dst;"users";src sql.q "SELECT * FROM users"]`
+
+	m["sql.describe"] = `sql.describe[db; "SELECT …"]          column metadata of a query's result set
+sql.describe[db; "SELECT … WHERE x=?"; args]
+  Returns a columnar dict with one row per column: "name" (s), "type" (s),
+  "nullable", "length", "precision", "scale" (i, or 0n when not reported).
+  The query runs, but no rows are scanned.`
+
+	m["sql.explain"] = `sql.explain[db; "SELECT …"]          plan of a query, one row per plan node
+sql.explain[db; "SELECT … WHERE x=?"; args]
+  Returns a columnar dict: "id", "parent" (i; 0 for a root), "operator",
+  "detail" (s), "estimatedRows", "actualRows", "timeMilli" (f, or 0n).
+  SQLite: EXPLAIN QUERY PLAN, the query does not run and the numbers are 0n.
+  DuckDB: the query runs with the profiler, as for EXPLAIN ANALYZE;
+  statements that may write need sql.explain[db;q;args;..[AllowWrites:1]].
+  p: db sql.explain "SELECT region, sum(amount) FROM sales GROUP BY region"`
+
+	m["sql.prepare"] = `sql.prepare[db; "SELECT … WHERE x=?"]    prepare a statement; returns sql.stmt
+  sql.q and sql.exec accept st in place of db, with params as right argument:
+  st sql.q ,42                 run once with params ,42
+  st sql.q ..[id:1 2 3]        run once per row of a columnar dict; rows concatenated
+  st sql.exec ..[a:1 2;b:3 4]  run once per row (one transaction); rowsAffected summed
+  Statements prepared on tx are valid until the transaction ends.`
+
+	m["sql.tables"] = `sql.tables db    tables and views of database db
+  Returns a columnar dict: "schema" (s), "name" (s), "type" ("table" or "view").`
+
+	m["sql.columns"] = `sql.columns[db; "table"]    columns of a table, in table order
+  Returns a columnar dict: "name" (s), "type" (s), "nullable" (i), "default"
+  (s, or 0n), "pk" (i, 1 for primary key columns).
+  Table names may be schema-qualified: sql.columns[db; "main.users"]`
+
+	m["sql.indexes"] = `sql.indexes[db; "table"]    indexes of a table
+  Returns a columnar dict: "name" (s), "unique" (i), "primary" (i), "columns"
+  (s, comma-separated indexed columns).`
+
+	m["sql.list"] = `sql.list X    bind array X as a single query parameter
+  Its ? (or :name) placeholder expands to one placeholder per element:
+  sql.q[db; "SELECT * FROM t WHERE id IN (?)"; ,sql.list 1 2 3]
+  sql.q[db; "SELECT * FROM t WHERE b IN (:bs)"; ..[bs:sql.list ("x";"y")]]
+  On DuckDB "[?]" gives a native LIST. An empty list expands to NULL.
+  Not supported with prepared statements (sql.prepare).`
+
+	m["sql.time"] = `sql.time micros                  TIMESTAMP value(s) from Unix microseconds (UTC)
+sql.time[micros;"TYPE";"zone"]  DATE, TIME or TIMESTAMP[TZ] value(s) in a time zone
+  sql.time columns come from sql.q with opts ..[Temporal:1] and bind back as
+  timestamps in parameters and sql.insert. TIME counts micros since midnight;
+  0n in micros is NULL.
+  db sql.exec["INSERT INTO ev (at) VALUES (?)" ; ,sql.time 1704164645000000]`
+
+	m["sql.meta"] = `sql.meta ts    metadata dict of sql.time ts
+  Keys: "type" (s), "zone" (s), "micros" (I), "null" (I, 1 at each NULL)
+  (sql.meta t"at")"micros"`
 }
 
 // addRateLimitVerbHelp adds the individual ratelimit.* verb entries.
@@ -169,7 +405,7 @@ op          where op is a builtin's name (like "+" or "in")
 
 Extensions:
 "http"      HTTP client extension (http.get, http.post, http.client, …)
-"sql"       SQL extension (sql.open, sql.q, sql.exec, sql.tx)
+"sql"       SQL extension (sql.open, sql.q, sql.exec, sql.tx, sql.tables, …)
 "ratelimit" rate limiter extension (ratelimit.new, ratelimit.take)
 verb        where verb is an extension verb (like "http.get")
 
@@ -235,29 +471,75 @@ Examples:
 `
 
 const helpSQL = `SQL VERBS HELP
-Types: sql.conn (database connection)
+Types: sql.conn (database connection), sql.tx (transaction), sql.cursor,
+  sql.rows, sql.stmt (prepared statement), sql.time (temporal column)
 
 sql.open "scheme://dsn"                open connection; returns sql.conn or error
   sql.open "sqlite://data.db"          file-based SQLite database
   sql.open "sqlite://:memory:"         in-memory SQLite database
+sql.open["scheme://dsn"; opts]         open with pool and driver options (see help"sql.open")
+  sql.open["sqlite://data.db";..[Pragmas:..[journal_mode:"WAL"]]]
+  sql.open["duckdb://";..[Settings:..[threads:4]]]
 sql.close db                           close connection; returns 1i or error
 
 sql.q[db; "SELECT …"]                  query; returns columnar dict
 sql.q[db; "SELECT … WHERE x=?"; v]    parameterised query; v is a Goal array
+sql.q[db; "SELECT … WHERE x=:x"; d]   named parameters; d is a dict ..[x:…]
+sql.q[db; "… WHERE x IN (?)"; ,sql.list X]  expand array X into IN (?, ?, …)
+sql.q[db; "SELECT …"; v; opts]         query with options (see help"sql.q")
+sql.cached[db; "SELECT …"; v]          query through db's result cache (see help"sql.cached")
+sql.invalidate db                      drop db's cached query results
+sql.stats db                           pool and statement statistics; ..[Trace:1] logs statements
 sql.exec[db; "INSERT …"]               execute statement; returns exec-result dict
 sql.exec[db; "INSERT … VALUES(?)"; v]  parameterised exec
 sql.tx[db; {[tx] … }]                  lambda transaction (tx has same interface as db)
+sql.tx[tx; {[sp] … }]                  nested transaction using a SAVEPOINT
+sql.tx[db; {[tx] … }; opts]            with ..[Isolation:"serializable";ReadOnly:1]
+sql.begin db                           start a transaction across REPL inputs; returns sql.tx
+sql.commit tx / sql.rollback tx        end a sql.begin transaction; returns 1i
   Commits if lambda returns a non-error value; rolls back otherwise.
+sql.script[db; src; opts]              run a multi-statement SQL script, e.g. a schema file
+  Result: "index", "rowsAffected", "error"; opts Tx, ContinueOnError
+sql.migrate[db; dir; opts]             apply NNNN_name.up.sql migrations in dir; ..[To:n] migrates to n
+sql.read[db; path; opts]               load a CSV/JSON/Parquet file into a table; returns its name
+sql.write[db; "SELECT …"; path; opts]  write a query's result to a CSV/JSON/Parquet file
+sql.register[db; "name"; t]            make columnar dict t queryable as table name
+db sql.unregister "name"               drop a sql.register table (also done by sql.close)
+sql.func[db; "name"; f; opts]          make Goal function f callable from SQL queries
+sql.insert[db;"table";t]               bulk insert columnar dict t; returns exec-result dict
+sql.describe[db; "SELECT …"]           column name, type, nullable, length, precision, scale
+sql.explain[db; "SELECT …"]            query plan: "id", "parent", "operator", rows and timing
+
+Prepared statements (Type: sql.stmt) are parsed once, run many times:
+sql.prepare[db; "SELECT … WHERE x=?"]  prepare; returns sql.stmt
+st sql.q v / st sql.exec v             run with params v
+st sql.q t / st sql.exec t             run once per row of columnar dict t
+sql.close st                           release a statement
+
+Schema introspection (same result shape on every driver):
+sql.tables db                          tables and views: "schema", "name", "type"
+sql.columns[db; "table"]               columns: "name", "type", "nullable", "default", "pk"
+sql.indexes[db; "table"]               indexes: "name", "unique", "primary", "columns"
+
+Cursors (Type: sql.cursor) read large results in batches:
+sql.cursor[db; "SELECT …"; v]          run query; returns sql.cursor
+cur sql.fetch n                        next (up to) n rows as a columnar dict
+sql.each[cur;n;f]                      f applied to each n-row batch; list of results
+sql.close cur                          release a cursor before it is exhausted
+sql.rows[db; "SELECT …"; v; opts]      run query; returns sql.rows (one row per sql.next)
+sql.next r                             next row as a dict, or 0i once exhausted
 
 Query result: dict mapping column names (S) to per-column arrays
   t"col"              column array (AI / AF / AS / AV)
-  nan t"col"          boolean array; 1 at each NULL position
+  nan t"col"          boolean array; 1 at each NULL position (numeric columns)
   42 nan t"col"       fill NULLs with 42
-  "" nan t"col"       fill NULLs with empty string
 
 Exec result dict: "lastInsertId" (i) and "rowsAffected" (i)
 
-NULL maps to 0n (Goal's NaN). Columns with any NULL are returned as AF or AV.
+NULL maps to 0n (Goal's NaN) in numeric columns, returned as AF (integers
+exact up to 2^53), and to "" in string columns, returned as AS. Options
+..[Fill:..[i:-1;s:"NA"]] choose other fill values; ..[NullMask:1] returns
+..[data:t;null:m] with NULL masks.
 
 Type mapping:
   SQL NULL / unknown    → 0n
@@ -267,6 +549,24 @@ Type mapping:
   SQL BLOB              → byte array
   SQL BOOLEAN           → I (1 or 0)
   time.Time             → I (Unix microseconds, UTC)
+  DuckDB LIST           → array;  STRUCT → dict (sorted fields);  MAP → dict
+  DuckDB DECIMAL        → N;  HUGEINT → I;  UUID → S
+  DuckDB INTERVAL       → ..[months:i;days:i;micros:i]
+On DuckDB, arrays and dicts nested in params bind LIST, STRUCT (string keys)
+and MAP values: sql.exec[db;"INSERT INTO t VALUES (?, ?)";(1 2 3;..[a:1])]
+
+Temporal mode: sql.q[db;q;v;..[Temporal:1]] returns DATE/TIME/TIMESTAMP
+columns as sql.time values that keep the SQL type and zone:
+sql.meta ts                            dict of "type", "zone", "micros", "null"
+sql.time[micros;"TYPE";"zone"]         build sql.time values to bind as params
+
+Arrow: on DuckDB, sql.q[db;q;v;..[Arrow:1]] reads the result through Arrow
+record batches, filling whole columns at once; faster for large results.
+
+Timeouts: TimeoutMilli in sql.open opts sets a default time limit for each
+call on the connection; TimeoutMilli in sql.q/sql.exec opts overrides it.
+A call that runs out of time returns an error. In the ari REPL, Ctrl-C
+interrupts the running query with an error instead of exiting.
 `
 
 const helpRateLimit = `RATELIMIT VERBS HELP
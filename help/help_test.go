@@ -164,11 +164,39 @@ func TestSQLVerbEntries(t *testing.T) {
 		topic string
 		want  []string
 	}{
-		{"sql.open", []string{"sql.open", "scheme://"}},
+		{"sql.open", []string{"sql.open", "scheme://", "TimeoutMilli", "MaxOpenConns", "Pragmas", "Settings"}},
 		{"sql.close", []string{"sql.close"}},
-		{"sql.q", []string{"sql.q", "SELECT"}},
+		{"sql.q", []string{"sql.q", "SELECT", "named parameters", "Fill", "NullMask", "Arrow"}},
 		{"sql.exec", []string{"sql.exec", "INSERT"}},
-		{"sql.tx", []string{"sql.tx", "transaction"}},
+		{"sql.begin", []string{"sql.begin", "sql.commit", "sql.rollback"}},
+		{"sql.commit", []string{"sql.commit", "sql.begin"}},
+		{"sql.rollback", []string{"sql.rollback", "sql.begin"}},
+		{"sql.script", []string{"sql.script", "rowsAffected", "trigger", "ContinueOnError"}},
+		{"sql.migrate", []string{"sql.migrate", ".up.sql", ".down.sql", "ari_schema_migrations", "To"}},
+		{"sql.read", []string{"sql.read", "Parquet", "Table", "Header", "Delim", "Replace"}},
+		{"sql.write", []string{"sql.write", "COPY", "rowsAffected"}},
+		{"sql.register", []string{"sql.register", "sql.unregister", "sql.close", "BIGINT"}},
+		{"sql.unregister", []string{"sql.unregister", "sql.register"}},
+		{"sql.func", []string{"sql.func", "Args", "Returns", "Volatile", "in-memory"}},
+		{"sql.tx", []string{"sql.tx", "transaction", "SAVEPOINT", "Isolation", "ReadOnly"}},
+		{"sql.cursor", []string{"sql.cursor", "sql.fetch"}},
+		{"sql.fetch", []string{"sql.fetch", "cursor"}},
+		{"sql.cached", []string{"sql.cached", "CacheSize", "sql.invalidate"}},
+		{"sql.invalidate", []string{"sql.invalidate", "sql.cached"}},
+		{"sql.stats", []string{"sql.stats", "latency", "Trace"}},
+		{"sql.rows", []string{"sql.rows", "sql.next", "Batch"}},
+		{"sql.next", []string{"sql.next", "sql.rows", "0i"}},
+		{"sql.each", []string{"sql.each", "batch"}},
+		{"sql.insert", []string{"sql.insert", "rowsAffected"}},
+		{"sql.describe", []string{"sql.describe", "nullable", "precision"}},
+		{"sql.explain", []string{"sql.explain", "operator", "actualRows", "EXPLAIN ANALYZE"}},
+		{"sql.prepare", []string{"sql.prepare", "sql.stmt", "per row"}},
+		{"sql.tables", []string{"sql.tables", "view"}},
+		{"sql.columns", []string{"sql.columns", "nullable", "pk"}},
+		{"sql.indexes", []string{"sql.indexes", "unique"}},
+		{"sql.list", []string{"sql.list", "IN (?)", "LIST"}},
+		{"sql.time", []string{"sql.time", "micros", "zone"}},
+		{"sql.meta", []string{"sql.meta", "type", "null"}},
 	}
 
 	for _, tc := range cases {
@@ -0,0 +1,432 @@
+//go:build !no_duckdb_arrow
+
+// arrow_duckdb.go implements the Arrow option of sql.q for DuckDB: results
+// are read as Arrow record batches and copied column by column into Goal
+// arrays, skipping the row-wise scan into []any and buildColumn. The tables
+// of sql.register are loaded the other way, from an Arrow record. Building
+// with the no_duckdb_arrow tag (which also drops go-duckdb's Arrow support)
+// leaves the option unavailable and sql.register inserting rows; see
+// arrow_noarrow.go.
+
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/marcboeker/go-duckdb"
+)
+
+// microsPerDay converts DATE values (days since 1970-01-01) to Unix
+// microseconds.
+const microsPerDay = 86_400_000_000
+
+// duckdbQueryArrow runs query on conn through DuckDB's Arrow interface and
+// returns the QueryResult dict. Columns follow the same
+// mapping and NULL rules as the row-wise path (see buildColumn), except
+// that DECIMAL(p,0) and HUGEINT both give integers; types other than
+// integers, floats, DECIMAL, booleans, strings, BLOBs, DATE and TIMESTAMP
+// are reported as errors.
+func duckdbQueryArrow(ctx context.Context, conn *stdsql.Conn, query string, args []any, opts queryOptions) (goal.V, error) {
+	var result goal.V
+	err := conn.Raw(func(driverConn any) error {
+		dc, ok := driverConn.(driver.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection type %T", driverConn)
+		}
+		a, err := duckdb.NewArrowFromConn(dc)
+		if err != nil {
+			return err
+		}
+		reader, err := a.QueryContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer reader.Release()
+		result, err = readArrow(ctx, reader, opts)
+		return err
+	})
+	return result, err
+}
+
+// arrowLoadView is the name of the view an Arrow record is registered
+// under while it is loaded into a table.
+const arrowLoadView = "ari_register_load"
+
+// duckdbLoadArrow loads the columns of a table of sql.register, created on
+// conn with the given column types, through DuckDB's Arrow interface: the
+// columns are registered as a view of an Arrow record, which can be scanned
+// only once, then copied into the table.
+func duckdbLoadArrow(ctx context.Context, conn *stdsql.Conn, table string, types []string, cols []goal.V, nrows int) error {
+	rec, err := arrowRecord(types, cols, nrows)
+	if err != nil {
+		return err
+	}
+	defer rec.Release()
+	reader, err := array.NewRecordReader(rec.Schema(), []arrow.Record{rec})
+	if err != nil {
+		return err
+	}
+	defer reader.Release()
+	return conn.Raw(func(driverConn any) error {
+		dc, ok := driverConn.(driver.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection type %T", driverConn)
+		}
+		ex, ok := driverConn.(driver.ExecerContext)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection type %T", driverConn)
+		}
+		a, err := duckdb.NewArrowFromConn(dc)
+		if err != nil {
+			return err
+		}
+		release, err := a.RegisterView(reader, arrowLoadView)
+		if err != nil {
+			return err
+		}
+		defer release()
+		_, err = ex.ExecContext(ctx, "INSERT INTO "+quoteName(table)+" SELECT * FROM "+arrowLoadView, nil)
+		if _, dropErr := ex.ExecContext(context.Background(), "DROP VIEW IF EXISTS "+arrowLoadView, nil); err == nil {
+			err = dropErr
+		}
+		return err
+	})
+}
+
+// arrowRecord builds an Arrow record from the columns of a table of
+// sql.register, with an Arrow type for each SQL type of registerType:
+// temporal columns are timestamps, which the table's types are cast from.
+func arrowRecord(types []string, cols []goal.V, nrows int) (arrow.Record, error) {
+	mem := memory.DefaultAllocator
+	fields := make([]arrow.Field, len(cols))
+	arrays := make([]arrow.Array, 0, len(cols))
+	defer func() {
+		for _, arr := range arrays {
+			arr.Release()
+		}
+	}()
+	for j, col := range cols {
+		var b array.Builder
+		switch types[j] {
+		case "BIGINT":
+			b = array.NewInt64Builder(mem)
+		case "DOUBLE":
+			b = array.NewFloat64Builder(mem)
+		case "VARCHAR":
+			b = array.NewStringBuilder(mem)
+		case "BLOB":
+			b = array.NewBinaryBuilder(mem, arrow.BinaryTypes.Binary)
+		default:
+			b = array.NewTimestampBuilder(mem, &arrow.TimestampType{Unit: arrow.Microsecond})
+		}
+		for i := range nrows {
+			v, err := columnValue(col, i)
+			if err == nil {
+				err = appendArrow(b, v)
+			}
+			if err != nil {
+				b.Release()
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+		}
+		arrays = append(arrays, b.NewArray())
+		b.Release()
+		fields[j] = arrow.Field{Name: fmt.Sprintf("c%d", j), Type: arrays[j].DataType(), Nullable: true}
+	}
+	// The record holds its own references to the arrays.
+	return array.NewRecord(arrow.NewSchema(fields, nil), arrays, int64(nrows)), nil
+}
+
+// appendArrow appends a value of columnValue to an Arrow builder of
+// arrowRecord, or a NULL for nil.
+func appendArrow(b array.Builder, v any) error {
+	if v == nil {
+		b.AppendNull()
+		return nil
+	}
+	switch b := b.(type) {
+	case *array.Int64Builder:
+		if x, ok := v.(int64); ok {
+			b.Append(x)
+			return nil
+		}
+	case *array.Float64Builder:
+		switch x := v.(type) {
+		case float64:
+			b.Append(x)
+			return nil
+		case int64:
+			b.Append(float64(x))
+			return nil
+		}
+	case *array.StringBuilder:
+		if x, ok := v.(string); ok {
+			b.Append(x)
+			return nil
+		}
+	case *array.BinaryBuilder:
+		if x, ok := v.([]byte); ok {
+			b.Append(x)
+			return nil
+		}
+	case *array.TimestampBuilder:
+		if x, ok := v.(time.Time); ok {
+			b.Append(arrow.Timestamp(x.UnixMicro()))
+			return nil
+		}
+	}
+	return fmt.Errorf("unexpected value of type %T", v)
+}
+
+// readArrow builds a QueryResult dict from the record batches of reader.
+func readArrow(ctx context.Context, reader array.RecordReader, opts queryOptions) (goal.V, error) {
+	fields := reader.Schema().Fields()
+	names := make([]string, len(fields))
+	cols := make([]arrowColumn, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+		kind, ok := arrowKind(f.Type)
+		if !ok {
+			return goal.V{}, fmt.Errorf("column %q: type %s is not supported with the Arrow option", f.Name, f.Type)
+		}
+		cols[i].kind = kind
+	}
+	for reader.Next() {
+		if err := ctx.Err(); err != nil {
+			return goal.V{}, err
+		}
+		rec := reader.Record()
+		for i := range cols {
+			if err := cols[i].append(rec.Column(i)); err != nil {
+				return goal.V{}, fmt.Errorf("column %q: %w", names[i], err)
+			}
+		}
+	}
+	if err := reader.Err(); err != nil {
+		return goal.V{}, err
+	}
+
+	keys := goal.NewAS(names)
+	colArrays := make([]goal.V, len(cols))
+	for i := range cols {
+		colArrays[i] = cols[i].array(opts.fill)
+	}
+	result := goal.NewD(keys, goal.NewAV(colArrays))
+	if !opts.nullMask {
+		return result, nil
+	}
+	masks := make([]goal.V, len(cols))
+	for i := range cols {
+		masks[i] = cols[i].mask()
+	}
+	return goal.NewD(goal.NewAS([]string{"data", "null"}),
+		goal.NewAV([]goal.V{result, goal.NewD(keys, goal.NewAV(masks))})), nil
+}
+
+// arrowKind returns the kind of the Goal array an Arrow type is converted
+// to, or false if the type is not supported.
+func arrowKind(t arrow.DataType) (colKind, bool) {
+	switch t.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64,
+		arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64,
+		arrow.BOOL, arrow.DATE32, arrow.TIMESTAMP:
+		return kindInt, true
+	case arrow.FLOAT32, arrow.FLOAT64:
+		return kindFloat, true
+	case arrow.DECIMAL128:
+		// DuckDB exports HUGEINT as DECIMAL(38,0): scale 0 gives integers.
+		if t.(*arrow.Decimal128Type).Scale == 0 { //nolint:errcheck,forcetypeassert // DECIMAL128 has a Decimal128Type
+			return kindInt, true
+		}
+		return kindFloat, true
+	case arrow.STRING, arrow.LARGE_STRING, arrow.STRING_VIEW:
+		return kindString, true
+	case arrow.BINARY, arrow.LARGE_BINARY, arrow.BINARY_VIEW:
+		return kindOther, true
+	}
+	return kindNull, false
+}
+
+// arrowColumn accumulates the values of one result column across record
+// batches, in the slice matching its kind.
+type arrowColumn struct {
+	kind    colKind
+	n       int
+	ints    []int64
+	floats  []float64
+	strs    []string
+	blobs   []goal.V
+	nulls   []bool // nil while no value is NULL
+	hasNull bool
+}
+
+// append adds the values of an Arrow array to the column.
+func (col *arrowColumn) append(arr arrow.Array) error {
+	n := arr.Len()
+	if arr.NullN() > 0 {
+		if col.nulls == nil {
+			col.nulls = make([]bool, col.n, col.n+n)
+		}
+		for i := range n {
+			col.nulls = append(col.nulls, arr.IsNull(i))
+		}
+		col.hasNull = true
+	} else if col.nulls != nil {
+		col.nulls = append(col.nulls, make([]bool, n)...)
+	}
+	col.n += n
+
+	switch a := arr.(type) {
+	case *array.Int64:
+		col.ints = append(col.ints, a.Int64Values()...)
+	case *array.Int32:
+		col.ints = appendInts(col.ints, a.Int32Values())
+	case *array.Int16:
+		col.ints = appendInts(col.ints, a.Int16Values())
+	case *array.Int8:
+		col.ints = appendInts(col.ints, a.Int8Values())
+	case *array.Uint64:
+		col.ints = appendInts(col.ints, a.Uint64Values())
+	case *array.Uint32:
+		col.ints = appendInts(col.ints, a.Uint32Values())
+	case *array.Uint16:
+		col.ints = appendInts(col.ints, a.Uint16Values())
+	case *array.Uint8:
+		col.ints = appendInts(col.ints, a.Uint8Values())
+	case *array.Boolean:
+		for i := range n {
+			col.ints = append(col.ints, intValue(a.Value(i)))
+		}
+	case *array.Date32:
+		for _, d := range a.Date32Values() {
+			col.ints = append(col.ints, int64(d)*microsPerDay)
+		}
+	case *array.Timestamp:
+		unit := a.DataType().(*arrow.TimestampType).Unit //nolint:errcheck,forcetypeassert // Timestamp arrays have a TimestampType
+		for _, ts := range a.TimestampValues() {
+			col.ints = append(col.ints, timestampMicros(int64(ts), unit))
+		}
+	case *array.Decimal128:
+		scale := a.DataType().(*arrow.Decimal128Type).Scale //nolint:errcheck,forcetypeassert // Decimal128 arrays have a Decimal128Type
+		for i, x := range a.Values() {
+			switch {
+			case col.kind == kindFloat:
+				col.floats = append(col.floats, x.ToFloat64(scale))
+			case arr.IsNull(i) || fitsInt64(x.HighBits(), x.LowBits()):
+				col.ints = append(col.ints, int64(x.LowBits())) //nolint:gosec // G115: checked by fitsInt64
+			default:
+				return fmt.Errorf("value %s exceeds 64 bits", x.ToString(0))
+			}
+		}
+	case *array.Float64:
+		col.floats = append(col.floats, a.Float64Values()...)
+	case *array.Float32:
+		for _, x := range a.Float32Values() {
+			col.floats = append(col.floats, float64(x))
+		}
+	case interface{ Value(int) string }: // String, LargeString, StringView
+		for i := range n {
+			col.strs = append(col.strs, a.Value(i))
+		}
+	case interface{ Value(int) []byte }: // Binary, LargeBinary, BinaryView
+		for i := range n {
+			if arr.IsNull(i) {
+				col.blobs = append(col.blobs, goal.NewF(math.NaN()))
+				continue
+			}
+			col.blobs = append(col.blobs, sqlValueToGoal(a.Value(i)))
+		}
+	default:
+		return fmt.Errorf("unexpected Arrow array %T", arr)
+	}
+	return nil
+}
+
+// appendInts appends integer values widened to int64.
+func appendInts[T int8 | int16 | int32 | uint8 | uint16 | uint32 | uint64](dst []int64, xs []T) []int64 {
+	for _, x := range xs {
+		dst = append(dst, int64(x)) //nolint:gosec // G115: uint64 widening as in sqlValueToGoal
+	}
+	return dst
+}
+
+// fitsInt64 reports whether the 128-bit integer hi·2⁶⁴+lo fits in an int64.
+func fitsInt64(hi int64, lo uint64) bool {
+	return (hi == 0 && lo <= math.MaxInt64) || (hi == -1 && lo > math.MaxInt64)
+}
+
+// timestampMicros converts a timestamp in unit to Unix microseconds.
+func timestampMicros(ts int64, unit arrow.TimeUnit) int64 {
+	switch unit {
+	case arrow.Second:
+		return ts * 1_000_000
+	case arrow.Millisecond:
+		return ts * 1_000
+	case arrow.Nanosecond:
+		return ts / 1_000
+	}
+	return ts
+}
+
+// isNull reports whether value i of the column is NULL.
+func (col *arrowColumn) isNull(i int) bool { return col.hasNull && col.nulls[i] }
+
+// array returns the column as a Goal array, replacing NULLs as buildColumn
+// does.
+func (col *arrowColumn) array(fill nullFill) goal.V {
+	switch col.kind {
+	case kindInt:
+		if col.hasNull && !fill.iSet {
+			floats := make([]float64, col.n)
+			for i, x := range col.ints {
+				if col.isNull(i) {
+					floats[i] = math.NaN()
+				} else {
+					floats[i] = float64(x)
+				}
+			}
+			return goal.NewAF(floats)
+		}
+		for i := range col.ints {
+			if col.isNull(i) {
+				col.ints[i] = fill.i
+			}
+		}
+		return goal.NewAI(nonNil(col.ints))
+	case kindFloat:
+		for i := range col.floats {
+			if col.isNull(i) {
+				col.floats[i] = fill.float()
+			}
+		}
+		return goal.NewAF(nonNil(col.floats))
+	case kindString:
+		for i := range col.strs {
+			if col.isNull(i) {
+				col.strs[i] = fill.s
+			}
+		}
+		return goal.NewAS(nonNil(col.strs))
+	}
+	return goal.NewAV(nonNil(col.blobs))
+}
+
+// mask returns the column's NULL mask (see nullMask).
+func (col *arrowColumn) mask() goal.V {
+	mask := make([]int64, col.n)
+	for i := range mask {
+		if col.isNull(i) {
+			mask[i] = 1
+		}
+	}
+	return goal.NewAI(mask)
+}
@@ -0,0 +1,85 @@
+//go:build !no_duckdb_arrow
+
+package sql_test
+
+import (
+	"strings"
+	"testing"
+)
+
+// ---------------------------------------------------------------------------
+// TestDuckDBArrow
+// ---------------------------------------------------------------------------
+
+// The Arrow option must give the same result as the row-wise path.
+func TestDuckDBArrow(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id BIGINT, n INTEGER, x DOUBLE, s VARCHAR, b BOOLEAN,
+		d DATE, ts TIMESTAMP, bl BLOB, dec DECIMAL(10,2))"]`)
+	eval(t, ctx, `sql.exec[db;"INSERT INTO t VALUES
+		(1, 10, 1.5, 'a', true, '2024-01-02', '2024-01-02 03:04:05.123456', 'ab'::BLOB, 1.25),
+		(2, NULL, NULL, NULL, NULL, NULL, NULL, NULL, NULL),
+		(3, 30, 2.5, '', false, '1969-12-31', '1970-01-01 00:00:00', ''::BLOB, -3.5)"]`)
+
+	for _, tt := range []struct{ query, opts string }{
+		{`"SELECT * FROM t ORDER BY id"`, ``},
+		{`"SELECT * FROM t ORDER BY id"`, `Fill:..[i:-1;n:0;s:"NA"]`},
+		{`"SELECT * FROM t ORDER BY id"`, `NullMask:1`},
+		{`"SELECT * FROM t WHERE id > ? ORDER BY id"`, ``},
+		{`"SELECT * FROM t WHERE false"`, ``},
+		{`"SELECT sum(id) AS total, count(*) AS n, avg(x) AS mean FROM t"`, ``},
+		{`"SELECT i, i % 7 AS m, i::VARCHAR AS s FROM range(5000) r(i)"`, ``},
+	} {
+		args := `()`
+		if strings.Contains(tt.query, "?") {
+			args = `,1`
+		}
+		rows := `sql.q[db;` + tt.query + `;` + args + `;..[` + tt.opts + `]]`
+		arrow := `sql.q[db;` + tt.query + `;` + args + `;..[Arrow:1;` + tt.opts + `]]`
+		if tt.opts == `` {
+			rows = `sql.q[db;` + tt.query + `;` + args + `]`
+			arrow = `sql.q[db;` + tt.query + `;` + args + `;..[Arrow:1]]`
+		}
+		if mustI(t, eval(t, ctx, rows+` ~ `+arrow)) != 1 {
+			t.Errorf("%s %s: Arrow result differs:\n rows:  %s\n arrow: %s", tt.query, tt.opts,
+				eval(t, ctx, rows).Sprint(ctx, true), eval(t, ctx, arrow).Sprint(ctx, true))
+		}
+	}
+
+	// Column types.
+	d := mustDict(t, ctx, eval(t, ctx, `sql.q[db;"SELECT id, x, s, b FROM t ORDER BY id";();..[Arrow:1]]`))
+	for col, want := range map[string]string{"id": "I", "x": "N", "s": "S", "b": "N"} {
+		if got := dictLookup(t, ctx, d, col).Type(); got != want {
+			t.Errorf("column %s: expected type %s, got %s", col, want, got)
+		}
+	}
+
+	// HUGEINT beyond 64 bits.
+	msg := evalPanic(t, ctx, `sql.q[db;"SELECT (2::HUGEINT ** 100)::HUGEINT AS h";();..[Arrow:1]]`)
+	if !strings.Contains(msg, "exceeds 64 bits") {
+		t.Errorf("expected overflow error, got %s", msg)
+	}
+}
+
+func TestDuckDBArrowErrors(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	for _, tt := range []struct{ src, want string }{
+		{`sql.q[db;"SELECT [1, 2] AS l";();..[Arrow:1]]`, "not supported with the Arrow option"},
+		{`sql.q[db;"SELECT 1 AS x";();..[Arrow:1;Temporal:1]]`, "cannot be combined"},
+		{`sql.tx[db;{[tx] sql.q[tx;"SELECT 1 AS x";();..[Arrow:1]]}]`, "requires a sql.conn"},
+		{`sql.exec[db;"SELECT 1";();..[Arrow:1]]`, "only applies to sql.q"},
+		{`sql.cursor[db;"SELECT 1";();..[Arrow:1]]`, "only applies to sql.q"},
+		{`sql.q[db;"SELECT nope"; ();..[Arrow:1]]`, "nope"},
+	} {
+		if msg := evalPanic(t, ctx, tt.src); !strings.Contains(msg, tt.want) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.src, tt.want, msg)
+		}
+	}
+
+	ctx.AssignGlobal("lite", openMem(t, ctx))
+	if msg := evalPanic(t, ctx, `sql.q[lite;"SELECT 1 AS x";();..[Arrow:1]]`); !strings.Contains(msg, "not supported by the sqlite driver") {
+		t.Errorf("sqlite: expected unsupported error, got %s", msg)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build no_duckdb_arrow
+
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// duckdbQueryArrow reports that the Arrow option is unavailable: the
+// no_duckdb_arrow build tag removes go-duckdb's Arrow interface.
+func duckdbQueryArrow(context.Context, *stdsql.Conn, string, []any, queryOptions) (goal.V, error) {
+	return goal.V{}, errors.New("the Arrow option is unavailable: built with the no_duckdb_arrow tag")
+}
+
+// duckdbLoadArrow reports that loading through Arrow is unavailable, so
+// that sql.register inserts the rows instead.
+func duckdbLoadArrow(context.Context, *stdsql.Conn, string, []string, []goal.V, int) error {
+	return errors.ErrUnsupported
+}
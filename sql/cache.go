@@ -0,0 +1,261 @@
+package sql
+
+import (
+	"container/list"
+	stdsql "database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// defaultCacheSize is the number of results a connection's cache holds
+// when the CacheSize option is not given.
+const defaultCacheSize = 64
+
+// ---------------------------------------------------------------------------
+// Query result cache
+// ---------------------------------------------------------------------------
+
+// queryCache memoises the results of queries run on a connection, keyed by
+// query text, parameters and result options (see cacheKey). It evicts the
+// least recently used result beyond its size, and drops results older than
+// its time to live.
+type queryCache struct {
+	ttl     time.Duration // time to live of a result, or 0 for no limit
+	size    int           // maximum number of results
+	order   *list.List    // *cacheEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+// cacheEntry is a cached query result.
+type cacheEntry struct {
+	key    string
+	result goal.V
+	added  time.Time
+}
+
+// newQueryCache returns an empty cache of up to size results (the default
+// size if size is negative).
+func newQueryCache(size int, ttl time.Duration) *queryCache {
+	if size < 0 {
+		size = defaultCacheSize
+	}
+	return &queryCache{ttl: ttl, size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+// get returns the cached result of key, if any and not expired.
+func (qc *queryCache) get(key string) (goal.V, bool) {
+	el, ok := qc.entries[key]
+	if !ok {
+		return goal.V{}, false
+	}
+	e, ok := el.Value.(*cacheEntry)
+	if !ok {
+		return goal.V{}, false
+	}
+	if qc.ttl > 0 && time.Since(e.added) > qc.ttl {
+		qc.remove(el)
+		return goal.V{}, false
+	}
+	qc.order.MoveToFront(el)
+	return e.result, true
+}
+
+// put caches the result of key, evicting the least recently used results
+// beyond the cache's size.
+func (qc *queryCache) put(key string, result goal.V) {
+	if qc.size == 0 {
+		return
+	}
+	if el, ok := qc.entries[key]; ok {
+		qc.remove(el)
+	}
+	// The cached result is shared by later calls: its reference count keeps
+	// Goal from amending it in place.
+	result.IncrRC()
+	qc.entries[key] = qc.order.PushFront(&cacheEntry{key: key, result: result, added: time.Now()})
+	for qc.order.Len() > qc.size {
+		qc.remove(qc.order.Back())
+	}
+}
+
+// remove drops a cached result.
+func (qc *queryCache) remove(el *list.Element) {
+	qc.order.Remove(el)
+	if e, ok := el.Value.(*cacheEntry); ok {
+		delete(qc.entries, e.key)
+		e.result.DecrRC()
+	}
+}
+
+// clear drops every cached result and returns their number.
+func (qc *queryCache) clear() int {
+	n := qc.order.Len()
+	for qc.order.Len() > 0 {
+		qc.remove(qc.order.Front())
+	}
+	return n
+}
+
+// invalidateCache drops the cached query results of c, after a statement
+// that may have changed the data they were read from.
+func (c *Conn) invalidateCache() {
+	if c != nil && c.cache != nil {
+		c.cache.clear()
+	}
+}
+
+// readOnlyQuery reports whether query only reads data, so that sql.q may
+// cache its result and need not drop the cached ones: it starts with
+// SELECT, WITH, VALUES or another reading keyword, and has no keyword of a
+// writing statement (e.g. a WITH … INSERT, or a RETURNING clause) outside
+// strings, quoted identifiers and comments. It errs on the side of false.
+func readOnlyQuery(query string, syn scriptSyntax) bool {
+	first := true
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(query)
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = len(query)
+			}
+		case c == '\'' || c == '"' || syn.bracketIdents && c == '`':
+			i = skipQuoted(query, i, c)
+		case syn.bracketIdents && c == '[':
+			if j := strings.IndexByte(query[i:], ']'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(query)
+			}
+		case syn.dollarQuotes && c == '$':
+			i = skipDollarQuoted(query, i)
+		case isNameStart(c):
+			j := i + 1
+			for j < len(query) && isNameChar(query[j]) {
+				j++
+			}
+			word := strings.ToUpper(query[i:j])
+			if first && !readingWords[word] || writingWords[word] {
+				return false
+			}
+			first = false
+			i = j
+		default:
+			if first && c != ' ' && c != '\t' && c != '\n' && c != '\r' && c != '(' {
+				return false
+			}
+			i++
+		}
+	}
+	return !first
+}
+
+// readingWords are the first keywords of statements that only read data.
+var readingWords = map[string]bool{ //nolint:gochecknoglobals // constant lookup table
+	"SELECT": true, "WITH": true, "VALUES": true, "FROM": true, "TABLE": true,
+	"SHOW": true, "DESCRIBE": true, "SUMMARIZE": true,
+}
+
+// writingWords are keywords that make a statement starting with a reading
+// keyword write data.
+var writingWords = map[string]bool{ //nolint:gochecknoglobals // constant lookup table
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "RETURNING": true,
+	"CREATE": true, "DROP": true, "ALTER": true, "COPY": true, "INTO": true,
+}
+
+// cacheKey identifies the result of a query: its bound text, its driver
+// arguments printed with their types, and the options shaping the result.
+func cacheKey(query string, args []any, opts queryOptions) string {
+	var sb strings.Builder
+	sb.WriteString(query)
+	for _, a := range args {
+		sb.WriteByte(0)
+		if na, ok := a.(stdsql.NamedArg); ok {
+			sb.WriteString(":" + na.Name + "=")
+			a = na.Value
+		}
+		switch x := a.(type) {
+		case []byte:
+			fmt.Fprintf(&sb, "[]byte:%x", x)
+		case time.Time:
+			sb.WriteString("time:" + x.Format(time.RFC3339Nano))
+		default:
+			fmt.Fprintf(&sb, "%T:%v", x, x)
+		}
+	}
+	fmt.Fprintf(&sb, "\x00temporal=%t nullmask=%t arrow=%t fill=%+v", opts.temporal, opts.nullMask, opts.arrow, opts.fill)
+	return sb.String()
+}
+
+// ---------------------------------------------------------------------------
+// sql.cached  (dyad: conn sql.cached "query"  or  sql.cached[conn;"query";args])
+// ---------------------------------------------------------------------------
+
+// vfCached runs a query like sql.q, but returns the connection's cached
+// result of the same query text and parameters when there is one, so that
+// repeated expensive queries, e.g. the aggregates of an exploratory
+// session, run once. The cache is the one configured by sql.open's Cache
+// options, or a default one (see vfOpen). With Cache:1 given to sql.open,
+// sql.q uses it too, unless given ..[Cache:0]. Queries in transactions and
+// prepared statements bypass it.
+//
+// Cached results are dropped by sql.invalidate, and by every statement
+// run on the connection or its transactions with sql.exec (as well as
+// sql.insert, sql.script, sql.migrate, sql.read, sql.register, sql.func,
+// commits, and queries that are not read-only, see readOnlyQuery):
+// changes made by other connections or processes are not seen until then.
+//
+// Usage:
+//
+//	t: db sql.cached "SELECT region, sum(amount) FROM sales GROUP BY region"
+//	t: sql.cached[db;"SELECT * FROM sales WHERE day=?";,"2024-01-02"]
+//
+// conn must be a sql.conn.
+func vfCached(_ *goal.Context, args []goal.V) goal.V {
+	call, err := parseConnQueryArgs("sql.cached", args)
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	if !onConn(call.conn) {
+		return goal.Panicf("sql.cached : expected sql.conn, not a transaction or prepared statement")
+	}
+	if call.db.cache == nil {
+		call.db.cache = newQueryCache(-1, 0)
+	}
+	call.opts.cache, call.opts.cacheSet = true, true
+	return runQuery("sql.cached", call)
+}
+
+// ---------------------------------------------------------------------------
+// sql.invalidate  (monad: sql.invalidate db)
+// ---------------------------------------------------------------------------
+
+// vfInvalidate drops the cached query results of a connection and returns
+// their number.
+//
+// Usage:
+//
+//	sql.invalidate db
+func vfInvalidate(_ *goal.Context, args []goal.V) goal.V {
+	if len(args) != 1 {
+		return goal.Panicf("sql.invalidate conn : expected 1 argument, got %d", len(args))
+	}
+	c, ok := args[0].BV().(*Conn)
+	if !ok {
+		return goal.Panicf("sql.invalidate conn : expected sql.conn, got %q", args[0].Type())
+	}
+	if c.cache == nil {
+		return goal.NewI(0)
+	}
+	return goal.NewI(int64(c.cache.clear()))
+}
@@ -0,0 +1,171 @@
+package sql_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// openPair returns a context with db and other bound to two connections to
+// the same SQLite file holding t(id) = 1..3; db is opened with the opts
+// dict, if any.
+func openPair(t *testing.T, opts string) *goal.Context {
+	t.Helper()
+	ctx := newCtx(t)
+	path := t.TempDir() + "/c.db"
+	ctx.AssignGlobal("db", openFile(t, ctx, path, opts))
+	ctx.AssignGlobal("other", openFile(t, ctx, path, "",
+		`CREATE TABLE t (id INTEGER)`, `INSERT INTO t VALUES (1),(2),(3)`))
+	return ctx
+}
+
+// count evaluates a query of count(*) AS n and returns n.
+func count(t *testing.T, ctx *goal.Context, src string) int64 {
+	t.Helper()
+	return mustI(t, eval(t, ctx, `*(`+src+`)"n"`))
+}
+
+// ---------------------------------------------------------------------------
+// TestCached
+// ---------------------------------------------------------------------------
+
+func TestCached(t *testing.T) {
+	ctx := openPair(t, "")
+	q := `db sql.cached "SELECT count(*) AS n FROM t"`
+
+	if n := count(t, ctx, q); n != 3 {
+		t.Fatalf("sql.cached: expected 3, got %d", n)
+	}
+	// Changes through another connection are not seen until invalidated.
+	eval(t, ctx, `other sql.exec "INSERT INTO t VALUES (4)"`)
+	if n := count(t, ctx, q); n != 3 {
+		t.Fatalf("cached result: expected 3, got %d", n)
+	}
+	if n := count(t, ctx, `db sql.q "SELECT count(*) AS n FROM t"`); n != 4 {
+		t.Fatalf("sql.q without Cache: expected 4, got %d", n)
+	}
+	if n := mustI(t, eval(t, ctx, `sql.invalidate db`)); n != 1 {
+		t.Fatalf("sql.invalidate: expected 1 result dropped, got %d", n)
+	}
+	if n := count(t, ctx, q); n != 4 {
+		t.Fatalf("after sql.invalidate: expected 4, got %d", n)
+	}
+
+	// sql.exec on the connection drops cached results.
+	eval(t, ctx, `db sql.exec "DELETE FROM t WHERE id = 4"`)
+	if n := count(t, ctx, q); n != 3 {
+		t.Fatalf("after sql.exec: expected 3, got %d", n)
+	}
+	// So does a commit.
+	eval(t, ctx, `sql.tx[db;{[tx] tx sql.exec "DELETE FROM t WHERE id = 3"}]`)
+	if n := count(t, ctx, q); n != 2 {
+		t.Fatalf("after commit: expected 2, got %d", n)
+	}
+}
+
+func TestCachedParams(t *testing.T) {
+	ctx := openPair(t, "")
+	q := `sql.cached[db;"SELECT count(*) AS n FROM t WHERE id > ?";,%s]`
+
+	for _, tt := range []struct {
+		arg  string
+		want int64
+	}{{"0", 3}, {"1", 2}, {`"1"`, 2}, {"0", 3}} {
+		if n := count(t, ctx, strings.Replace(q, "%s", tt.arg, 1)); n != tt.want {
+			t.Errorf("id > %s: expected %d, got %d", tt.arg, tt.want, n)
+		}
+	}
+	// The integer 1 and the string "1" are cached apart.
+	if n := mustI(t, eval(t, ctx, `sql.invalidate db`)); n != 3 {
+		t.Fatalf("sql.invalidate: expected 3 results dropped, got %d", n)
+	}
+}
+
+func TestCacheOption(t *testing.T) {
+	ctx := openPair(t, "..[Cache:1]")
+
+	if n := count(t, ctx, `db sql.q "SELECT count(*) AS n FROM t"`); n != 3 {
+		t.Fatalf("sql.q: expected 3, got %d", n)
+	}
+	eval(t, ctx, `other sql.exec "INSERT INTO t VALUES (4)"`)
+	if n := count(t, ctx, `db sql.q "SELECT count(*) AS n FROM t"`); n != 3 {
+		t.Fatalf("sql.q with Cache: expected the cached 3, got %d", n)
+	}
+	if n := count(t, ctx, `sql.q[db;"SELECT count(*) AS n FROM t";();..[Cache:0]]`); n != 4 {
+		t.Fatalf("sql.q with ..[Cache:0]: expected 4, got %d", n)
+	}
+	if got := eval(t, ctx, `db`).Sprint(ctx, false); !strings.Contains(got, "Cache=1") {
+		t.Errorf("printed sql.conn: expected Cache=1, got %s", got)
+	}
+}
+
+func TestCacheWrites(t *testing.T) {
+	ctx := openPair(t, "..[Cache:1]")
+	q := `db sql.q "SELECT count(*) AS n FROM t"`
+	count(t, ctx, q)
+
+	// Writing queries run every time and drop cached results.
+	for i := range 2 {
+		v := eval(t, ctx, `db sql.q "INSERT INTO t VALUES (5) RETURNING id"`)
+		if got := dictLookup(t, ctx, mustDict(t, ctx, v), "id").Sprint(ctx, true); got != ",5" {
+			t.Fatalf("INSERT … RETURNING %d: expected ,5, got %s", i, got)
+		}
+	}
+	if n := count(t, ctx, q); n != 5 {
+		t.Fatalf("after INSERT … RETURNING: expected 5, got %d", n)
+	}
+	eval(t, ctx, `sql.fetch[db sql.cursor "DELETE FROM t WHERE id = 5 RETURNING id";10]`)
+	if n := count(t, ctx, q); n != 3 {
+		t.Fatalf("after a DELETE cursor: expected 3, got %d", n)
+	}
+
+	// Registering a function again drops results computed with the old one.
+	eval(t, ctx, `sql.func[db;"cache_twice";{2*x}]`)
+	if n := count(t, ctx, `db sql.q "SELECT cache_twice(1) AS n"`); n != 2 {
+		t.Fatalf("cache_twice(1): expected 2, got %d", n)
+	}
+	eval(t, ctx, `sql.func[db;"cache_twice";{3*x}]`)
+	if n := count(t, ctx, `db sql.q "SELECT cache_twice(1) AS n"`); n != 3 {
+		t.Fatalf("cache_twice(1) after sql.func: expected 3, got %d", n)
+	}
+	eval(t, ctx, `sql.close db`)
+}
+
+func TestCacheLimits(t *testing.T) {
+	t.Run("size", func(t *testing.T) {
+		ctx := openPair(t, "..[CacheSize:1]")
+		eval(t, ctx, `db sql.cached "SELECT count(*) AS n FROM t"`)
+		eval(t, ctx, `db sql.cached "SELECT max(id) AS n FROM t"`)
+		if n := mustI(t, eval(t, ctx, `sql.invalidate db`)); n != 1 {
+			t.Fatalf("CacheSize:1: expected 1 cached result, got %d", n)
+		}
+	})
+
+	t.Run("ttl", func(t *testing.T) {
+		ctx := openPair(t, "..[CacheTTLMilli:20]")
+		q := `db sql.cached "SELECT count(*) AS n FROM t"`
+		count(t, ctx, q)
+		eval(t, ctx, `other sql.exec "INSERT INTO t VALUES (4)"`)
+		time.Sleep(40 * time.Millisecond)
+		if n := count(t, ctx, q); n != 4 {
+			t.Fatalf("expired result: expected 4, got %d", n)
+		}
+	})
+}
+
+func TestCachedErrors(t *testing.T) {
+	ctx := openPair(t, "")
+
+	for _, tt := range []struct{ src, want string }{
+		{`sql.tx[db;{[tx] tx sql.cached "SELECT 1"}]`, "expected sql.conn"},
+		{`sql.exec[db;"DELETE FROM t";();..[Cache:1]]`, "only applies to sql.q"},
+		{`sql.open["sqlite://:memory:";..[CacheSize:"x"]]`, "CacheSize"},
+		{`sql.invalidate 1`, "expected sql.conn"},
+	} {
+		if msg := evalPanic(t, ctx, tt.src); !strings.Contains(msg, tt.want) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.src, tt.want, msg)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package sql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ---------------------------------------------------------------------------
+// Cancellation and timeouts
+// ---------------------------------------------------------------------------
+
+// running holds the cancel functions of the database calls in progress, so
+// that Interrupt can stop them from another goroutine.
+var running = struct { //nolint:gochecknoglobals // process-wide: a signal interrupts whatever is running
+	sync.Mutex
+	next    int
+	cancels map[int]context.CancelFunc
+}{cancels: map[int]context.CancelFunc{}}
+
+// track registers cancel as belonging to a call in progress and returns the
+// function that unregisters it.
+func track(cancel context.CancelFunc) func() {
+	running.Lock()
+	id := running.next
+	running.next++
+	running.cancels[id] = cancel
+	running.Unlock()
+	return func() {
+		running.Lock()
+		delete(running.cancels, id)
+		running.Unlock()
+	}
+}
+
+// callContext returns the context of one database call, bounded by timeout
+// when positive, and the function that releases it once the call returns.
+func callContext(timeout time.Duration) (context.Context, func()) {
+	ctx, cancel := newContext(timeout)
+	untrack := track(cancel)
+	return ctx, func() {
+		untrack()
+		cancel()
+	}
+}
+
+// newContext returns a cancellable context, bounded by timeout when
+// positive.
+func newContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// callErr explains err when it was caused by ctx ending: the call ran out
+// of time or was interrupted.
+func callErr(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("timeout exceeded: %w", err)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("interrupted: %w", err)
+	}
+	return err
+}
+
+// Interrupt cancels every database call in progress and reports whether
+// there was any. The interrupted verbs return a Goal error. It is safe to
+// call from any goroutine, e.g. a SIGINT handler while the interpreter is
+// blocked in a long query: cmd/ari calls it on Ctrl-C.
+func Interrupt() bool {
+	running.Lock()
+	defer running.Unlock()
+	for _, cancel := range running.cancels {
+		cancel()
+	}
+	return len(running.cancels) > 0
+}
@@ -0,0 +1,96 @@
+package sql_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+
+	goalsql "github.com/semperos/ari/sql"
+)
+
+// Queries that run until cancelled.
+const (
+	sqliteEndless = `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x+1 FROM c) SELECT count(*) FROM c`
+	duckdbEndless = `SELECT count(*) FROM range(1000000000) a, range(1000000) b WHERE a.range + b.range < 0`
+)
+
+// ---------------------------------------------------------------------------
+// TestTimeout
+// ---------------------------------------------------------------------------
+
+func TestTimeout(t *testing.T) {
+	for _, tt := range []struct{ uri, endless string }{
+		{"sqlite://:memory:", sqliteEndless},
+		{"duckdb://", duckdbEndless},
+	} {
+		ctx := newCtx(t)
+		ctx.AssignGlobal("endless", goal.NewS(tt.endless))
+
+		// Per-call option.
+		ctx.AssignGlobal("db", eval(t, ctx, `sql.open["`+tt.uri+`"]`))
+		msg := evalPanic(t, ctx, `sql.q[db;endless;();..[TimeoutMilli:50]]`)
+		if !strings.Contains(msg, "timeout exceeded") {
+			t.Errorf("%s: expected timeout error, got %s", tt.uri, msg)
+		}
+		// The connection is still usable afterwards.
+		if n := mustI(t, eval(t, ctx, `*sql.q[db;"SELECT 1 AS n"]"n"`)); n != 1 {
+			t.Errorf("%s: expected 1 after timeout, got %d", tt.uri, n)
+		}
+
+		// Connection default, overridden per call.
+		ctx.AssignGlobal("db", eval(t, ctx, `sql.open["`+tt.uri+`";..[TimeoutMilli:50]]`))
+		evalPanic(t, ctx, `db sql.q endless`)
+		evalPanic(t, ctx, `sql.exec[db;endless;();..[TimeoutMilli:60]]`)
+		eval(t, ctx, `sql.q[db;"SELECT 1 AS n";();..[TimeoutMilli:0]]`)
+	}
+}
+
+func TestTimeoutOptionErrors(t *testing.T) {
+	ctx := newCtx(t)
+	evalPanic(t, ctx, `sql.open["sqlite://:memory:";..[TimeoutMilli:-1]]`)
+	evalPanic(t, ctx, `sql.open["sqlite://:memory:";..[TimeoutMilli:"1s"]]`)
+	evalPanic(t, ctx, `sql.open["sqlite://:memory:";..[Timeout:1]]`)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	evalPanic(t, ctx, `sql.q[db;"SELECT 1";();..[TimeoutMilli:1.5]]`)
+}
+
+// interruptNext interrupts the next database call found running, from another
+// goroutine as a signal handler would.
+func interruptNext() {
+	go func() {
+		for !goalsql.Interrupt() {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+}
+
+// ---------------------------------------------------------------------------
+// TestInterrupt
+// ---------------------------------------------------------------------------
+
+func TestInterrupt(t *testing.T) {
+	if goalsql.Interrupt() {
+		t.Fatal("Interrupt: expected false with no query running")
+	}
+	for _, tt := range []struct{ uri, endless string }{
+		{"sqlite://:memory:", sqliteEndless},
+		{"duckdb://", duckdbEndless},
+	} {
+		ctx := newCtx(t)
+		ctx.AssignGlobal("db", eval(t, ctx, `sql.open["`+tt.uri+`"]`))
+		ctx.AssignGlobal("endless", goal.NewS(tt.endless))
+
+		interruptNext()
+		msg := evalPanic(t, ctx, `db sql.q endless`)
+		if !strings.Contains(msg, "interrupted") {
+			t.Errorf("%s: expected interrupted error, got %s", tt.uri, msg)
+		}
+
+		// Cursors are interruptible while opening (DuckDB runs the query
+		// then) and while fetching (SQLite).
+		interruptNext()
+		evalPanic(t, ctx, `(db sql.cursor endless) sql.fetch 1`)
+	}
+}
@@ -0,0 +1,227 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"fmt"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// BV wrapper: sql.cursor
+// ---------------------------------------------------------------------------
+
+// Cursor wraps an open *sql.Rows as a Goal boxed value (sql.cursor). Rows are
+// pulled from the database in batches by sql.fetch and sql.each, so a result
+// set never has to fit in memory at once.
+type Cursor struct {
+	rows     *stdsql.Rows
+	cols     []string
+	colTypes []*stdsql.ColumnType
+	opts     queryOptions
+	ctx      context.Context // context of the query; ends with the cursor
+	cancel   context.CancelFunc
+	conn     *Conn // connection counting the rows fetched (sql.stats)
+	done     bool
+}
+
+func (cur *Cursor) Append(_ *goal.Context, dst []byte, _ bool) []byte {
+	state := "open"
+	if cur.done {
+		state = "done"
+	}
+	return append(dst, fmt.Sprintf("sql.cursor[%s]", state)...)
+}
+func (cur *Cursor) Matches(y goal.BV) bool { yv, ok := y.(*Cursor); return ok && cur == yv }
+func (cur *Cursor) Type() string           { return "sql.cursor" }
+
+// close releases the underlying rows. It is safe to call more than once,
+// and from the cleanup of a sql.rows value.
+func (cur *Cursor) close() error {
+	c := cur.conn
+	c.cursorsMu.Lock()
+	defer c.cursorsMu.Unlock()
+	if cur.done {
+		return nil
+	}
+	cur.done = true
+	delete(c.cursors, cur)
+	defer cur.cancel()
+	return cur.rows.Close()
+}
+
+// fetch returns the next batch of up to n rows as a QueryResult dict, along
+// with the number of rows in it. Once the cursor is exhausted it is closed
+// and every further fetch returns a zero-row dict with the same columns.
+//
+// The cursor's query can be interrupted only while fetch runs; its time
+// limit (TimeoutMilli) applies to the whole life of the cursor.
+func (cur *Cursor) fetch(n int) (goal.V, int, error) {
+	if cur.done {
+		return emptyResult(cur.cols, cur.colTypes, cur.opts), 0, nil
+	}
+	untrack := track(cur.cancel)
+	result, count, err := scanBatch(cur.rows, cur.cols, cur.colTypes, n, cur.opts)
+	untrack()
+	cur.conn.fetched(count)
+	if err != nil {
+		err = callErr(cur.ctx, err)
+		_ = cur.close()
+		return goal.V{}, 0, err
+	}
+	if count < n {
+		if err := cur.close(); err != nil {
+			return goal.V{}, 0, err
+		}
+	}
+	return result, count, nil
+}
+
+// emptyResult returns a zero-row QueryResult dict for the given columns.
+func emptyResult(cols []string, colTypes []*stdsql.ColumnType, opts queryOptions) goal.V {
+	return buildResult(cols, colTypes, make([][]any, len(cols)), opts)
+}
+
+// ---------------------------------------------------------------------------
+// sql.cursor  (dyad: conn sql.cursor "query"  or  sql.cursor[conn;"query";args])
+// ---------------------------------------------------------------------------
+
+// vfCursor executes a query and returns a sql.cursor over its result rows
+// without scanning them, so that sql.fetch and sql.each process large
+// results in batches of the sql.q shape. Once the rows are exhausted the
+// cursor closes itself; sql.close cur releases it early. The TimeoutMilli
+// option bounds its whole life.
+//
+// Usage:
+//
+//	cur: db sql.cursor "SELECT * FROM events"
+//	cur: sql.cursor[db;"SELECT * FROM events WHERE day=?";,"2024-01-02"]
+//
+// conn accepts either sql.conn or sql.tx.
+func vfCursor(_ *goal.Context, args []goal.V) goal.V {
+	call, err := parseConnQueryArgs("sql.cursor", args)
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	query, sqlArgs, err := call.bind()
+	if err != nil {
+		return goal.Panicf("sql.cursor: %v", err)
+	}
+
+	ctx, cancel := newContext(call.timeout)
+	untrack := track(cancel)
+	defer untrack()
+	start := time.Now()
+	rows, err := call.conn.QueryContext(ctx, query, sqlArgs...)
+	call.db.observe(stmtEvent{verb: "sql.cursor", query: query, args: sqlArgs, rows: -1, elapsed: time.Since(start), err: err})
+	if !readOnlyQuery(call.query, call.scheme.script) {
+		call.db.invalidateCache()
+	}
+	if err != nil {
+		cancel()
+		return goal.Panicf("sql.cursor %q: %v", call.query, callErr(ctx, err))
+	}
+	cols, colTypes, err := rowsColumns(rows)
+	if err != nil {
+		rows.Close()
+		cancel()
+		return goal.Panicf("sql.cursor %q: %v", call.query, callErr(ctx, err))
+	}
+	cur := &Cursor{rows: rows, cols: cols, colTypes: colTypes, opts: call.opts, ctx: ctx, cancel: cancel, conn: call.db}
+	call.db.addCursor(cur)
+	return goal.NewV(cur)
+}
+
+// ---------------------------------------------------------------------------
+// sql.fetch  (dyad: cur sql.fetch n)
+// ---------------------------------------------------------------------------
+
+// vfFetch returns the next n rows of a cursor as a columnar dict. Fewer than
+// n rows are returned at the end of the result set, and zero rows once the
+// cursor is exhausted.
+//
+// Usage:
+//
+//	t: cur sql.fetch 10000
+func vfFetch(_ *goal.Context, args []goal.V) goal.V {
+	if len(args) != 2 {
+		return goal.Panicf("cur sql.fetch n : expected 2 arguments, got %d", len(args))
+	}
+	cur, ok := args[1].BV().(*Cursor)
+	if !ok {
+		return goal.Panicf("cur sql.fetch n : expected sql.cursor in left arg, got %q", args[1].Type())
+	}
+	n, err := batchSize("cur sql.fetch n", args[0])
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	result, _, err := cur.fetch(n)
+	if err != nil {
+		return goal.Panicf("cur sql.fetch n : %v", err)
+	}
+	return result
+}
+
+// ---------------------------------------------------------------------------
+// sql.each  (triad: sql.each[cur;n;f])
+// ---------------------------------------------------------------------------
+
+// vfEach applies f to successive batches of up to n rows from a cursor and
+// returns the list of results, one per batch. The cursor is exhausted (and
+// closed) afterwards. If f returns an error, the cursor is closed and the
+// error is returned.
+//
+// Usage:
+//
+//	counts: sql.each[cur;10000;{#x"id"}]
+//	total: +/sql.each[cur;10000;{+/x"amount"}]
+func vfEach(ctx *goal.Context, args []goal.V) goal.V {
+	if len(args) != 3 {
+		return goal.Panicf("sql.each[cur;n;f] : expected 3 arguments, got %d", len(args))
+	}
+	// args[0] = f, args[1] = n, args[2] = cur
+	fn := args[0]
+	if !fn.IsFunction() {
+		return goal.Panicf("sql.each[cur;n;f] : expected function as third argument, got %q", fn.Type())
+	}
+	cur, ok := args[2].BV().(*Cursor)
+	if !ok {
+		return goal.Panicf("sql.each[cur;n;f] : expected sql.cursor as first argument, got %q", args[2].Type())
+	}
+	n, err := batchSize("sql.each[cur;n;f]", args[1])
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+
+	results := []goal.V{}
+	for !cur.done {
+		batch, count, err := cur.fetch(n)
+		if err != nil {
+			return goal.Panicf("sql.each[cur;n;f] : %v", err)
+		}
+		if count == 0 {
+			// The final fetch only discovered the end of the rows.
+			break
+		}
+		r := fn.ApplyAt(ctx, batch)
+		if r.IsPanic() {
+			_ = cur.close()
+			return r
+		}
+		results = append(results, r)
+	}
+	return goal.NewAV(results)
+}
+
+// batchSize validates a positive integer batch size argument.
+func batchSize(verb string, x goal.V) (int, error) {
+	if !x.IsI() {
+		return 0, fmt.Errorf("%s : expected integer batch size, got %q", verb, x.Type())
+	}
+	if x.I() <= 0 {
+		return 0, fmt.Errorf("%s : batch size must be positive, got %d", verb, x.I())
+	}
+	return int(x.I()), nil
+}
@@ -0,0 +1,140 @@
+package sql_test
+
+import (
+	"testing"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// fetchIDs fetches the next n rows of cur and returns the id column.
+func fetchIDs(t *testing.T, ctx *goal.Context, n string) []int64 {
+	t.Helper()
+	v := eval(t, ctx, `sql.fetch[cur;`+n+`]`)
+	idCol := dictLookup(t, ctx, mustDict(t, ctx, v), "id")
+	ids, ok := idCol.BV().(*goal.AI)
+	if !ok {
+		t.Fatalf("id column: expected AI, got %q", idCol.Type())
+	}
+	return ids.Slice
+}
+
+// ---------------------------------------------------------------------------
+// TestCursorFetch
+// ---------------------------------------------------------------------------
+
+func TestCursorFetch(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT))
+
+	cur := eval(t, ctx, `sql.cursor[db;"SELECT id, name FROM t ORDER BY id"]`)
+	if cur.Type() != "sql.cursor" {
+		t.Fatalf("sql.cursor: expected sql.cursor, got %q", cur.Type())
+	}
+	ctx.AssignGlobal("cur", cur)
+
+	want := [][]int64{{1, 2}, {3, 4}, {5}, {}, {}}
+	for i, w := range want {
+		got := fetchIDs(t, ctx, "2")
+		if len(got) != len(w) {
+			t.Fatalf("fetch #%d: expected %v, got %v", i, w, got)
+		}
+		for j := range w {
+			if got[j] != w[j] {
+				t.Fatalf("fetch #%d: expected %v, got %v", i, w, got)
+			}
+		}
+	}
+}
+
+func TestCursorParams(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT))
+	ctx.AssignGlobal("cur", eval(t, ctx, `sql.cursor[db;"SELECT id FROM t WHERE id > ? ORDER BY id";,3]`))
+
+	got := fetchIDs(t, ctx, "10")
+	if len(got) != 2 || got[0] != 4 || got[1] != 5 {
+		t.Fatalf("parameterised cursor: expected [4 5], got %v", got)
+	}
+}
+
+func TestCursorBadBatchSize(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT))
+	ctx.AssignGlobal("cur", eval(t, ctx, `sql.cursor[db;"SELECT id FROM t"]`))
+
+	evalPanic(t, ctx, `sql.fetch[cur;0]`)
+	evalPanic(t, ctx, `sql.fetch[cur;"2"]`)
+	evalPanic(t, ctx, `sql.fetch[db;2]`)
+}
+
+// ---------------------------------------------------------------------------
+// TestCursorEach
+// ---------------------------------------------------------------------------
+
+func TestCursorEach(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT))
+
+	t.Run("sum_of_batches", func(t *testing.T) {
+		ctx.AssignGlobal("cur", eval(t, ctx, `sql.cursor[db;"SELECT id FROM t"]`))
+		v := eval(t, ctx, `+/sql.each[cur;2;{+/x"id"}]`)
+		if mustI(t, v) != 15 {
+			t.Fatalf("sum over batches: expected 15, got %v", v.Sprint(ctx, true))
+		}
+	})
+
+	t.Run("batch_count", func(t *testing.T) {
+		ctx.AssignGlobal("cur", eval(t, ctx, `sql.cursor[db;"SELECT id FROM t"]`))
+		v := eval(t, ctx, `#sql.each[cur;2;{#x"id"}]`)
+		if mustI(t, v) != 3 {
+			t.Fatalf("batch count: expected 3, got %v", v.Sprint(ctx, true))
+		}
+	})
+
+	t.Run("exact_multiple", func(t *testing.T) {
+		// 5 rows in batches of 5: the trailing empty batch is not passed to f.
+		ctx.AssignGlobal("cur", eval(t, ctx, `sql.cursor[db;"SELECT id FROM t"]`))
+		v := eval(t, ctx, `#sql.each[cur;5;{#x"id"}]`)
+		if mustI(t, v) != 1 {
+			t.Fatalf("batch count: expected 1, got %v", v.Sprint(ctx, true))
+		}
+	})
+
+	t.Run("error_in_f", func(t *testing.T) {
+		ctx.AssignGlobal("cur", eval(t, ctx, `sql.cursor[db;"SELECT id FROM t"]`))
+		evalPanic(t, ctx, `sql.each[cur;2;{panic "boom"}]`)
+		// The cursor is closed after an error from f.
+		if got := fetchIDs(t, ctx, "2"); len(got) != 0 {
+			t.Fatalf("fetch after error: expected no rows, got %v", got)
+		}
+	})
+}
+
+// ---------------------------------------------------------------------------
+// TestCursorClose
+// ---------------------------------------------------------------------------
+
+func TestCursorClose(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT))
+	ctx.AssignGlobal("cur", eval(t, ctx, `sql.cursor[db;"SELECT id FROM t"]`))
+
+	fetchIDs(t, ctx, "1")
+	if mustI(t, eval(t, ctx, "sql.close[cur]")) != 1 {
+		t.Fatal("sql.close cur: expected 1")
+	}
+	if got := fetchIDs(t, ctx, "2"); len(got) != 0 {
+		t.Fatalf("fetch after close: expected no rows, got %v", got)
+	}
+}
+
+func TestDuckDBCursor(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	ctx.AssignGlobal("cur", eval(t, ctx, `sql.cursor[db;"SELECT range AS id FROM range(10)"]`))
+
+	v := eval(t, ctx, `+/sql.each[cur;3;{+/x"id"}]`)
+	if mustI(t, v) != 45 {
+		t.Fatalf("duckdb cursor: expected 45, got %v", v.Sprint(ctx, true))
+	}
+}
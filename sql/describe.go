@@ -0,0 +1,101 @@
+package sql
+
+import (
+	stdsql "database/sql"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// sql.describe  (dyad: conn sql.describe "query"  or  sql.describe[conn;"query";args])
+// ---------------------------------------------------------------------------
+
+// vfDescribe returns the column metadata of a query's result set as a
+// columnar dict with one row per result column:
+//
+//	"name"       – column name (S)
+//	"type"       – database type name, e.g. "INTEGER", "VARCHAR" (S)
+//	"nullable"   – 1 if the column may hold NULL, 0 if not
+//	"length"     – length of variable-length types such as VARCHAR(n)
+//	"precision"  – precision of DECIMAL/NUMERIC columns
+//	"scale"      – scale of DECIMAL/NUMERIC columns
+//
+// Values the driver does not report are 0n. The query is executed, but no
+// rows are scanned.
+//
+// Usage:
+//
+//	d: db sql.describe "SELECT * FROM users"
+//	d: sql.describe[db;"SELECT * FROM users WHERE id=?";,1]
+//
+// conn accepts either sql.conn or sql.tx.
+func vfDescribe(_ *goal.Context, args []goal.V) goal.V {
+	call, err := parseConnQueryArgs("sql.describe", args)
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	query, sqlArgs, err := call.bind()
+	if err != nil {
+		return goal.Panicf("sql.describe: %v", err)
+	}
+
+	ctx, done := call.context()
+	defer done()
+	start := time.Now()
+	rows, err := call.conn.QueryContext(ctx, query, sqlArgs...)
+	call.db.observe(stmtEvent{verb: "sql.describe", query: query, args: sqlArgs, elapsed: time.Since(start), err: err})
+	if err != nil {
+		return goal.Panicf("sql.describe %q: %v", call.query, callErr(ctx, err))
+	}
+	defer rows.Close()
+
+	cols, colTypes, err := rowsColumns(rows)
+	if err != nil {
+		return goal.Panicf("sql.describe %q: %v", call.query, err)
+	}
+	return describeColumns(cols, colTypes)
+}
+
+// describeColumns builds the sql.describe table for a result set.
+func describeColumns(cols []string, colTypes []*stdsql.ColumnType) goal.V {
+	n := len(cols)
+	types := make([]string, n)
+	nullable := make([]any, n)
+	length := make([]any, n)
+	precision := make([]any, n)
+	scale := make([]any, n)
+	for i, ct := range colTypes {
+		types[i] = ct.DatabaseTypeName()
+		if null, ok := ct.Nullable(); ok {
+			nullable[i] = null
+		}
+		if l, ok := ct.Length(); ok {
+			length[i] = l
+		}
+		if p, s, ok := ct.DecimalSize(); ok {
+			precision[i] = p
+			scale[i] = s
+		}
+	}
+
+	keys := goal.NewAS([]string{"name", "type", "nullable", "length", "precision", "scale"})
+	vals := goal.NewAV([]goal.V{
+		goal.NewAS(append([]string(nil), cols...)),
+		goal.NewAS(types),
+		describeColumn(nullable),
+		describeColumn(length),
+		describeColumn(precision),
+		describeColumn(scale),
+	})
+	return goal.NewD(keys, vals)
+}
+
+// describeColumn builds a metadata column; an empty result set yields an
+// empty integer array rather than a generic one.
+func describeColumn(raw []any) goal.V {
+	if len(raw) == 0 {
+		return goal.NewAI([]int64{})
+	}
+	return buildColumn(raw, nullFill{})
+}
@@ -0,0 +1,73 @@
+package sql_test
+
+import (
+	"testing"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// describeStrings returns a string column of a sql.describe result.
+func describeStrings(t *testing.T, ctx *goal.Context, d *goal.D, key string) []string {
+	t.Helper()
+	col := dictLookup(t, ctx, d, key)
+	as, ok := col.BV().(*goal.AS)
+	if !ok {
+		t.Fatalf("%s column: expected AS, got %q", key, col.Type())
+	}
+	return as.Slice
+}
+
+// ---------------------------------------------------------------------------
+// TestDescribe
+// ---------------------------------------------------------------------------
+
+func TestDescribe(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE users (id INTEGER NOT NULL, name TEXT, score REAL)"]`)
+
+	d := mustDict(t, ctx, eval(t, ctx, `db sql.describe "SELECT id, name, score FROM users"`))
+	names := describeStrings(t, ctx, d, "name")
+	types := describeStrings(t, ctx, d, "type")
+	wantNames := []string{"id", "name", "score"}
+	wantTypes := []string{"INTEGER", "TEXT", "REAL"}
+	if len(names) != len(wantNames) {
+		t.Fatalf("name column: expected %v, got %v", wantNames, names)
+	}
+	for i := range wantNames {
+		if names[i] != wantNames[i] || types[i] != wantTypes[i] {
+			t.Errorf("column %d: expected %s %s, got %s %s", i, wantNames[i], wantTypes[i], names[i], types[i])
+		}
+	}
+	for _, key := range []string{"nullable", "length", "precision", "scale"} {
+		if n := mustI(t, eval(t, ctx, `#(db sql.describe "SELECT id, name, score FROM users")"`+key+`"`)); n != 3 {
+			t.Errorf("%s column: expected 3 rows, got %d", key, n)
+		}
+	}
+}
+
+func TestDescribeParams(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id INTEGER)"]`)
+
+	d := mustDict(t, ctx, eval(t, ctx, `sql.describe[db;"SELECT id FROM t WHERE id > ?";,1]`))
+	if names := describeStrings(t, ctx, d, "name"); len(names) != 1 || names[0] != "id" {
+		t.Fatalf("name column: expected [id], got %v", names)
+	}
+
+	evalPanic(t, ctx, `db sql.describe "SELECT * FROM missing"`)
+	evalPanic(t, ctx, `1 sql.describe "SELECT 1"`)
+}
+
+func TestDuckDBDescribe(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id BIGINT, price DECIMAL(10,2), label VARCHAR)"]`)
+
+	d := mustDict(t, ctx, eval(t, ctx, `db sql.describe "SELECT * FROM t"`))
+	types := describeStrings(t, ctx, d, "type")
+	if len(types) != 3 || types[0] != "BIGINT" || types[2] != "VARCHAR" {
+		t.Fatalf("type column: expected [BIGINT DECIMAL(10,2) VARCHAR], got %v", types)
+	}
+}
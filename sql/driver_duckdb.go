@@ -9,4 +9,427 @@
 
 package sql
 
-import _ "github.com/marcboeker/go-duckdb" // registers the duckdb driver via its init() function
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+	"github.com/marcboeker/go-duckdb" // also registers the duckdb driver via its init() function
+)
+
+// duckdbScheme describes the "duckdb" URI scheme.
+var duckdbScheme = driverScheme{ //nolint:gochecknoglobals // registry entry initialised once at startup
+	driverName:   "duckdb",
+	nestedParams: true,
+	script:       scriptSyntax{dollarQuotes: true},
+	tablesSQL: `SELECT table_schema AS schema, table_name AS name,
+			CASE table_type WHEN 'VIEW' THEN 'view' ELSE 'table' END AS type
+		FROM information_schema.tables
+		WHERE table_schema NOT IN ('information_schema', 'pg_catalog')
+		ORDER BY table_schema, table_name`,
+	columnsSQL: `SELECT c.column_name AS name, c.data_type AS type,
+			(c.is_nullable = 'YES')::INTEGER AS nullable, c.column_default AS "default",
+			(EXISTS (SELECT 1 FROM duckdb_constraints() k
+				WHERE k.schema_name = c.table_schema AND k.table_name = c.table_name
+				AND k.constraint_type = 'PRIMARY KEY'
+				AND list_contains(k.constraint_column_names, c.column_name)))::INTEGER AS pk
+		FROM information_schema.columns c
+		WHERE c.table_name = ? AND c.table_schema = ?
+		ORDER BY c.ordinal_position`,
+	indexesSQL: `SELECT index_name AS name, is_unique::INTEGER AS "unique", is_primary::INTEGER AS "primary",
+			trim(CAST(expressions AS VARCHAR), '[]') AS columns
+		FROM duckdb_indexes()
+		WHERE table_name = ? AND schema_name = ?
+		ORDER BY index_name`,
+	settingsOption: "Settings",
+	withSettings:   duckdbSettings,
+	settingSQL:     func(name string) string { return "SELECT current_setting('" + name + "')" },
+	readFile:       duckdbReadFile,
+	writeFile:      duckdbWriteFile,
+	appendRows:     duckdbAppend,
+	queryArrow:     duckdbQueryArrow,
+	loadTable:      duckdbLoadArrow,
+	registerFunc:   duckdbRegisterFunc,
+	explain:        duckdbExplain,
+	explainRuns:    true,
+}
+
+// duckdbSettings adds configuration options to a DSN as query parameters,
+// which the driver sets when opening the database.
+func duckdbSettings(dsn string, settings []setting) (string, error) {
+	params := url.Values{}
+	for _, st := range settings {
+		params.Set(st.name, st.value)
+	}
+	return withQuery(dsn, params), nil
+}
+
+// duckdbReadFile creates a table from a CSV, JSON or Parquet file with
+// DuckDB's table functions, which detect the column types.
+func duckdbReadFile(ctx context.Context, q querier, path string, opts fileOptions) error {
+	var src string
+	switch opts.format {
+	case formatCSV:
+		src = fmt.Sprintf("read_csv(%s, header = %t, delim = %s)", quoteString(path), opts.header, quoteString(opts.delim))
+	case formatJSON:
+		src = "read_json_auto(" + quoteString(path) + ")"
+	case formatParquet:
+		src = "read_parquet(" + quoteString(path) + ")"
+	}
+	create := "CREATE TABLE "
+	if opts.replace {
+		create = "CREATE OR REPLACE TABLE "
+	}
+	_, err := q.ExecContext(ctx, create+quoteIdent(opts.table)+" AS SELECT * FROM "+src)
+	return err
+}
+
+// duckdbWriteFile writes the result of query to a file with COPY … TO,
+// which compresses it when the path ends with .gz.
+func duckdbWriteFile(ctx context.Context, q querier, query, path string, opts fileOptions) (int64, error) {
+	format := "FORMAT " + opts.format
+	if opts.format == formatCSV {
+		format += fmt.Sprintf(", HEADER %t, DELIMITER %s", opts.header, quoteString(opts.delim))
+	}
+	res, err := q.ExecContext(ctx, fmt.Sprintf("COPY (%s) TO %s (%s)", query, quoteString(path), format))
+	if err != nil {
+		return 0, err
+	}
+	var sum execSummary
+	sum.add(res)
+	return sum.rowsAffected, nil
+}
+
+// duckdbAppend bulk-loads nrows rows from cols into table on conn using the
+// DuckDB Appender API. cols must match the table's columns in order. The
+// rows are appended in a transaction, so that a failing row leaves none
+// inserted.
+func duckdbAppend(ctx context.Context, conn *stdsql.Conn, table string, cols []goal.V, nrows int) error {
+	schema := ""
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		schema, table = table[:i], table[i+1:]
+	}
+	if _, err := conn.ExecContext(ctx, "BEGIN TRANSACTION"); err != nil {
+		return err
+	}
+	err := duckdbAppendConn(ctx, conn, schema, table, cols, nrows)
+	if err == nil {
+		_, err = conn.ExecContext(ctx, "COMMIT")
+	}
+	if err != nil {
+		_, _ = conn.ExecContext(context.Background(), "ROLLBACK")
+		return err
+	}
+	return nil
+}
+
+// duckdbAppendConn appends the rows of cols to table on conn.
+func duckdbAppendConn(ctx context.Context, conn *stdsql.Conn, schema, table string, cols []goal.V, nrows int) error {
+	return conn.Raw(func(driverConn any) error {
+		dc, ok := driverConn.(driver.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection type %T", driverConn)
+		}
+		a, err := duckdb.NewAppenderFromConn(dc, schema, table)
+		if err != nil {
+			return err
+		}
+		row := make([]driver.Value, len(cols))
+		for i := range nrows {
+			if err := ctx.Err(); err != nil {
+				_ = a.Close()
+				return err
+			}
+			for j, col := range cols {
+				v, err := columnValue(col, i)
+				if err != nil {
+					_ = a.Close()
+					return fmt.Errorf("row %d: %w", i, err)
+				}
+				row[j] = duckdbAppendValue(v)
+			}
+			if err := a.AppendRow(row...); err != nil {
+				_ = a.Close()
+				return fmt.Errorf("row %d: %w", i, err)
+			}
+		}
+		return a.Close()
+	})
+}
+
+// duckdbAppendValue converts nested parameter values (see arrayArg and
+// dictArg) to the Go types the Appender takes for LIST, STRUCT and MAP
+// columns.
+func duckdbAppendValue(v any) any {
+	switch x := v.(type) {
+	case []any:
+		out := make([]any, len(x))
+		for i, el := range x {
+			out[i] = duckdbAppendValue(el)
+		}
+		return out
+	case structArg:
+		m := make(map[string]any, len(x.names))
+		for i, name := range x.names {
+			m[name] = duckdbAppendValue(x.vals[i])
+		}
+		return m
+	case mapArg:
+		m := make(duckdb.Map, len(x.keys))
+		for i, k := range x.keys {
+			m[k] = duckdbAppendValue(x.vals[i])
+		}
+		return m
+	}
+	return v
+}
+
+// duckdbValueToGoal converts the go-duckdb types of MAP, DECIMAL, INTERVAL
+// and UUID values, reporting false for other values. LIST and STRUCT values
+// are plain []any and map[string]any (see sqlValueToGoal).
+func duckdbValueToGoal(v any) (goal.V, bool) {
+	switch x := v.(type) {
+	case duckdb.Map:
+		return mapDict(x), true
+	case duckdb.Decimal:
+		return goal.NewF(x.Float64()), true
+	case duckdb.Interval:
+		keys := goal.NewAS([]string{"months", "days", "micros"})
+		return goal.NewD(keys, goal.NewAI([]int64{int64(x.Months), int64(x.Days), x.Micros})), true
+	case duckdb.UUID:
+		return goal.NewS(x.String()), true
+	}
+	return goal.V{}, false
+}
+
+// duckdbFuncTypes maps the SQL types sql.func accepts in its Args and
+// Returns options to DuckDB's primitive types. ANY is only valid in Args.
+var duckdbFuncTypes = map[string]duckdb.Type{ //nolint:gochecknoglobals // constant lookup table
+	"BOOLEAN":   duckdb.TYPE_BOOLEAN,
+	"TINYINT":   duckdb.TYPE_TINYINT,
+	"SMALLINT":  duckdb.TYPE_SMALLINT,
+	"INTEGER":   duckdb.TYPE_INTEGER,
+	"BIGINT":    duckdb.TYPE_BIGINT,
+	"UTINYINT":  duckdb.TYPE_UTINYINT,
+	"USMALLINT": duckdb.TYPE_USMALLINT,
+	"UINTEGER":  duckdb.TYPE_UINTEGER,
+	"UBIGINT":   duckdb.TYPE_UBIGINT,
+	"FLOAT":     duckdb.TYPE_FLOAT,
+	"DOUBLE":    duckdb.TYPE_DOUBLE,
+	"VARCHAR":   duckdb.TYPE_VARCHAR,
+	"BLOB":      duckdb.TYPE_BLOB,
+	"DATE":      duckdb.TYPE_DATE,
+	"TIMESTAMP": duckdb.TYPE_TIMESTAMP,
+	"ANY":       duckdb.TYPE_ANY,
+}
+
+// duckdbFuncType returns the DuckDB type information of a sql.func type.
+func duckdbFuncType(name string) (duckdb.TypeInfo, error) {
+	t, ok := duckdbFuncTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %q", name)
+	}
+	return duckdb.NewTypeInfo(t)
+}
+
+// duckdbScalarFunc adapts a Goal function to go-duckdb's ScalarFunc.
+type duckdbScalarFunc struct {
+	fn     *goalFunc
+	config duckdb.ScalarFuncConfig
+}
+
+func (f *duckdbScalarFunc) Config() duckdb.ScalarFuncConfig { return f.config }
+func (f *duckdbScalarFunc) Executor() duckdb.ScalarFuncExecutor {
+	return duckdb.ScalarFuncExecutor{RowExecutor: f.fn.call}
+}
+
+// duckdbRegisterFunc registers fn as a scalar UDF. Functions live in the
+// database's catalog, so one connection of the pool registers it for all.
+func duckdbRegisterFunc(ctx context.Context, c *Conn, fn *goalFunc) error {
+	if c.funcs[fn.name] == fn {
+		return nil // registered before; f was replaced in place
+	}
+	if fn.opts.returns == "" {
+		return errors.New(`sql option "Returns" is required by DuckDB`)
+	}
+	if fn.opts.returns == "ANY" {
+		return errors.New(`sql option "Returns" cannot be ANY`)
+	}
+	config := duckdb.ScalarFuncConfig{Volatile: fn.opts.volatile}
+	var err error
+	if config.ResultTypeInfo, err = duckdbFuncType(fn.opts.returns); err != nil {
+		return fmt.Errorf("sql option %q: %w", "Returns", err)
+	}
+	config.InputTypeInfos = make([]duckdb.TypeInfo, fn.nargs)
+	for i := range config.InputTypeInfos {
+		t := "ANY"
+		if fn.opts.argsSet {
+			t = fn.opts.args[i]
+		}
+		if config.InputTypeInfos[i], err = duckdbFuncType(t); err != nil {
+			return fmt.Errorf("sql option %q [%d]: %w", "Args", i, err)
+		}
+	}
+
+	conn, release, err := c.conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return duckdb.RegisterScalarUDF(conn, fn.name, &duckdbScalarFunc{fn: fn, config: config})
+}
+
+// duckdbExplain profiles a query with DuckDB's JSON profiler, as EXPLAIN
+// ANALYZE does, and reads the plan from the profile it writes. Profiling
+// settings belong to a connection, so one is held for the whole call.
+func duckdbExplain(ctx context.Context, q querier, query string, args []any) ([]planNode, error) {
+	f, err := os.CreateTemp("", "ari-explain-*.json")
+	if err != nil {
+		return nil, err
+	}
+	path := f.Name()
+	f.Close()
+	defer os.Remove(path)
+
+	if db, ok := q.(*stdsql.DB); ok {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+		q = conn
+	}
+	// The settings stay with the connection, which goes back to the pool
+	// (or serves the rest of the transaction): reset them even on error.
+	if _, err := q.ExecContext(ctx, "SET profiling_output = "+quoteString(path)); err != nil {
+		return nil, err
+	}
+	defer func() {
+		_, _ = q.ExecContext(context.Background(), "PRAGMA disable_profiling")
+		_, _ = q.ExecContext(context.Background(), "RESET profiling_output")
+	}()
+	if _, err := q.ExecContext(ctx, "SET enable_profiling = 'json'"); err != nil {
+		return nil, err
+	}
+	// Exec runs the query to completion, discarding its result.
+	if _, err := q.ExecContext(ctx, query, args...); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var root map[string]any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("reading the profile: %w", err)
+	}
+	var nodes []planNode
+	for _, child := range duckdbProfileChildren(root) {
+		nodes = duckdbPlanNodes(nodes, child, 0)
+	}
+	return nodes, nil
+}
+
+// duckdbPlanNodes appends a node of a JSON profile and its descendants to
+// nodes, numbering them in depth-first order. Key names differ across
+// DuckDB versions (e.g. operator_cardinality, formerly cardinality).
+func duckdbPlanNodes(nodes []planNode, n map[string]any, parent int64) []planNode {
+	nd := unknownPlanNode()
+	nd.id = int64(len(nodes) + 1)
+	nd.parent = parent
+	for _, key := range []string{"operator_type", "operator_name", "name"} {
+		if s, ok := n[key].(string); ok && strings.TrimSpace(s) != "" {
+			nd.operator = strings.TrimSpace(s)
+			break
+		}
+	}
+	for _, key := range []string{"operator_cardinality", "cardinality"} {
+		if x, ok := n[key].(float64); ok {
+			nd.actualRows = x
+			break
+		}
+	}
+	for _, key := range []string{"operator_timing", "timing"} {
+		if x, ok := n[key].(float64); ok {
+			nd.millis = x * float64(time.Second/time.Millisecond)
+			break
+		}
+	}
+	nd.detail, nd.estimatedRows = duckdbExtraInfo(n["extra_info"])
+	nodes = append(nodes, nd)
+	for _, child := range duckdbProfileChildren(n) {
+		nodes = duckdbPlanNodes(nodes, child, nd.id)
+	}
+	return nodes
+}
+
+// duckdbProfileChildren returns the child nodes of a JSON profile node.
+func duckdbProfileChildren(n map[string]any) []map[string]any {
+	list, _ := n["children"].([]any)
+	children := make([]map[string]any, 0, len(list))
+	for _, c := range list {
+		if child, ok := c.(map[string]any); ok {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// duckdbExtraInfo formats the extra_info of a profile node, an object of
+// strings or string lists (formerly a text block), as "key: value" items
+// separated by "; ", and extracts its estimated cardinality, or NaN.
+func duckdbExtraInfo(info any) (string, float64) {
+	estimated := math.NaN()
+	parseEstimate := func(s string) {
+		if x, err := strconv.ParseFloat(strings.TrimPrefix(strings.TrimSpace(s), "~"), 64); err == nil {
+			estimated = x
+		}
+	}
+	var items []string
+	switch x := info.(type) {
+	case string:
+		for _, line := range strings.Split(x, "\n") {
+			line = strings.TrimSpace(line)
+			if est, ok := strings.CutPrefix(line, "EC:"); ok {
+				parseEstimate(est)
+			} else if line != "" && strings.Trim(line, "-") != "" {
+				items = append(items, line)
+			}
+		}
+	case map[string]any:
+		for _, key := range slices.Sorted(maps.Keys(x)) {
+			var value string
+			switch v := x[key].(type) {
+			case string:
+				value = v
+			case []any:
+				parts := make([]string, len(v))
+				for i, p := range v {
+					parts[i] = fmt.Sprint(p)
+				}
+				value = strings.Join(parts, ", ")
+			default:
+				value = fmt.Sprint(v)
+			}
+			if key == "Estimated Cardinality" || key == "EC" {
+				parseEstimate(value)
+				continue
+			}
+			items = append(items, key+": "+value)
+		}
+	}
+	return strings.Join(items, "; "), estimated
+}
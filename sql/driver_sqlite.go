@@ -3,8 +3,290 @@
 // calls database/sql.Register("sqlite", ...).
 //
 // To add another backend, create a similar file (e.g. driver_duckdb.go) and
-// append its scheme/driver-name pair to driverSchemes in sql.go.
+// add its driverScheme to driverSchemes in sql.go.
 
 package sql
 
-import _ "modernc.org/sqlite" // registers the sqlite driver via its init() function
+import (
+	"context"
+	stdsql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"modernc.org/sqlite" // also registers the sqlite driver via its init() function
+)
+
+// sqliteScheme describes the "sqlite" URI scheme.
+var sqliteScheme = driverScheme{ //nolint:gochecknoglobals // registry entry initialised once at startup
+	driverName:  "sqlite",
+	memoryDSN:   sqliteMemoryDSN,
+	connector:   newSQLiteConnector,
+	namedParams: true,
+	savepoints:  true,
+	script:      scriptSyntax{bracketIdents: true, triggers: true},
+	tablesSQL: `SELECT 'main' AS schema, name, type FROM sqlite_master
+		WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%'
+		ORDER BY name`,
+	columnsSQL: `SELECT name, type, 1 - "notnull" AS nullable, dflt_value AS "default", (pk > 0) AS pk
+		FROM pragma_table_info(?1, ?2)
+		ORDER BY cid`,
+	indexesSQL: `SELECT il.name AS name, il."unique" AS "unique", (il.origin = 'pk') AS "primary",
+		(SELECT group_concat(ii.name, ', ') FROM
+			(SELECT name FROM pragma_index_info(il.name, ?2) ORDER BY seqno) AS ii) AS columns
+		FROM pragma_index_list(?1, ?2) AS il
+		ORDER BY il.name`,
+	settingsOption:  "Pragmas",
+	withSettings:    sqlitePragmas,
+	settingSQL:      func(name string) string { return "SELECT * FROM pragma_" + name },
+	registerFunc:    sqliteRegisterFunc,
+	unregisterFuncs: sqliteUnregisterFuncs,
+	staleConn:       sqliteStale,
+	snapshot:        sqliteSnapshot,
+	explain:         sqliteExplain,
+}
+
+// sqliteMemoryID numbers the shared in-memory databases of the process.
+var sqliteMemoryID atomic.Int64 //nolint:gochecknoglobals // process-wide like the databases
+
+// sqliteMemoryDSN reports whether dsn is ":memory:", a database private to
+// each connection, and returns a new named in-memory database in
+// shared-cache mode, which every connection opened with it sees.
+// Parameters after ? are kept.
+func sqliteMemoryDSN(dsn string) (string, bool) {
+	name, params, _ := strings.Cut(dsn, "?")
+	if name != ":memory:" {
+		return dsn, false
+	}
+	shared := fmt.Sprintf("file:ari-memory-%d?mode=memory&cache=shared", sqliteMemoryID.Add(1))
+	if params != "" {
+		shared += "&" + params
+	}
+	return shared, true
+}
+
+// sqlitePragmas adds pragmas to a DSN as _pragma parameters, which the
+// driver runs on each new connection.
+func sqlitePragmas(dsn string, pragmas []setting) (string, error) {
+	params := url.Values{}
+	for _, p := range pragmas {
+		// The driver splices the value into a PRAGMA statement.
+		if !isPragmaValue(p.value) {
+			return "", fmt.Errorf("invalid value %q for pragma %s", p.value, p.name)
+		}
+		params.Add("_pragma", p.name+"("+p.value+")")
+	}
+	return withQuery(dsn, params), nil
+}
+
+// isPragmaValue reports whether s is a keyword or number usable as a
+// pragma value.
+func isPragmaValue(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := range len(s) {
+		if c := s[i]; !isNameChar(c) && c != '-' && c != '.' {
+			return false
+		}
+	}
+	return true
+}
+
+// sqliteFuncs holds the Goal functions of sql.func by name. The driver
+// only registers functions process-wide, so each name is registered once
+// (sqliteDriverFuncs), calling the function bound to it by a single open
+// sql.conn, until sql.close unbinds it.
+var (
+	sqliteFuncsMu     sync.Mutex               //nolint:gochecknoglobals // guards sqliteFuncs and sqliteDriverFuncs
+	sqliteFuncs       = map[string]*goalFunc{} //nolint:gochecknoglobals // process-wide like the driver's own registry
+	sqliteDriverFuncs = map[string]bool{}      //nolint:gochecknoglobals // process-wide like the driver's own registry
+)
+
+// sqliteFuncGen counts the functions registered with the driver. Only the
+// connections opened afterwards have a function, so a pooled connection
+// opened at an older count is replaced (see sqliteConn.ResetSession).
+var sqliteFuncGen atomic.Int64 //nolint:gochecknoglobals // process-wide like the driver's own registry
+
+// sqliteRegisterFunc binds fn to its name, registering the name with the
+// driver the first time. The name may not be bound by another open
+// sql.conn, whose queries would call fn instead.
+func sqliteRegisterFunc(_ context.Context, c *Conn, fn *goalFunc) error {
+	sqliteFuncsMu.Lock()
+	defer sqliteFuncsMu.Unlock()
+	if old, ok := sqliteFuncs[fn.name]; ok && old.conn != c {
+		return fmt.Errorf("already registered on another open SQLite connection (%s)", old.conn.dsn)
+	}
+	inUse := c.db.Stats().InUse
+	if c.pin != nil {
+		inUse--
+	}
+	if inUse > 0 || c.pinTx != nil || len(c.openCursors()) > 0 {
+		// Their connections are reused only once they end.
+		return errors.New("connections are in use by transactions, cursors or sql.rows; end or close them first")
+	}
+	if !sqliteDriverFuncs[fn.name] {
+		name := fn.name
+		err := sqlite.RegisterFunction(name, &sqlite.FunctionImpl{
+			NArgs: -1, // fn.call checks the number of arguments
+			Scalar: func(_ *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+				sqliteFuncsMu.Lock()
+				fn := sqliteFuncs[name]
+				sqliteFuncsMu.Unlock()
+				if fn == nil {
+					return nil, fmt.Errorf("%s: no Goal function is bound to it: its sql.conn was closed", name)
+				}
+				return fn.call(args)
+			},
+		})
+		if err != nil {
+			return err
+		}
+		sqliteDriverFuncs[name] = true
+		sqliteFuncGen.Add(1)
+	}
+	sqliteFuncs[fn.name] = fn
+	return nil
+}
+
+// sqliteUnregisterFuncs unbinds the functions of c, which is being closed,
+// from their names.
+func sqliteUnregisterFuncs(c *Conn) {
+	sqliteFuncsMu.Lock()
+	defer sqliteFuncsMu.Unlock()
+	for name, fn := range sqliteFuncs {
+		if fn.conn == c {
+			delete(sqliteFuncs, name)
+		}
+	}
+}
+
+// sqliteStale reports whether conn lacks functions registered with the
+// driver since it was opened.
+func sqliteStale(conn *stdsql.Conn) bool {
+	var stale bool
+	_ = conn.Raw(func(driverConn any) error {
+		if sc, ok := driverConn.(*sqliteConn); ok {
+			stale = sc.funcGen < sqliteFuncGen.Load()
+		}
+		return nil
+	})
+	return stale
+}
+
+// sqliteSnapshot serializes the main database of conn, an in-memory one,
+// and returns a function loading it into another connection.
+func sqliteSnapshot(ctx context.Context, conn *stdsql.Conn) (func(*stdsql.Conn) error, error) {
+	var pages int64
+	if err := conn.QueryRowContext(ctx, "PRAGMA page_count").Scan(&pages); err != nil {
+		return nil, err
+	}
+	if pages == 0 {
+		// Nothing was created yet, and SQLite serializes no empty database.
+		return func(*stdsql.Conn) error { return nil }, nil
+	}
+	var data []byte
+	err := conn.Raw(func(driverConn any) error {
+		sc, ok := driverConn.(*sqliteConn)
+		if !ok {
+			return fmt.Errorf("sqlite: unexpected connection type %T", driverConn)
+		}
+		var err error
+		data, err = sc.Serialize()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return func(dst *stdsql.Conn) error {
+		return dst.Raw(func(driverConn any) error {
+			sc, ok := driverConn.(*sqliteConn)
+			if !ok {
+				return fmt.Errorf("sqlite: unexpected connection type %T", driverConn)
+			}
+			return sc.Deserialize(data)
+		})
+	}, nil
+}
+
+// sqliteConnector opens the connections of a SQLite pool, noting the
+// functions registered with the driver at the time.
+type sqliteConnector struct{ driver.Connector }
+
+// newSQLiteConnector returns the connector of a SQLite pool.
+func newSQLiteConnector(dsn string) (driver.Connector, error) {
+	connector, err := sqlite.NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sqliteConnector{connector}, nil
+}
+
+func (sc sqliteConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	gen := sqliteFuncGen.Load()
+	conn, err := sc.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	dc, ok := conn.(sqliteDriverConn)
+	if !ok {
+		_ = conn.Close()
+		return nil, fmt.Errorf("sqlite: unexpected connection type %T", conn)
+	}
+	return &sqliteConn{sqliteDriverConn: dc, funcGen: gen}, nil
+}
+
+// sqliteDriverConn lists the interfaces of the driver's connections that
+// database/sql uses.
+type sqliteDriverConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+	Serialize() ([]byte, error)
+	Deserialize(buf []byte) error
+}
+
+// sqliteConn is a pooled SQLite connection.
+type sqliteConn struct {
+	sqliteDriverConn
+	funcGen int64 // sqliteFuncGen when opened
+}
+
+// ResetSession runs before database/sql reuses the connection. A
+// connection lacking functions registered since it was opened is bad, so
+// that database/sql closes it and opens one that has them.
+func (conn *sqliteConn) ResetSession(ctx context.Context) error {
+	if conn.funcGen < sqliteFuncGen.Load() {
+		return driver.ErrBadConn
+	}
+	return conn.sqliteDriverConn.ResetSession(ctx)
+}
+
+// sqliteExplain reads the EXPLAIN QUERY PLAN of a query, whose rows are
+// (id, parent, notused, detail).
+func sqliteExplain(ctx context.Context, q querier, query string, args []any) ([]planNode, error) {
+	rows, err := q.QueryContext(ctx, "EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var nodes []planNode
+	for rows.Next() {
+		nd := unknownPlanNode()
+		var notused int64
+		if err := rows.Scan(&nd.id, &nd.parent, &notused, &nd.operator); err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, nd)
+	}
+	return nodes, rows.Err()
+}
@@ -0,0 +1,106 @@
+package sql
+
+import (
+	"math"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// sql.explain  (dyad: conn sql.explain "query"  or  sql.explain[conn;"query";args])
+// ---------------------------------------------------------------------------
+
+// vfExplain returns the plan of a query as a columnar dict with one row per
+// plan node, in depth-first order:
+//
+//	"id"             – node id (I)
+//	"parent"         – id of the parent node, or 0 for a root (I)
+//	"operator"       – operator, e.g. "HASH_JOIN", or SQLite's plan line (S)
+//	"detail"         – other information on the node, e.g. its condition (S)
+//	"estimatedRows"  – rows the planner expects the node to produce (F)
+//	"actualRows"     – rows the node produced (F)
+//	"timeMilli"      – time spent in the node, in milliseconds (F)
+//
+// SQLite reports EXPLAIN QUERY PLAN, without running the query, so the
+// numeric columns are 0n. DuckDB profiles the query as EXPLAIN ANALYZE does:
+// the query runs, and the numbers are its actual ones. It thus refuses a
+// statement that may write (see readOnlyQuery) unless opts has
+// AllowWrites:1.
+//
+// Usage:
+//
+//	p: db sql.explain "SELECT region, sum(amount) FROM sales GROUP BY region"
+//	p: sql.explain[db;"SELECT * FROM t WHERE id=?";,1]
+//	p: sql.explain[db;"DELETE FROM t WHERE id=?";,1;..[AllowWrites:1]]
+//
+// conn accepts either sql.conn or sql.tx.
+func vfExplain(_ *goal.Context, args []goal.V) goal.V {
+	call, err := parseConnQueryArgs("sql.explain", args)
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	if call.scheme.explain == nil {
+		return goal.Panicf("sql.explain : not supported by the %s driver", call.scheme.driverName)
+	}
+	if call.scheme.explainRuns && !call.opts.allowWrites && !readOnlyQuery(call.query, call.scheme.script) {
+		return goal.Panicf("sql.explain %q: the %s driver runs the statement to profile it, which may write: pass ..[AllowWrites:1] to run it anyway", call.query, call.scheme.driverName)
+	}
+	query, sqlArgs, err := call.bind()
+	if err != nil {
+		return goal.Panicf("sql.explain: %v", err)
+	}
+
+	ctx, done := call.context()
+	defer done()
+	start := time.Now()
+	nodes, err := call.scheme.explain(ctx, call.conn, query, sqlArgs)
+	call.db.observe(stmtEvent{verb: "sql.explain", query: query, args: sqlArgs, rows: int64(len(nodes)), elapsed: time.Since(start), err: err})
+	if err != nil {
+		return goal.Panicf("sql.explain %q: %v", call.query, callErr(ctx, err))
+	}
+	return planTable(nodes)
+}
+
+// planNode is a node of a query plan (see vfExplain). The numbers are NaN
+// when the driver does not report them.
+type planNode struct {
+	id, parent    int64
+	operator      string
+	detail        string
+	estimatedRows float64
+	actualRows    float64
+	millis        float64
+}
+
+// unknownPlanNode returns a node whose numbers are unknown.
+func unknownPlanNode() planNode {
+	return planNode{estimatedRows: math.NaN(), actualRows: math.NaN(), millis: math.NaN()}
+}
+
+// planTable builds the sql.explain table of a plan.
+func planTable(nodes []planNode) goal.V {
+	n := len(nodes)
+	ids := make([]int64, n)
+	parents := make([]int64, n)
+	operators := make([]string, n)
+	details := make([]string, n)
+	estimated := make([]float64, n)
+	actual := make([]float64, n)
+	millis := make([]float64, n)
+	for i, nd := range nodes {
+		ids[i] = nd.id
+		parents[i] = nd.parent
+		operators[i] = nd.operator
+		details[i] = nd.detail
+		estimated[i] = nd.estimatedRows
+		actual[i] = nd.actualRows
+		millis[i] = nd.millis
+	}
+	keys := goal.NewAS([]string{"id", "parent", "operator", "detail", "estimatedRows", "actualRows", "timeMilli"})
+	vals := goal.NewAV([]goal.V{
+		goal.NewAI(ids), goal.NewAI(parents), goal.NewAS(operators), goal.NewAS(details),
+		goal.NewAF(estimated), goal.NewAF(actual), goal.NewAF(millis),
+	})
+	return goal.NewD(keys, vals)
+}
@@ -0,0 +1,126 @@
+package sql_test
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"testing"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// planCol returns a numeric column of a sql.explain result.
+func planCol[T int64 | float64](t *testing.T, ctx *goal.Context, v goal.V, key string) []T {
+	t.Helper()
+	col := dictLookup(t, ctx, mustDict(t, ctx, v), key)
+	switch xs := col.BV().(type) {
+	case *goal.AI:
+		if s, ok := any(xs.Slice).([]T); ok {
+			return s
+		}
+	case *goal.AF:
+		if s, ok := any(xs.Slice).([]T); ok {
+			return s
+		}
+	}
+	t.Fatalf("column %q: unexpected type %q", key, col.Type())
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// TestExplain
+// ---------------------------------------------------------------------------
+
+func TestExplainSQLite(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT))
+	eval(t, ctx, `db sql.exec "CREATE INDEX t_name ON t (name)"`)
+
+	v := eval(t, ctx, `sql.explain[db;"SELECT * FROM t WHERE name = ?";,"c"]`)
+	ops := strCol(t, ctx, v, "operator")
+	if len(ops) == 0 || !strings.Contains(ops[0], "t_name") {
+		t.Fatalf("operator: expected a search using t_name, got %q", ops)
+	}
+	if rows := planCol[float64](t, ctx, v, "actualRows"); !math.IsNaN(rows[0]) {
+		t.Errorf("actualRows: expected 0n, got %v", rows)
+	}
+
+	// Nodes link to their parents by id.
+	v = eval(t, ctx, `db sql.explain "SELECT * FROM t WHERE id IN (SELECT id FROM t ORDER BY name LIMIT 2)"`)
+	ids := planCol[int64](t, ctx, v, "id")
+	for i, p := range planCol[int64](t, ctx, v, "parent") {
+		if p != 0 && !slices.Contains(ids, p) {
+			t.Errorf("node %d: parent %d is not a node id (%v)", ids[i], p, ids)
+		}
+	}
+
+	// The query does not run: nothing is deleted.
+	eval(t, ctx, `db sql.explain "DELETE FROM t"`)
+	if n := mustI(t, eval(t, ctx, `*(db sql.q "SELECT count(*) AS n FROM t")"n"`)); n != 5 {
+		t.Fatalf("sql.explain ran the query: %d rows left", n)
+	}
+}
+
+func TestExplainDuckDB(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	eval(t, ctx, `db sql.exec "CREATE TABLE s AS SELECT range % 3 AS k, range AS v FROM range(100)"`)
+
+	v := eval(t, ctx, `sql.explain[db;"SELECT k, sum(v) FROM s WHERE v > ? GROUP BY k";,10]`)
+	ops := strCol(t, ctx, v, "operator")
+	if !slices.ContainsFunc(ops, func(op string) bool { return strings.Contains(op, "GROUP_BY") }) {
+		t.Errorf("operator: expected a GROUP_BY node, got %q", ops)
+	}
+	if parents := planCol[int64](t, ctx, v, "parent"); parents[0] != 0 {
+		t.Errorf("parent: expected 0 for the root, got %v", parents)
+	}
+	rows := planCol[float64](t, ctx, v, "actualRows")
+	if !slices.Contains(rows, 3) {
+		t.Errorf("actualRows: expected a node producing the 3 groups, got %v", rows)
+	}
+
+	// Profiling stops afterwards, and the plan can be read in a transaction.
+	eval(t, ctx, `db sql.q "SELECT 1"`)
+	v = eval(t, ctx, `sql.tx[db;{[tx] tx sql.explain "SELECT count(*) FROM s"}]`)
+	if len(strCol(t, ctx, v, "operator")) == 0 {
+		t.Error("sql.explain in a transaction: expected plan nodes")
+	}
+	// The connection does not keep the profiler's settings.
+	v = eval(t, ctx, `sql.tx[db;{[tx] tx sql.explain "SELECT 1"; tx sql.q "SELECT current_setting('profiling_output') AS p"}]`)
+	if got := strCol(t, ctx, v, "p"); got[0] != "" {
+		t.Errorf("profiling_output: expected it reset, got %q", got[0])
+	}
+
+	// Statements that may write run only when allowed.
+	msg := evalPanic(t, ctx, `db sql.explain "DELETE FROM s WHERE v < 10"`)
+	if !strings.Contains(msg, "AllowWrites") {
+		t.Errorf("DELETE: expected an error asking for AllowWrites, got %s", msg)
+	}
+	if n := mustI(t, eval(t, ctx, `*(db sql.q "SELECT count(*) AS n FROM s")"n"`)); n != 100 {
+		t.Fatalf("refused DELETE ran: %d rows left", n)
+	}
+	eval(t, ctx, `sql.explain[db;"DELETE FROM s WHERE v < 10";();..[AllowWrites:1]]`)
+	if n := mustI(t, eval(t, ctx, `*(db sql.q "SELECT count(*) AS n FROM s")"n"`)); n != 90 {
+		t.Fatalf("DELETE with AllowWrites: expected 90 rows left, got %d", n)
+	}
+}
+
+func TestExplainErrors(t *testing.T) {
+	if err := registerFake(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT))
+	ctx.AssignGlobal("fake", eval(t, ctx, `sql.open "fake://x"`))
+
+	for _, tt := range []struct{ src, want string }{
+		{`db sql.explain "SELECT nope FROM t"`, "sql.explain"},
+		{`fake sql.explain "SELECT 1"`, "not supported"},
+		{`1 sql.explain "SELECT 1"`, "expected sql.conn"},
+		{`sql.q[db;"SELECT 1";();..[AllowWrites:1]]`, "only applies to sql.explain"},
+	} {
+		if msg := evalPanic(t, ctx, tt.src); !strings.Contains(msg, tt.want) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.src, tt.want, msg)
+		}
+	}
+}
@@ -0,0 +1,744 @@
+package sql
+
+import (
+	"compress/gzip"
+	"context"
+	stdsql "database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// sql.read  (dyad: conn sql.read path  or  sql.read[conn;path;opts])
+// sql.write (sql.write[conn;query;path]  or  sql.write[conn;query;path;opts])
+// ---------------------------------------------------------------------------
+
+// Data file formats of sql.read and sql.write.
+const (
+	formatCSV     = "csv"
+	formatJSON    = "json"
+	formatParquet = "parquet"
+)
+
+// fileBatch is the number of records the Go reader decodes before inserting
+// them; the first batch also decides the table's columns and types.
+const fileBatch = 1000
+
+// vfRead loads a CSV, JSON or Parquet file into a new table of the
+// database and returns the table name, so the data can be queried at once.
+//
+// The format follows the file extension (.csv, .tsv, .json, .ndjson,
+// .jsonl or .parquet, optionally followed by .gz) and the table is named
+// after the file, e.g. "data/events.csv" gives the table events. An opts
+// dict (see fileOptions) changes this:
+//
+//	Table    s  – name of the table to create
+//	Format   s  – "csv", "json" or "parquet"
+//	Header   i  – CSV: the first line holds column names (0/1, default 1)
+//	Delim    s  – CSV: field delimiter (default "," or tab for .tsv)
+//	Replace  i  – replace the table if it exists (0/1)
+//
+// DuckDB reads the file with read_csv, read_json_auto or read_parquet.
+// Other drivers read CSV and JSON (an array of objects, or one object per
+// line) in Go: the columns and their types (INTEGER, REAL or TEXT) come
+// from the first 1000 records, and rows are inserted in one transaction
+// (the caller's when conn is a sql.tx).
+//
+// Usage:
+//
+//	t: db sql.read "events.csv"
+//	db sql.q "SELECT count(*) AS n FROM ",t
+//	sql.read[db;"dump.json";..[Table:"raw";Replace:1]]
+func vfRead(_ *goal.Context, args []goal.V) goal.V {
+	opts := newFileOptions()
+	switch len(args) {
+	case 2:
+		// args[0] = path (right), args[1] = conn (left)
+	case 3:
+		// args[0] = opts, args[1] = path, args[2] = conn
+		if err := parseOptions("sql.read[conn;path;opts]", args[0], &opts); err != nil {
+			return goal.Panicf("%v", err)
+		}
+		args = args[1:]
+	default:
+		return goal.Panicf("conn sql.read path : expected 2 or 3 arguments, got %d", len(args))
+	}
+	ps, ok := args[0].BV().(goal.S)
+	if !ok {
+		return goal.Panicf("conn sql.read path : expected string path, got %q", args[0].Type())
+	}
+	path := string(ps)
+	q, sch, err := connScheme("conn sql.read path", args[1])
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	if err := opts.resolve(path); err != nil {
+		return goal.Panicf("sql.read %q: %v", path, err)
+	}
+	if opts.table == "" {
+		opts.table = tableName(path)
+	}
+
+	c := connOf(args[1])
+	defer c.invalidateCache()
+	ctx, done := callContext(c.timeout)
+	defer done()
+	start := time.Now()
+	switch {
+	case sch.readFile != nil:
+		err = sch.readFile(ctx, q, path, opts)
+	default:
+		switch bv := args[1].BV().(type) {
+		case *Conn:
+			err = readFileConn(ctx, sch, bv, path, opts)
+		case *GoalTx:
+			err = readFile(ctx, sch, bv.tx, path, opts)
+		}
+	}
+	c.observe(stmtEvent{verb: "sql.read", query: "CREATE TABLE " + quoteIdent(opts.table), rows: -1, elapsed: time.Since(start), err: err})
+	if err != nil {
+		return goal.Panicf("sql.read %q: %v", path, callErr(ctx, err))
+	}
+	return goal.NewS(opts.table)
+}
+
+// vfWrite runs a query and writes its result to a CSV, JSON or Parquet
+// file, returning an ExecResult dict whose rowsAffected is the number of
+// rows written.
+//
+// The format follows the file extension as for sql.read; the Format,
+// Header and Delim options apply too. JSON files hold one object per line.
+// DuckDB writes the file with COPY … TO; other drivers write CSV and JSON in
+// Go, compressed with gzip when the path ends with .gz.
+//
+// Usage:
+//
+//	sql.write[db;"SELECT * FROM events";"events.parquet"]
+//	sql.write[db;"SELECT * FROM t";"t.csv";..[Delim:";"]]
+func vfWrite(_ *goal.Context, args []goal.V) goal.V {
+	opts := newFileOptions()
+	switch len(args) {
+	case 3:
+		// args[0] = path, args[1] = query, args[2] = conn
+	case 4:
+		// args[0] = opts, args[1] = path, args[2] = query, args[3] = conn
+		if err := parseOptions("sql.write[conn;query;path;opts]", args[0], &opts); err != nil {
+			return goal.Panicf("%v", err)
+		}
+		if opts.table != "" || opts.replace {
+			return goal.Panicf("sql.write[conn;query;path;opts] : the Table and Replace options only apply to sql.read")
+		}
+		args = args[1:]
+	default:
+		return goal.Panicf("sql.write[conn;query;path] : expected 3 or 4 arguments, got %d", len(args))
+	}
+	ps, ok := args[0].BV().(goal.S)
+	if !ok {
+		return goal.Panicf("sql.write[conn;query;path] : expected string path, got %q", args[0].Type())
+	}
+	path := string(ps)
+	qs, ok := args[1].BV().(goal.S)
+	if !ok {
+		return goal.Panicf("sql.write[conn;query;path] : expected string query, got %q", args[1].Type())
+	}
+	query := strings.TrimRight(strings.TrimSpace(string(qs)), ";")
+	q, sch, err := connScheme("sql.write[conn;query;path]", args[2])
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	if err := opts.resolve(path); err != nil {
+		return goal.Panicf("sql.write %q: %v", path, err)
+	}
+
+	c := connOf(args[2])
+	ctx, done := callContext(c.timeout)
+	defer done()
+	writeFile := sch.writeFile
+	if writeFile == nil {
+		writeFile = writeFileGo
+	}
+	start := time.Now()
+	n, err := writeFile(ctx, q, query, path, opts)
+	c.observe(stmtEvent{verb: "sql.write", query: query, rows: n, elapsed: time.Since(start), err: err})
+	if err != nil {
+		return goal.Panicf("sql.write %q: %v", path, callErr(ctx, err))
+	}
+	return execSummary{rowsAffected: n}.dict()
+}
+
+// fileOptions holds the settings of sql.read and sql.write parsed from an
+// opts dict.
+type fileOptions struct {
+	table   string
+	format  string // "" until resolve
+	header  bool
+	delim   string // "" until resolve
+	replace bool
+}
+
+// newFileOptions returns the default file options.
+func newFileOptions() fileOptions {
+	return fileOptions{header: true}
+}
+
+// apply sets a single file option.
+func (opts *fileOptions) apply(key string, v goal.V) error {
+	var err error
+	switch key {
+	case "Table":
+		opts.table, err = stringArg(v, key)
+	case "Format":
+		if opts.format, err = stringArg(v, key); err == nil {
+			opts.format = strings.ToLower(opts.format)
+			switch opts.format {
+			case formatCSV, formatJSON, formatParquet:
+			default:
+				err = fmt.Errorf("sql option %q must be \"csv\", \"json\" or \"parquet\", got %q", key, opts.format)
+			}
+		}
+	case "Header":
+		opts.header, err = boolArg(v, key)
+	case "Delim":
+		if opts.delim, err = stringArg(v, key); err == nil && utf8.RuneCountInString(opts.delim) != 1 {
+			err = fmt.Errorf("sql option %q must be a single character, got %q", key, opts.delim)
+		}
+	case "Replace":
+		opts.replace, err = boolArg(v, key)
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return err
+}
+
+// resolve fills in the format and CSV delimiter the options leave unset
+// from the extension of path.
+func (opts *fileOptions) resolve(path string) error {
+	ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz")))
+	if opts.format == "" {
+		switch ext {
+		case ".csv", ".tsv", ".txt":
+			opts.format = formatCSV
+		case ".json", ".ndjson", ".jsonl":
+			opts.format = formatJSON
+		case ".parquet":
+			opts.format = formatParquet
+		default:
+			return fmt.Errorf("unknown file format %q: use the Format option", ext)
+		}
+	}
+	if opts.delim == "" {
+		opts.delim = ","
+		if ext == ".tsv" {
+			opts.delim = "\t"
+		}
+	}
+	return nil
+}
+
+// tableName derives a table name from a file path: its base name up to the
+// first dot.
+func tableName(path string) string {
+	base := filepath.Base(path)
+	if i := strings.IndexByte(base, '.'); i > 0 {
+		base = base[:i]
+	}
+	return base
+}
+
+// quoteString quotes s as a SQL string literal.
+func quoteString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// ---------------------------------------------------------------------------
+// Reading files in Go
+// ---------------------------------------------------------------------------
+
+// recordReader reads the records of a data file as SQL values aligned with
+// its column names.
+type recordReader interface {
+	// read returns the next record, or io.EOF after the last one.
+	read() ([]any, error)
+	// columns returns the column names seen so far. Once freeze is called,
+	// records with new columns are errors.
+	columns() []string
+	freeze()
+}
+
+// readFileConn loads a file through a connection, in a transaction.
+func readFileConn(ctx context.Context, sch driverScheme, c *Conn, path string, opts fileOptions) error {
+	gtx, err := c.begin("sql.read", txOptions{})
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	if err := readFile(ctx, sch, gtx.tx, path, opts); err != nil {
+		_ = gtx.end("sql.read", false)
+		return err
+	}
+	if err := gtx.end("sql.read", true); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// readFile creates the table of a CSV or JSON file and inserts its records,
+// fileBatch at a time.
+func readFile(ctx context.Context, sch driverScheme, tx *stdsql.Tx, path string, opts fileOptions) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	var rr recordReader
+	switch opts.format {
+	case formatCSV:
+		rr = newCSVReader(r, opts)
+	case formatJSON:
+		rr, err = newJSONReader(r)
+	default:
+		err = fmt.Errorf("reading %s files needs a DuckDB connection", opts.format)
+	}
+	if err != nil {
+		return err
+	}
+
+	batch, err := readBatch(rr)
+	if err != nil {
+		return err
+	}
+	rr.freeze()
+	names := rr.columns()
+	if len(names) == 0 {
+		return errors.New("no columns")
+	}
+	if err := createTable(ctx, sch, tx, opts, names, batch); err != nil {
+		return err
+	}
+	stmt, err := tx.PrepareContext(ctx, insertSQL(sch, opts.table, names))
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for line := 1; len(batch) > 0; {
+		for _, rec := range batch {
+			if len(rec) < len(names) {
+				rec = append(rec, make([]any, len(names)-len(rec))...)
+			}
+			if _, err := stmt.ExecContext(ctx, rec...); err != nil {
+				return fmt.Errorf("record %d: %w", line, err)
+			}
+			line++
+		}
+		if batch, err = readBatch(rr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBatch reads up to fileBatch records.
+func readBatch(rr recordReader) ([][]any, error) {
+	var batch [][]any
+	for len(batch) < fileBatch {
+		rec, err := rr.read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, rec)
+	}
+	return batch, nil
+}
+
+// createTable creates the table of opts (replacing it if asked) with
+// column types guessed from the values of batch.
+func createTable(ctx context.Context, sch driverScheme, tx *stdsql.Tx, opts fileOptions, names []string, batch [][]any) error {
+	if opts.replace {
+		if _, err := tx.ExecContext(ctx, "DROP TABLE IF EXISTS "+quoteIdent(opts.table)); err != nil {
+			return err
+		}
+	}
+	defs := make([]string, len(names))
+	for j, name := range names {
+		defs[j] = strings.TrimSpace(quoteName(name) + " " + sch.columnType(columnType(batch, j)))
+	}
+	_, err := tx.ExecContext(ctx, "CREATE TABLE "+quoteIdent(opts.table)+" ("+strings.Join(defs, ", ")+")")
+	return err
+}
+
+// columnType returns the SQL type of column j of the records: INTEGER or
+// REAL when all its non-NULL values are numbers, TEXT when they are
+// strings, and no type otherwise.
+func columnType(batch [][]any, j int) string {
+	kind := kindNull
+	for _, rec := range batch {
+		if j >= len(rec) || rec[j] == nil {
+			continue
+		}
+		var ok bool
+		if kind, ok = mergeKind(kind, kindOf(rec[j])); !ok {
+			return ""
+		}
+	}
+	switch kind {
+	case kindInt:
+		return "INTEGER"
+	case kindFloat:
+		return "REAL"
+	case kindString:
+		return "TEXT"
+	}
+	return ""
+}
+
+// csvReader reads CSV records, converting fields that parse as numbers.
+type csvReader struct {
+	r      *csv.Reader
+	names  []string
+	header bool
+}
+
+// newCSVReader returns a csvReader splitting fields at opts.delim.
+func newCSVReader(r io.Reader, opts fileOptions) *csvReader {
+	cr := csv.NewReader(r)
+	cr.Comma, _ = utf8.DecodeRuneInString(opts.delim)
+	cr.ReuseRecord = true
+	return &csvReader{r: cr, header: opts.header}
+}
+
+func (cr *csvReader) read() ([]any, error) {
+	fields, err := cr.r.Read()
+	if err != nil {
+		return nil, err
+	}
+	if cr.names == nil {
+		cr.names = make([]string, len(fields))
+		for i, f := range fields {
+			cr.names[i] = "column" + strconv.Itoa(i)
+			if cr.header {
+				cr.names[i] = f
+			}
+		}
+		if cr.header {
+			return cr.read()
+		}
+	}
+	rec := make([]any, len(fields))
+	for i, f := range fields {
+		rec[i] = csvValue(f)
+	}
+	return rec, nil
+}
+
+func (cr *csvReader) columns() []string { return cr.names }
+
+// freeze is a no-op: the csv.Reader already requires every record to have
+// as many fields as the first.
+func (cr *csvReader) freeze() {}
+
+// csvValue converts a CSV field: empty fields are NULL, and integers and
+// decimal numbers are numbers.
+func csvValue(f string) any {
+	if f == "" {
+		return nil
+	}
+	if c := f[0]; c != '-' && c != '+' && c != '.' && (c < '0' || c > '9') {
+		return f // not a number; also excludes NaN and Inf
+	}
+	if i, err := strconv.ParseInt(f, 10, 64); err == nil {
+		return i
+	}
+	if x, err := strconv.ParseFloat(f, 64); err == nil {
+		return x
+	}
+	return f
+}
+
+// jsonReader reads the objects of a JSON array, or of a stream of objects
+// such as newline-delimited JSON, keeping the order of their keys.
+type jsonReader struct {
+	dec     *json.Decoder
+	array   bool
+	pending bool // the opening brace of the first object was read
+	names   []string
+	index   map[string]int
+	frozen  bool
+}
+
+// newJSONReader returns a jsonReader after reading the opening bracket or
+// brace of r.
+func newJSONReader(r io.Reader) (*jsonReader, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	jr := &jsonReader{dec: dec, index: map[string]int{}}
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('['):
+		jr.array = true
+	case json.Delim('{'):
+		jr.pending = true
+	default:
+		return nil, fmt.Errorf("expected JSON objects, got %v", tok)
+	}
+	return jr, nil
+}
+
+func (jr *jsonReader) read() ([]any, error) {
+	if err := jr.open(); err != nil {
+		return nil, err
+	}
+	rec := make([]any, len(jr.names))
+	for jr.dec.More() {
+		tok, err := jr.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		var v any
+		if err := jr.dec.Decode(&v); err != nil {
+			return nil, err
+		}
+		j, ok := jr.index[key]
+		if !ok {
+			if jr.frozen {
+				return nil, fmt.Errorf("key %q is not in the first %d objects", key, fileBatch)
+			}
+			j = len(jr.names)
+			jr.index[key] = j
+			jr.names = append(jr.names, key)
+			rec = append(rec, nil)
+		}
+		if rec[j], err = jsonValue(v); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := jr.dec.Token(); err != nil { // closing brace
+		return nil, err
+	}
+	return rec, nil
+}
+
+// open reads up to the opening brace of the next object, returning io.EOF
+// at the end of the array or stream.
+func (jr *jsonReader) open() error {
+	if jr.pending {
+		jr.pending = false
+		return nil
+	}
+	if jr.array && !jr.dec.More() {
+		return io.EOF
+	}
+	tok, err := jr.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != json.Delim('{') {
+		return fmt.Errorf("expected JSON object, got %v", tok)
+	}
+	return nil
+}
+
+func (jr *jsonReader) columns() []string { return jr.names }
+
+func (jr *jsonReader) freeze() { jr.frozen = true }
+
+// jsonValue converts a decoded JSON value: numbers are integers when they
+// can be, booleans are 1 or 0 and arrays and objects are kept as JSON
+// text.
+func jsonValue(v any) (any, error) {
+	switch x := v.(type) {
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return i, nil
+		}
+		return x.Float64()
+	case bool:
+		return intValue(x), nil
+	case []any, map[string]any:
+		b, err := json.Marshal(x)
+		return string(b), err
+	}
+	return v, nil
+}
+
+// ---------------------------------------------------------------------------
+// Writing files in Go
+// ---------------------------------------------------------------------------
+
+// writeFileGo runs query and writes its rows to a CSV or JSON file.
+func writeFileGo(ctx context.Context, q querier, query, path string, opts fileOptions) (int64, error) {
+	if opts.format == formatParquet {
+		return 0, fmt.Errorf("writing %s files needs a DuckDB connection", opts.format)
+	}
+	rows, err := q.QueryContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	names, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := writeRows(f, rows, names, path, opts)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// writeRows writes the rows of a query to w, compressed when path ends
+// with .gz.
+func writeRows(w io.Writer, rows *stdsql.Rows, names []string, path string, opts fileOptions) (int64, error) {
+	if strings.HasSuffix(path, ".gz") {
+		gz := gzip.NewWriter(w)
+		n, err := writeRows(gz, rows, names, "", opts)
+		if cerr := gz.Close(); err == nil {
+			err = cerr
+		}
+		return n, err
+	}
+	var rw rowWriter
+	if opts.format == formatCSV {
+		cw := csv.NewWriter(w)
+		cw.Comma, _ = utf8.DecodeRuneInString(opts.delim)
+		if opts.header {
+			if err := cw.Write(names); err != nil {
+				return 0, err
+			}
+		}
+		rw = &csvWriter{w: cw, fields: make([]string, len(names))}
+	} else {
+		rw = &jsonWriter{w: w, names: names}
+	}
+
+	vals := make([]any, len(names))
+	ptrs := make([]any, len(names))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		if err := rw.write(vals); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	return n, rw.flush()
+}
+
+// rowWriter writes rows of SQL values to a data file.
+type rowWriter interface {
+	write(vals []any) error
+	flush() error
+}
+
+// csvWriter writes rows as CSV records: NULL is an empty field.
+type csvWriter struct {
+	w      *csv.Writer
+	fields []string
+}
+
+func (cw *csvWriter) write(vals []any) error {
+	for i, v := range vals {
+		cw.fields[i] = csvField(v)
+	}
+	return cw.w.Write(cw.fields)
+}
+
+func (cw *csvWriter) flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// csvField formats a SQL value as a CSV field.
+func csvField(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(x)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+// jsonWriter writes rows as newline-delimited JSON objects, with keys in
+// column order.
+type jsonWriter struct {
+	w     io.Writer
+	names []string
+	buf   []byte
+}
+
+func (jw *jsonWriter) write(vals []any) error {
+	jw.buf = append(jw.buf[:0], '{')
+	for i, v := range vals {
+		if i > 0 {
+			jw.buf = append(jw.buf, ',')
+		}
+		key, err := json.Marshal(jw.names[i])
+		if err != nil {
+			return err
+		}
+		jw.buf = append(jw.buf, key...)
+		switch x := v.(type) {
+		case []byte:
+			v = string(x)
+		case float64:
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				v = nil
+			}
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		jw.buf = append(append(jw.buf, ':'), b...)
+	}
+	jw.buf = append(jw.buf, '}', '\n')
+	_, err := jw.w.Write(jw.buf)
+	return err
+}
+
+func (jw *jsonWriter) flush() error { return nil }
@@ -0,0 +1,180 @@
+package sql_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// writeFile writes src to name in a new temporary directory and returns
+// the file's path.
+func writeFile(t *testing.T, name, src string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fileURIs are the connections sql.read and sql.write are tested on: the Go
+// implementation (SQLite) and DuckDB's readers and writers.
+var fileURIs = []string{"sqlite://:memory:", "duckdb://"} //nolint:gochecknoglobals // test fixture
+
+// ---------------------------------------------------------------------------
+// TestRead
+// ---------------------------------------------------------------------------
+
+func TestReadCSV(t *testing.T) {
+	path := writeFile(t, "events.csv", "id,name,score\n1,a,1.5\n2,\"b, c\",\n3,,2.5\n")
+	for _, uri := range fileURIs {
+		ctx := newCtx(t)
+		ctx.AssignGlobal("db", eval(t, ctx, `sql.open["`+uri+`";..[MaxOpenConns:1]]`))
+		ctx.AssignGlobal("path", goal.NewS(path))
+
+		if got := mustS(t, eval(t, ctx, `db sql.read path`)); got != "events" {
+			t.Fatalf("%s: expected table events, got %s", uri, got)
+		}
+		v := eval(t, ctx, `db sql.q "SELECT * FROM events ORDER BY id"`)
+		if got := dictLookup(t, ctx, mustDict(t, ctx, v), "id").Sprint(ctx, true); got != "1 2 3" {
+			t.Errorf("%s: id: expected 1 2 3, got %s", uri, got)
+		}
+		if got := strCol(t, ctx, v, "name"); got[1] != "b, c" || got[2] != "" {
+			t.Errorf("%s: name: got %q", uri, got)
+		}
+		if got := mustI(t, eval(t, ctx, `+/nan (db sql.q "SELECT score FROM events")"score"`)); got != 1 {
+			t.Errorf("%s: score: expected 1 NULL, got %d", uri, got)
+		}
+
+		// The table exists: Replace or another name is needed.
+		evalPanic(t, ctx, `db sql.read path`)
+		eval(t, ctx, `sql.read[db;path;..[Replace:1]]`)
+		if got := mustS(t, eval(t, ctx, `sql.read[db;path;..[Table:"raw";Header:0]]`)); got != "raw" {
+			t.Errorf("%s: expected table raw, got %s", uri, got)
+		}
+		if n := mustI(t, eval(t, ctx, `*(db sql.q "SELECT count(*) AS n FROM raw")"n"`)); n != 4 {
+			t.Errorf("%s: Header:0: expected 4 rows, got %d", uri, n)
+		}
+	}
+}
+
+func TestReadCSVDottedHeader(t *testing.T) {
+	path := writeFile(t, "prices.csv", "id,price.usd\n1,1.5\n2,2.5\n")
+	for _, uri := range fileURIs {
+		ctx := newCtx(t)
+		ctx.AssignGlobal("db", eval(t, ctx, `sql.open["`+uri+`";..[MaxOpenConns:1]]`))
+		ctx.AssignGlobal("path", goal.NewS(path))
+
+		eval(t, ctx, `db sql.read path`)
+		if got := dictLookup(t, ctx, mustDict(t, ctx, eval(t, ctx, `db sql.q "SELECT * FROM prices"`)), "price.usd").Sprint(ctx, true); got != "1.5 2.5" {
+			t.Errorf("%s: price.usd: expected 1.5 2.5, got %s", uri, got)
+		}
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	files := map[string]string{
+		"objs.json":     `[{"id": 1, "tag": "x", "ok": true}, {"id": 2, "ok": false, "tag": null}]`,
+		"lines.ndjson":  "{\"id\": 1, \"tag\": \"x\", \"ok\": true}\n{\"id\": 2, \"ok\": false}\n",
+		"semi.txt":      "id;tag\n1;x\n2;\n",
+		"tabs.data.tsv": "id\ttag\n1\tx\n2\t\n",
+	}
+	for _, uri := range fileURIs {
+		ctx := newCtx(t)
+		ctx.AssignGlobal("db", eval(t, ctx, `sql.open["`+uri+`";..[MaxOpenConns:1]]`))
+		for name, src := range files {
+			ctx.AssignGlobal("path", goal.NewS(writeFile(t, name, src)))
+			opts := `..[]`
+			if name == "semi.txt" {
+				opts = `..[Delim:";"]`
+			}
+			table := mustS(t, eval(t, ctx, `sql.read[db;path;`+opts+`]`))
+			v := eval(t, ctx, `db sql.q "SELECT id, tag FROM `+table+` ORDER BY id"`)
+			if got := dictLookup(t, ctx, mustDict(t, ctx, v), "id").Sprint(ctx, true); got != "1 2" {
+				t.Errorf("%s %s: id: expected 1 2, got %s", uri, name, got)
+			}
+			if got := strCol(t, ctx, v, "tag"); got[0] != "x" || got[1] != "" {
+				t.Errorf("%s %s: tag: got %q", uri, name, got)
+			}
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// TestWrite
+// ---------------------------------------------------------------------------
+
+func TestWriteRoundTrip(t *testing.T) {
+	for _, uri := range fileURIs {
+		for _, name := range []string{"out.csv", "out.tsv", "out.json", "out.csv.gz"} {
+			ctx := newCtx(t)
+			ctx.AssignGlobal("db", eval(t, ctx, `sql.open["`+uri+`";..[MaxOpenConns:1]]`))
+			ctx.AssignGlobal("path", goal.NewS(filepath.Join(t.TempDir(), name)))
+			eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id INTEGER, s VARCHAR, x DOUBLE)"]`)
+			eval(t, ctx, `sql.exec[db;"INSERT INTO t VALUES (1, 'a', 1.5), (2, 'say \"hi\"', NULL)"]`)
+
+			_, n := execResult(t, ctx, eval(t, ctx, `sql.write[db;"SELECT * FROM t ORDER BY id;";path]`))
+			if n != 2 {
+				t.Errorf("%s %s: expected 2 rows written, got %d", uri, name, n)
+			}
+			eval(t, ctx, `sql.read[db;path;..[Table:"back"]]`)
+			v := eval(t, ctx, `db sql.q "SELECT * FROM back ORDER BY id"`)
+			if got := strCol(t, ctx, v, "s"); len(got) != 2 || got[1] != `say "hi"` {
+				t.Errorf("%s %s: s: got %q", uri, name, got)
+			}
+			if got := dictLookup(t, ctx, mustDict(t, ctx, v), "x").Sprint(ctx, true); got != "1.5 0n" {
+				t.Errorf("%s %s: x: expected 1.5 0n, got %s", uri, name, got)
+			}
+		}
+	}
+}
+
+func TestDuckDBParquet(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	ctx.AssignGlobal("path", goal.NewS(filepath.Join(t.TempDir(), "r.parquet")))
+	eval(t, ctx, `sql.write[db;"SELECT range AS i, range::VARCHAR AS s FROM range(100)";path]`)
+	if got := mustS(t, eval(t, ctx, `db sql.read path`)); got != "r" {
+		t.Fatalf("expected table r, got %s", got)
+	}
+	if n := mustI(t, eval(t, ctx, `*(db sql.q "SELECT sum(i) AS n FROM r")"n"`)); n != 4950 {
+		t.Errorf("expected sum 4950, got %d", n)
+	}
+}
+
+func TestReadWriteErrors(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	ctx.AssignGlobal("dir", goal.NewS(t.TempDir()))
+	for _, tt := range []struct{ src, want string }{
+		{`db sql.read dir,"/missing.csv"`, "no such file"},
+		{`db sql.read dir,"/data.xlsx"`, "Format option"},
+		{`db sql.read dir,"/data.parquet"`, "needs a DuckDB connection"},
+		{`sql.write[db;"SELECT 1";dir,"/x.parquet"]`, "needs a DuckDB connection"},
+		{`sql.write[db;"SELECT 1";dir,"/x.csv";..[Table:"t"]]`, "only apply to sql.read"},
+		{`sql.read[db;dir,"/x.csv";..[Delim:";;"]]`, "single character"},
+		{`sql.read[db;dir,"/x.csv";..[Format:"xml"]]`, "Format"},
+		{`sql.write[db;"SELECT nope";dir,"/x.csv"]`, "nope"},
+	} {
+		if msg := evalPanic(t, ctx, tt.src); !strings.Contains(msg, tt.want) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.src, tt.want, msg)
+		}
+	}
+
+	// New JSON keys after the first batch.
+	var sb strings.Builder
+	for range 1000 {
+		sb.WriteString("{\"a\": 1}\n")
+	}
+	sb.WriteString("{\"a\": 1, \"b\": 2}\n")
+	ctx.AssignGlobal("path", goal.NewS(writeFile(t, "late.json", sb.String())))
+	if msg := evalPanic(t, ctx, `db sql.read path`); !strings.Contains(msg, `key "b"`) {
+		t.Errorf("expected late key error, got %s", msg)
+	}
+	if n := mustI(t, eval(t, ctx, `#(sql.tables db)"name"`)); n != 0 {
+		t.Errorf("expected the failed read to be rolled back, got %d tables", n)
+	}
+}
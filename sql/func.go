@@ -0,0 +1,222 @@
+package sql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// sql.func  (triad: sql.func[conn;"name";f]  or  sql.func[conn;"name";f;opts])
+// ---------------------------------------------------------------------------
+
+// vfFunc registers a Goal function as a scalar SQL function of a
+// connection, so that queries can call it, e.g. in WHERE clauses, and
+// returns the name.
+//
+// Each call converts the SQL arguments to Goal values as query results do
+// (see sqlValueToGoal) and the result back as parameters are (see
+// goalScalarToSQL); a Goal error fails the query. The function takes as
+// many arguments as f's rank, unless opts give their types:
+//
+//	Args     s  – SQL types of the arguments, e.g. ("BIGINT";"VARCHAR")
+//	Returns  s  – SQL type of the result
+//	Volatile i  – the result may differ for the same arguments (0/1)
+//
+// DuckDB needs Returns, and Args default to ANY; SQLite ignores the types
+// and Volatile. Registering a name again replaces f, keeping the types.
+// Calls to Goal functions are serialised, so f must not run queries itself.
+//
+// SQLite registers functions with the driver, for every connection opened
+// afterwards in the process, so a name may only be registered on one open
+// SQLite connection at a time, and calls its Goal function from any until
+// that connection is closed, after which calling it is an error. The
+// pooled connections of conn opened before are replaced as they are
+// reused, which is refused while some are in use (by a transaction, cursor
+// or sql.rows); the connection of a private in-memory database is replaced
+// at once, its database copied over.
+//
+// Usage:
+//
+//	sql.func[db;"norm";{_x}]
+//	db sql.q "SELECT * FROM users WHERE norm(email) = 'a@b.c'"
+//	sql.func[db;"score";{[a;b]a+2*b};..[Args:("BIGINT";"BIGINT");Returns:"BIGINT"]]
+func vfFunc(ctx *goal.Context, args []goal.V) goal.V {
+	var opts funcOptions
+	switch len(args) {
+	case 3:
+		// args[0] = f, args[1] = name, args[2] = conn
+	case 4:
+		// args[0] = opts, args[1] = f, args[2] = name, args[3] = conn
+		if err := parseOptions("sql.func[conn;name;f;opts]", args[0], &opts); err != nil {
+			return goal.Panicf("%v", err)
+		}
+		args = args[1:]
+	default:
+		return goal.Panicf("sql.func[conn;name;f] : expected 3 or 4 arguments, got %d", len(args))
+	}
+	ns, ok := args[1].BV().(goal.S)
+	if !ok {
+		return goal.Panicf("sql.func[conn;name;f] : expected string name, got %q", args[1].Type())
+	}
+	name := string(ns)
+	if !isIdent(name) {
+		return goal.Panicf("sql.func[conn;name;f] : invalid function name %q", name)
+	}
+	f := args[0]
+	if !f.IsFunction() {
+		return goal.Panicf("sql.func[conn;name;f] : expected function, got %q", f.Type())
+	}
+	c, ok := args[2].BV().(*Conn)
+	if !ok {
+		return goal.Panicf("sql.func[conn;name;f] : expected sql.conn as first argument, got %q", args[2].Type())
+	}
+	if c.closed {
+		return goal.Panicf("sql.func[conn;name;f] : connection is closed")
+	}
+	if err := c.checkPool(); err != nil {
+		return goal.Panicf("sql.func[conn;name;f] : %v", err)
+	}
+	// Cached results may hold values of the function this one replaces.
+	defer c.invalidateCache()
+	nargs := f.Rank(ctx)
+	if opts.argsSet {
+		nargs = len(opts.args)
+	}
+	if nargs < 1 {
+		return goal.Panicf("sql.func %q: expected at least one argument", name)
+	}
+	fn := &goalFunc{name: name, conn: c, ctx: ctx, f: f, nargs: nargs, opts: opts}
+	old, replace := c.funcs[name]
+	if replace {
+		if old.nargs != fn.nargs || !old.opts.sameTypes(fn.opts) {
+			return goal.Panicf("sql.func %q: already registered with other argument or result types", name)
+		}
+		// The driver may hold old: f replaces it in place once registered.
+		fn = old
+	}
+
+	sch := driverSchemes[c.driver]
+	if sch.registerFunc == nil {
+		return goal.Panicf("sql.func : not supported by the %s driver", sch.driverName)
+	}
+	cctx, done := callContext(c.timeout)
+	defer done()
+	if err := sch.registerFunc(cctx, c, fn); err != nil {
+		return goal.Panicf("sql.func %q: %v", name, callErr(cctx, err))
+	}
+	if replace {
+		goalFuncMu.Lock()
+		old.ctx, old.f = ctx, f
+		goalFuncMu.Unlock()
+	}
+	if c.funcs == nil {
+		c.funcs = make(map[string]*goalFunc)
+	}
+	c.funcs[name] = fn
+	if c.pin != nil && sch.staleConn != nil && sch.staleConn(c.pin) {
+		if err := c.repin(cctx, "sql.func"); err != nil {
+			return goal.Panicf("sql.func %q: %v", name, callErr(cctx, err))
+		}
+	}
+	return goal.NewS(name)
+}
+
+// funcOptions holds the settings of sql.func parsed from an opts dict.
+type funcOptions struct {
+	args     []string // upper-cased SQL types
+	argsSet  bool
+	returns  string
+	volatile bool
+}
+
+// apply sets a single function option.
+func (opts *funcOptions) apply(key string, v goal.V) error {
+	var err error
+	switch key {
+	case "Args":
+		switch xv := v.BV().(type) {
+		case *goal.AS:
+			opts.args = make([]string, len(xv.Slice))
+			for i, t := range xv.Slice {
+				opts.args[i] = strings.ToUpper(t)
+			}
+		case *goal.AV:
+			if len(xv.Slice) > 0 {
+				return fmt.Errorf("sql option %q must be an array of strings, got %q", key, v.Type())
+			}
+			opts.args = []string{}
+		default:
+			return fmt.Errorf("sql option %q must be an array of strings, got %q", key, v.Type())
+		}
+		opts.argsSet = true
+	case "Returns":
+		opts.returns, err = stringArg(v, key)
+		opts.returns = strings.ToUpper(opts.returns)
+	case "Volatile":
+		opts.volatile, err = boolArg(v, key)
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return err
+}
+
+// sameTypes reports whether two registrations declare the same types.
+func (opts funcOptions) sameTypes(o funcOptions) bool {
+	return slices.Equal(opts.args, o.args) && opts.returns == o.returns && opts.volatile == o.volatile
+}
+
+// goalFuncMu serialises calls to Goal functions from SQL, which DuckDB may
+// make from several threads, as a Goal context is not safe for concurrent
+// use.
+var goalFuncMu sync.Mutex //nolint:gochecknoglobals // guards every registered Goal function
+
+// goalFunc is a Goal function registered with sql.func.
+type goalFunc struct {
+	name  string
+	conn  *Conn // the connection it is registered on
+	ctx   *goal.Context
+	f     goal.V
+	nargs int
+	opts  funcOptions
+}
+
+// call applies the Goal function to driver values and returns its result
+// as a driver value.
+func (fn *goalFunc) call(vals []driver.Value) (any, error) {
+	if len(vals) != fn.nargs {
+		return nil, fmt.Errorf("%s: expected %d arguments, got %d", fn.name, fn.nargs, len(vals))
+	}
+	// Goal takes the arguments in reverse order.
+	args := make([]goal.V, len(vals))
+	for i, v := range vals {
+		args[len(vals)-1-i] = sqlValueToGoal(v)
+	}
+
+	goalFuncMu.Lock()
+	defer goalFuncMu.Unlock()
+	var r goal.V
+	if len(args) == 1 {
+		r = fn.f.ApplyAt(fn.ctx, args[0])
+	} else {
+		r = fn.ctx.ApplyN(fn.f, args)
+	}
+	if r.IsPanic() {
+		return nil, fmt.Errorf("%s: %s", fn.name, r.Sprint(fn.ctx, false))
+	}
+	x, err := goalScalarToSQL(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: result: %w", fn.name, err)
+	}
+	if _, ok := x.(listArg); ok || isNested(x) {
+		return nil, fmt.Errorf("%s: result: expected a single value, got %q", fn.name, r.Type())
+	}
+	if b, ok := x.(int64); ok && fn.opts.returns == "BOOLEAN" {
+		return b != 0, nil
+	}
+	return x, nil
+}
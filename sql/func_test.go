@@ -0,0 +1,165 @@
+package sql_test
+
+import (
+	"strings"
+	"testing"
+)
+
+// ---------------------------------------------------------------------------
+// TestFunc
+// ---------------------------------------------------------------------------
+
+func TestFuncSQLite(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	if got := mustS(t, eval(t, ctx, `sql.func[db;"norm";{_x}]`)); got != "norm" {
+		t.Fatalf("expected norm, got %s", got)
+	}
+	eval(t, ctx, `sql.func[db;"score";{[a;b]a+2*b}]`)
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE users (id INTEGER, email TEXT, a INTEGER, b REAL)"]`)
+	eval(t, ctx, `sql.exec[db;"INSERT INTO users VALUES (1, 'Ann@X.org', 1, 0.5), (2, 'bob@y.org', 2, 1.5)"]`)
+
+	v := eval(t, ctx, `db sql.q "SELECT id FROM users WHERE norm(email) = 'ann@x.org'"`)
+	if got := dictLookup(t, ctx, mustDict(t, ctx, v), "id").Sprint(ctx, true); got != ",1" {
+		t.Errorf("WHERE: expected ,1, got %s", got)
+	}
+	v = eval(t, ctx, `db sql.q "SELECT score(a, b) AS s FROM users ORDER BY id"`)
+	if got := dictLookup(t, ctx, mustDict(t, ctx, v), "s").Sprint(ctx, true); got != "2.0 5.0" {
+		t.Errorf("score: expected 2.0 5.0, got %s", got)
+	}
+
+	// Registering a name again replaces the function.
+	eval(t, ctx, `sql.func[db;"norm";{uc x}]`)
+	if n := mustI(t, eval(t, ctx, `*(db sql.q "SELECT count(*) AS n FROM users WHERE norm(email) = 'ANN@X.ORG'")"n"`)); n != 1 {
+		t.Errorf("replaced: expected 1 row, got %d", n)
+	}
+
+	// The pooled connections are replaced, keeping the in-memory database.
+	eval(t, ctx, `sql.func[db;"late";{x+1}]`)
+	if n := mustI(t, eval(t, ctx, `*(db sql.q "SELECT sum(late(a)) AS n FROM users")"n"`)); n != 5 {
+		t.Errorf("late: expected 5, got %d", n)
+	}
+
+	// Another open connection may not take over the name until db closes.
+	ctx.AssignGlobal("db2", openMem(t, ctx))
+	if msg := evalPanic(t, ctx, `sql.func[db2;"norm";{x}]`); !strings.Contains(msg, "another open SQLite connection") {
+		t.Errorf("expected name in use error, got %s", msg)
+	}
+	eval(t, ctx, `sql.close db`)
+	// Closing db unbinds its functions.
+	if msg := evalPanic(t, ctx, `db2 sql.q "SELECT norm('a') AS s"`); !strings.Contains(msg, "closed") {
+		t.Errorf("expected unbound function error, got %s", msg)
+	}
+	eval(t, ctx, `sql.func[db2;"norm";{x}]`)
+	eval(t, ctx, `sql.close db2`)
+}
+
+func TestFuncSQLiteInUse(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	defer eval(t, ctx, `sql.close db`)
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (x INTEGER)"]`)
+	ctx.AssignGlobal("tx", eval(t, ctx, `sql.begin db`))
+	if msg := evalPanic(t, ctx, `sql.func[db;"inuse";{x}]`); !strings.Contains(msg, "in use") {
+		t.Errorf("expected in use error, got %s", msg)
+	}
+	eval(t, ctx, `sql.rollback tx`)
+	eval(t, ctx, `sql.func[db;"inuse";{3*x}]`)
+	if n := mustI(t, eval(t, ctx, `*(db sql.q "SELECT inuse(2) AS n")"n"`)); n != 6 {
+		t.Errorf("expected 6, got %d", n)
+	}
+	// A failed registration leaves the function in place.
+	ctx.AssignGlobal("tx", eval(t, ctx, `sql.begin db`))
+	evalPanic(t, ctx, `sql.func[db;"inuse";{4*x}]`)
+	if n := mustI(t, eval(t, ctx, `*(tx sql.q "SELECT inuse(2) AS n")"n"`)); n != 6 {
+		t.Errorf("after a failed replacement: expected 6, got %d", n)
+	}
+	eval(t, ctx, `sql.rollback tx`)
+}
+
+func TestFuncSQLiteFile(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", eval(t, ctx, `sql.open "sqlite://`+t.TempDir()+`/f.db"`))
+	defer eval(t, ctx, `sql.close db`)
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (x INTEGER)"]`)
+	eval(t, ctx, `sql.exec[db;"INSERT INTO t VALUES (1), (2), (3)"]`)
+	// The connections opened before are replaced.
+	eval(t, ctx, `sql.func[db;"twice";{2*x}]`)
+	if n := mustI(t, eval(t, ctx, `*(db sql.q "SELECT sum(twice(x)) AS n FROM t")"n"`)); n != 12 {
+		t.Errorf("expected 12, got %d", n)
+	}
+}
+
+func TestFuncSQLiteRegistered(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	defer eval(t, ctx, `sql.close db`)
+	eval(t, ctx, `sql.register[db;"reg";..[x:1 2 3]]`)
+	// The connection of the registered table is replaced, keeping it.
+	eval(t, ctx, `sql.func[db;"thrice";{3*x}]`)
+	if n := mustI(t, eval(t, ctx, `*(db sql.q "SELECT sum(thrice(x)) AS n FROM reg")"n"`)); n != 18 {
+		t.Errorf("expected 18, got %d", n)
+	}
+}
+
+func TestFuncDuckDB(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE users (id INTEGER, email VARCHAR, a BIGINT, b DOUBLE)"]`)
+	eval(t, ctx, `sql.exec[db;"INSERT INTO users VALUES (1, 'Ann@X.org', 1, 0.5), (2, 'bob@y.org', 2, 1.5)"]`)
+	eval(t, ctx, `sql.func[db;"norm";{_x};..[Returns:"VARCHAR"]]`)
+	eval(t, ctx, `sql.func[db;"score";{[a;b]a+2*b};..[Args:("BIGINT";"DOUBLE");Returns:"DOUBLE"]]`)
+	eval(t, ctx, `sql.func[db;"big";{x>1};..[Args:,"BIGINT";Returns:"BOOLEAN"]]`)
+
+	v := eval(t, ctx, `db sql.q "SELECT id FROM users WHERE norm(email) = 'ann@x.org'"`)
+	if got := dictLookup(t, ctx, mustDict(t, ctx, v), "id").Sprint(ctx, true); got != ",1" {
+		t.Errorf("WHERE: expected ,1, got %s", got)
+	}
+	v = eval(t, ctx, `db sql.q "SELECT score(a, b) AS s FROM users WHERE big(a)"`)
+	if got := dictLookup(t, ctx, mustDict(t, ctx, v), "s").Sprint(ctx, true); got != ",5.0" {
+		t.Errorf("score: expected ,5.0, got %s", got)
+	}
+
+	eval(t, ctx, `sql.func[db;"norm";{uc x};..[Returns:"VARCHAR"]]`)
+	if got := strCol(t, ctx, eval(t, ctx, `db sql.q "SELECT norm('a') AS s"`), "s"); len(got) != 1 || got[0] != "A" {
+		t.Errorf("replaced: got %q", got)
+	}
+	if msg := evalPanic(t, ctx, `sql.func[db;"norm";{_x};..[Returns:"BLOB"]]`); !strings.Contains(msg, "already registered") {
+		t.Errorf("expected type change error, got %s", msg)
+	}
+}
+
+func TestFuncErrors(t *testing.T) {
+	for _, uri := range []string{"sqlite://:memory:", "duckdb://"} {
+		ctx := newCtx(t)
+		ctx.AssignGlobal("db", eval(t, ctx, `sql.open["`+uri+`";..[MaxOpenConns:1]]`))
+		eval(t, ctx, `sql.func[db;"fails";{panic "bad: ",x};..[Args:,"VARCHAR";Returns:"VARCHAR"]]`)
+		eval(t, ctx, `sql.func[db;"arr";{x,x};..[Args:,"BIGINT";Returns:"BIGINT"]]`)
+		for _, tt := range []struct{ src, want string }{
+			{`db sql.q "SELECT fails('x')"`, "bad: x"},
+			{`db sql.q "SELECT arr(1)"`, "single value"},
+			{`sql.func[db;"f";1]`, "expected function"},
+			{`sql.func[db;"no such";{x}]`, "invalid function name"},
+			{`sql.func[db;"f";{x};..[Args:1]]`, "array of strings"},
+			{`sql.func[db;"f";{x};..[Nope:1]]`, "unknown option"},
+			{`sql.tx[db;{[tx] sql.func[tx;"f";{x}]}]`, "expected sql.conn"},
+		} {
+			if msg := evalPanic(t, ctx, tt.src); !strings.Contains(msg, tt.want) {
+				t.Errorf("%s: %s: expected error containing %q, got %s", uri, tt.src, tt.want, msg)
+			}
+		}
+		eval(t, ctx, `sql.close db`)
+	}
+
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	for _, tt := range []struct{ src, want string }{
+		{`sql.func[db;"f";{x}]`, "Returns"},
+		{`sql.func[db;"f";{x};..[Returns:"ANY"]]`, "ANY"},
+		{`sql.func[db;"f";{x};..[Args:,"JSON";Returns:"BIGINT"]]`, "unsupported type"},
+	} {
+		if msg := evalPanic(t, ctx, tt.src); !strings.Contains(msg, tt.want) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.src, tt.want, msg)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// sql.insert  (triad: sql.insert[conn;"table";t])
+// ---------------------------------------------------------------------------
+
+// vfInsert inserts every row of a columnar dict into a table and returns an
+// exec-result dict whose rowsAffected is the number of rows inserted.
+//
+// The dict has the same shape as a sql.q result: column name strings (AS)
+// mapped to equal-length column arrays. Columns are matched to table columns
+// by name.
+//
+// On a DuckDB sql.conn whose column names match the table's columns in order,
+// rows are loaded with the DuckDB Appender API. Otherwise a single prepared
+// INSERT statement is executed once per row. Either way the rows are inserted
+// inside a transaction (the caller's transaction when conn is a sql.tx), so
+// the insert is all-or-nothing.
+//
+// Usage:
+//
+//	t: src sql.q "SELECT * FROM users"
+//	sql.insert[dst;"users";t]
+func vfInsert(_ *goal.Context, args []goal.V) goal.V {
+	if len(args) != 3 {
+		return goal.Panicf("sql.insert[conn;table;t] : expected 3 arguments, got %d", len(args))
+	}
+	// args[0] = t, args[1] = table, args[2] = conn
+	ts, ok := args[1].BV().(goal.S)
+	if !ok {
+		return goal.Panicf("sql.insert[conn;table;t] : expected string table name, got %q", args[1].Type())
+	}
+	table := string(ts)
+	names, cols, nrows, err := parseTable("sql.insert[conn;table;t]", args[0])
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+
+	c := connOf(args[2])
+	if c == nil {
+		return goal.Panicf("sql.insert[conn;table;t] : expected sql.conn or sql.tx as first argument, got %q", args[2].Type())
+	}
+	defer c.invalidateCache()
+	ctx, done := callContext(c.timeout)
+	defer done()
+
+	var res execSummary
+	start := time.Now()
+	switch bv := args[2].BV().(type) {
+	case *Conn:
+		if bv.closed {
+			return goal.Panicf("sql.insert[conn;table;t] : connection is closed")
+		}
+		if err := bv.checkPool(); err != nil {
+			return goal.Panicf("sql.insert[conn;table;t] : %v", err)
+		}
+		res, err = insertConn(ctx, bv, table, names, cols, nrows)
+	case *GoalTx:
+		if bv.done {
+			return goal.Panicf("sql.insert[conn;table;t] : transaction is closed")
+		}
+		res, err = insertRows(ctx, driverSchemes[c.driver], bv.tx, table, names, cols, nrows)
+	}
+	c.observe(stmtEvent{verb: "sql.insert", query: "INSERT INTO " + quoteIdent(table), rows: res.rowsAffected, elapsed: time.Since(start), err: err})
+	if err != nil {
+		return goal.Panicf("sql.insert %q: %v", table, callErr(ctx, err))
+	}
+	return res.dict()
+}
+
+// execSummary accumulates the results of one or more executed statements.
+type execSummary struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+// add records the result of one executed statement.
+func (s *execSummary) add(res stdsql.Result) {
+	if id, err := res.LastInsertId(); err == nil {
+		s.lastInsertID = id
+	}
+	if n, err := res.RowsAffected(); err == nil {
+		s.rowsAffected += n
+	}
+}
+
+// dict returns the summary as an ExecResult dict.
+func (s execSummary) dict() goal.V {
+	keys := goal.NewAS([]string{"lastInsertId", "rowsAffected"})
+	vals := goal.NewAI([]int64{s.lastInsertID, s.rowsAffected})
+	return goal.NewD(keys, vals)
+}
+
+// insertConn inserts rows through a connection, preferring the driver's bulk
+// loading path when one is available.
+func insertConn(ctx context.Context, c *Conn, table string, names []string, cols []goal.V, nrows int) (execSummary, error) {
+	if nrows == 0 {
+		return execSummary{}, nil
+	}
+	sch := driverSchemes[c.driver]
+	// The Appender finds no TEMP table, such as a registered one.
+	if _, registered := c.registered[table]; sch.appendRows != nil && !registered {
+		tableCols, err := tableColumnNames(ctx, c.target(), table)
+		if err != nil {
+			return execSummary{}, err
+		}
+		if equalFoldAll(tableCols, names) {
+			conn, release, err := c.conn(ctx)
+			if err != nil {
+				return execSummary{}, err
+			}
+			defer release()
+			if err := sch.appendRows(ctx, conn, table, cols, nrows); err != nil {
+				return execSummary{}, err
+			}
+			return execSummary{rowsAffected: int64(nrows)}, nil
+		}
+	}
+
+	tx, err := c.target().BeginTx(ctx, nil)
+	if err != nil {
+		return execSummary{}, fmt.Errorf("begin: %w", err)
+	}
+	res, err := insertRows(ctx, sch, tx, table, names, cols, nrows)
+	if err != nil {
+		_ = tx.Rollback()
+		return execSummary{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return execSummary{}, fmt.Errorf("commit: %w", err)
+	}
+	return res, nil
+}
+
+// insertRows executes a prepared INSERT once per row of cols.
+func insertRows(ctx context.Context, sch driverScheme, tx *stdsql.Tx, table string, names []string, cols []goal.V, nrows int) (execSummary, error) {
+	var res execSummary
+	if nrows == 0 {
+		return res, nil
+	}
+	stmt, err := tx.PrepareContext(ctx, insertSQL(sch, table, names))
+	if err != nil {
+		return res, err
+	}
+	defer stmt.Close()
+
+	row := make([]any, len(cols))
+	for i := range nrows {
+		for j, col := range cols {
+			v, err := columnValue(col, i)
+			if err != nil {
+				return res, fmt.Errorf("row %d, column %q: %w", i, names[j], err)
+			}
+			row[j] = v
+		}
+		r, err := stmt.ExecContext(ctx, row...)
+		if err != nil {
+			return res, fmt.Errorf("row %d: %w", i, err)
+		}
+		res.add(r)
+	}
+	return res, nil
+}
+
+// insertSQL returns an INSERT statement for one row of the named columns,
+// with the driver's placeholders.
+func insertSQL(sch driverScheme, table string, names []string) string {
+	quoted := make([]string, len(names))
+	marks := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteName(name)
+		marks[i] = "?"
+	}
+	return sch.positional(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		quoteIdent(table), strings.Join(quoted, ", "), strings.Join(marks, ", ")))
+}
+
+// tableColumnNames returns the column names of table, in table order.
+func tableColumnNames(ctx context.Context, q querier, table string) ([]string, error) {
+	rows, err := q.QueryContext(ctx, "SELECT * FROM "+quoteIdent(table)+" LIMIT 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return rows.Columns()
+}
+
+// equalFoldAll reports whether xs and ys hold the same strings in the same
+// order, ignoring case (SQL identifiers are case-insensitive unless quoted).
+func equalFoldAll(xs, ys []string) bool {
+	if len(xs) != len(ys) {
+		return false
+	}
+	for i := range xs {
+		if !strings.EqualFold(xs[i], ys[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteIdent quotes a possibly schema-qualified table name, e.g.
+// main.t → "main"."t".
+func quoteIdent(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = quoteName(p)
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteName quotes a single SQL identifier, such as a column name, which
+// may hold dots (e.g. price.usd → "price.usd").
+func quoteName(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// ---------------------------------------------------------------------------
+// Columnar dict (table) helpers
+// ---------------------------------------------------------------------------
+
+// parseTable validates a columnar dict and returns its column names, column
+// arrays and row count.
+func parseTable(verb string, v goal.V) ([]string, []goal.V, int, error) {
+	d, ok := v.BV().(*goal.D)
+	if !ok {
+		return nil, nil, 0, fmt.Errorf("%s : expected columnar dict, got %q", verb, v.Type())
+	}
+	kas, ok := d.KeyArray().(*goal.AS)
+	if !ok {
+		return nil, nil, 0, fmt.Errorf("%s : column names must be strings, got %q", verb, d.KeyArray().Type())
+	}
+	vav, ok := d.ValueArray().(*goal.AV)
+	if !ok {
+		return nil, nil, 0, fmt.Errorf("%s : expected dict of column arrays, got values of type %q", verb, d.ValueArray().Type())
+	}
+	nrows := -1
+	for i, col := range vav.Slice {
+		n, ok := columnLen(col)
+		if !ok {
+			return nil, nil, 0, fmt.Errorf("%s : column %q is not an array (got %q)", verb, kas.Slice[i], col.Type())
+		}
+		if nrows >= 0 && n != nrows {
+			return nil, nil, 0, fmt.Errorf("%s : column %q has length %d, expected %d", verb, kas.Slice[i], n, nrows)
+		}
+		nrows = n
+	}
+	if nrows < 0 {
+		nrows = 0
+	}
+	return kas.Slice, vav.Slice, nrows, nil
+}
+
+// columnLen returns the length of a column array, or false if col is not an
+// array type usable as a column.
+func columnLen(col goal.V) (int, bool) {
+	switch xv := col.BV().(type) {
+	case *goal.AI:
+		return len(xv.Slice), true
+	case *goal.AF:
+		return len(xv.Slice), true
+	case *goal.AS:
+		return len(xv.Slice), true
+	case *goal.AB:
+		return len(xv.Slice), true
+	case *goal.AV:
+		return len(xv.Slice), true
+	case *Times:
+		return len(xv.micros), true
+	}
+	return 0, false
+}
+
+// columnValue returns element i of a column array as a SQL argument, with
+// the same conversions as goalToSQLArgs.
+func columnValue(col goal.V, i int) (any, error) {
+	switch xv := col.BV().(type) {
+	case *goal.AI:
+		return xv.Slice[i], nil
+	case *goal.AF:
+		if math.IsNaN(xv.Slice[i]) {
+			return nil, nil //nolint:nilnil // nil value represents SQL NULL; nil error means no failure
+		}
+		return xv.Slice[i], nil
+	case *goal.AS:
+		return xv.Slice[i], nil
+	case *goal.AB:
+		return int64(xv.Slice[i]), nil
+	case *goal.AV:
+		return goalScalarToSQL(xv.Slice[i])
+	case *Times:
+		if t, ok := xv.timeAt(i); ok {
+			return t, nil
+		}
+		return nil, nil //nolint:nilnil // nil value represents SQL NULL; nil error means no failure
+	}
+	return nil, fmt.Errorf("unsupported column type %q", col.Type())
+}
@@ -0,0 +1,164 @@
+package sql_test
+
+import (
+	"math"
+	"testing"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// TestInsertRoundTrip
+// ---------------------------------------------------------------------------
+
+func TestInsertRoundTrip(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("src", openMem(t, ctx))
+	ctx.AssignGlobal("dst", openMem(t, ctx))
+
+	eval(t, ctx, `sql.exec[src;"CREATE TABLE users (id INTEGER, name TEXT, score REAL)"]`)
+	eval(t, ctx, `sql.exec[src;"INSERT INTO users VALUES (1,'Alice',9.5),(2,'Bob',7.25),(3,'Carol',8.0)"]`)
+	eval(t, ctx, `sql.exec[dst;"CREATE TABLE users (id INTEGER, name TEXT, score REAL)"]`)
+
+	v := eval(t, ctx, `sql.insert[dst;"users";sql.q[src;"SELECT * FROM users"]]`)
+	_, rowsAff := execResult(t, ctx, v)
+	if rowsAff != 3 {
+		t.Fatalf("sql.insert: expected rowsAffected=3, got %d", rowsAff)
+	}
+
+	d := mustDict(t, ctx, eval(t, ctx, `sql.q[dst;"SELECT id, name, score FROM users ORDER BY id"]`))
+	names, ok := dictLookup(t, ctx, d, "name").BV().(*goal.AS)
+	if !ok || len(names.Slice) != 3 || names.Slice[2] != "Carol" {
+		t.Fatalf("name column: expected [Alice Bob Carol], got %v", dictLookup(t, ctx, d, "name").Sprint(ctx, true))
+	}
+	scores, ok := dictLookup(t, ctx, d, "score").BV().(*goal.AF)
+	if !ok || scores.Slice[1] != 7.25 {
+		t.Fatalf("score column: expected AF with 7.25, got %v", dictLookup(t, ctx, d, "score").Sprint(ctx, true))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// TestInsertGoalTable
+// ---------------------------------------------------------------------------
+
+func TestInsertGoalTable(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id INTEGER, v REAL, extra TEXT)"]`)
+
+	// Columns are matched by name, so a subset in any order is fine; 0n
+	// becomes NULL.
+	eval(t, ctx, `sql.insert[db;"t";..[v:1.5 0n;id:1 2]]`)
+
+	d := mustDict(t, ctx, eval(t, ctx, `sql.q[db;"SELECT v FROM t ORDER BY id"]`))
+	vs, ok := dictLookup(t, ctx, d, "v").BV().(*goal.AF)
+	if !ok || len(vs.Slice) != 2 || vs.Slice[0] != 1.5 || !math.IsNaN(vs.Slice[1]) {
+		t.Fatalf("v column: expected 1.5 0n, got %v", dictLookup(t, ctx, d, "v").Sprint(ctx, true))
+	}
+}
+
+func TestInsertBadTable(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id INTEGER, v REAL)"]`)
+
+	evalPanic(t, ctx, `sql.insert[db;"t";..[id:1 2;v:,1.5]]`) // ragged columns
+	evalPanic(t, ctx, `sql.insert[db;"t";1 2 3]`)             // not a dict
+	evalPanic(t, ctx, `sql.insert[db;"missing";..[id:1 2]]`)  // no such table
+}
+
+// ---------------------------------------------------------------------------
+// TestInsertAtomic
+// ---------------------------------------------------------------------------
+
+func TestInsertAtomic(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id INTEGER PRIMARY KEY)"]`)
+
+	// The duplicate key on the third row rolls back the first two.
+	evalPanic(t, ctx, `sql.insert[db;"t";..[id:1 2 2]]`)
+
+	v := eval(t, ctx, `sql.q[db;"SELECT id FROM t"]`)
+	ids, ok := dictLookup(t, ctx, mustDict(t, ctx, v), "id").BV().(*goal.AI)
+	if !ok || len(ids.Slice) != 0 {
+		t.Fatalf("after failed insert: expected empty table, got %v", v.Sprint(ctx, true))
+	}
+}
+
+func TestInsertDottedColumns(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id INTEGER, \"price.usd\" REAL)"]`)
+
+	// A column name holding a dot is one identifier, not schema.column.
+	eval(t, ctx, `sql.insert[db;"t";("price.usd";"id")!(1.5 2.5;1 2)]`)
+	v := eval(t, ctx, `+/sql.q[db;"SELECT * FROM t"]"price.usd"`)
+	if !v.IsF() || v.F() != 4 {
+		t.Fatalf("price.usd: expected sum 4.0, got %s", v.Sprint(ctx, true))
+	}
+}
+
+func TestInsertInTx(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id INTEGER)"]`)
+
+	eval(t, ctx, `sql.tx[db;{[tx] sql.insert[tx;"t";..[id:1 2 3]]}]`)
+
+	v := eval(t, ctx, `#sql.q[db;"SELECT id FROM t"]"id"`)
+	if mustI(t, v) != 3 {
+		t.Fatalf("insert in tx: expected 3 rows, got %v", v.Sprint(ctx, true))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// TestDuckDBInsert
+// ---------------------------------------------------------------------------
+
+func TestDuckDBInsertAppender(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id INTEGER, name VARCHAR)"]`)
+
+	// Columns match the table in order: loaded through the Appender.
+	v := eval(t, ctx, `sql.insert[db;"t";..[id:1 2 3;name:("a";"b";"c")]]`)
+	_, rowsAff := execResult(t, ctx, v)
+	if rowsAff != 3 {
+		t.Fatalf("sql.insert: expected rowsAffected=3, got %d", rowsAff)
+	}
+
+	q := eval(t, ctx, `sql.q[db;"SELECT id, name FROM t ORDER BY id"]`)
+	ids, ok := dictLookup(t, ctx, mustDict(t, ctx, q), "id").BV().(*goal.AI)
+	if !ok || len(ids.Slice) != 3 || ids.Slice[2] != 3 {
+		t.Fatalf("id column: expected 1 2 3, got %v", q.Sprint(ctx, true))
+	}
+}
+
+func TestDuckDBInsertSubset(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id INTEGER, name VARCHAR)"]`)
+
+	// A column subset cannot use the Appender; the prepared-statement path
+	// fills the remaining columns with NULL.
+	eval(t, ctx, `sql.insert[db;"t";..[id:1 2]]`)
+
+	v := eval(t, ctx, `sql.q[db;"SELECT count(*) AS n FROM t WHERE name IS NULL"]`)
+	ns, ok := dictLookup(t, ctx, mustDict(t, ctx, v), "n").BV().(*goal.AI)
+	if !ok || len(ns.Slice) != 1 || ns.Slice[0] != 2 {
+		t.Fatalf("expected 2 rows with NULL name, got %v", v.Sprint(ctx, true))
+	}
+}
+
+func TestDuckDBInsertAppenderAtomic(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id INTEGER, name VARCHAR)"]`)
+
+	// The string on the third row fails the Appender: no row is kept.
+	evalPanic(t, ctx, `sql.insert[db;"t";..[id:(1;2;"x");name:("a";"b";"c")]]`)
+	if n := mustI(t, eval(t, ctx, `*sql.q[db;"SELECT count(*) AS n FROM t"]"n"`)); n != 0 {
+		t.Fatalf("after failed insert: expected empty table, got %d rows", n)
+	}
+}
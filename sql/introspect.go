@@ -0,0 +1,146 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// Schema introspection: sql.tables, sql.columns, sql.indexes
+// ---------------------------------------------------------------------------
+
+// connScheme resolves a sql.conn or sql.tx to a querier and the driver
+// description of its connection.
+func connScheme(verb string, v goal.V) (querier, driverScheme, error) {
+	q, _, isOpen := toQuerier(v)
+	if q == nil {
+		return nil, driverScheme{}, fmt.Errorf("%s : expected sql.conn or sql.tx, got %q", verb, v.Type())
+	}
+	if !isOpen {
+		return nil, driverScheme{}, fmt.Errorf("%s : connection or transaction is closed", verb)
+	}
+	if c, ok := v.BV().(*Conn); ok {
+		if err := c.checkPool(); err != nil {
+			return nil, driverScheme{}, fmt.Errorf("%s : %w", verb, err)
+		}
+	}
+	return q, driverSchemes[connOf(v).driver], nil
+}
+
+// introspect runs one of a scheme's introspection queries for verb on the
+// connection of conn and returns its result as a QueryResult dict.
+func introspect(verb string, q querier, conn goal.V, query string, args ...any) (goal.V, error) {
+	c := connOf(conn)
+	if query == "" {
+		return goal.V{}, fmt.Errorf("not supported by the %s driver", c.driver)
+	}
+	ctx, done := callContext(c.timeout)
+	defer done()
+	start := time.Now()
+	result, err := introspectQuery(ctx, q, query, args, queryOptions{scanValue: driverSchemes[c.driver].scanValue})
+	c.observe(stmtEvent{verb: verb, query: query, args: args, rows: resultRows(result), elapsed: time.Since(start), err: err})
+	if err != nil {
+		return goal.V{}, callErr(ctx, err)
+	}
+	return result, nil
+}
+
+// introspectQuery runs query and scans its rows.
+func introspectQuery(ctx context.Context, q querier, query string, args []any, opts queryOptions) (goal.V, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return goal.V{}, err
+	}
+	defer rows.Close()
+	return scanRows(rows, opts)
+}
+
+// splitTableName splits "schema.table" into its parts; an unqualified name
+// is looked up in the driver's default schema, or "main" (the default in
+// SQLite and DuckDB).
+func splitTableName(sch driverScheme, name string) (string, string) {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	if sch.defaultSchema != "" {
+		return sch.defaultSchema, name
+	}
+	return "main", name
+}
+
+// vfTables lists the tables and views of a database.
+//
+// Returns a columnar dict with columns "schema", "name" and "type" ("table"
+// or "view").
+//
+// Usage:
+//
+//	sql.tables db
+func vfTables(_ *goal.Context, args []goal.V) goal.V {
+	if len(args) != 1 {
+		return goal.Panicf("sql.tables db : expected 1 argument, got %d", len(args))
+	}
+	q, sch, err := connScheme("sql.tables db", args[0])
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	result, err := introspect("sql.tables", q, args[0], sch.tablesSQL)
+	if err != nil {
+		return goal.Panicf("sql.tables db : %v", err)
+	}
+	return result
+}
+
+// vfColumns lists the columns of a table, in table order.
+//
+// Returns a columnar dict with columns "name", "type", "nullable" (1/0),
+// "default" (default expression as text, or 0n) and "pk" (1 for primary key
+// columns).
+//
+// Usage:
+//
+//	db sql.columns "users"
+//	sql.columns[db;"main.users"]
+func vfColumns(_ *goal.Context, args []goal.V) goal.V {
+	return tableIntrospection("sql.columns", "db sql.columns table", args, func(sch driverScheme) string { return sch.columnsSQL })
+}
+
+// vfIndexes lists the indexes of a table.
+//
+// Returns a columnar dict with columns "name", "unique" (1/0), "primary"
+// (1 for the primary key index) and "columns" (comma-separated indexed
+// columns or expressions).
+//
+// Usage:
+//
+//	db sql.indexes "users"
+func vfIndexes(_ *goal.Context, args []goal.V) goal.V {
+	return tableIntrospection("sql.indexes", "db sql.indexes table", args, func(sch driverScheme) string { return sch.indexesSQL })
+}
+
+// tableIntrospection implements the dyadic per-table introspection verbs;
+// usage is the verb's usage, for errors.
+func tableIntrospection(verb, usage string, args []goal.V, query func(driverScheme) string) goal.V {
+	if len(args) != 2 {
+		return goal.Panicf("%s : expected 2 arguments, got %d", usage, len(args))
+	}
+	// args[0] = table (right), args[1] = conn (left)
+	ts, ok := args[0].BV().(goal.S)
+	if !ok {
+		return goal.Panicf("%s : expected string table name, got %q", usage, args[0].Type())
+	}
+	q, sch, err := connScheme(usage, args[1])
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	schema, table := splitTableName(sch, string(ts))
+	result, err := introspect(verb, q, args[1], query(sch), table, schema)
+	if err != nil {
+		return goal.Panicf("%s : %v", usage, err)
+	}
+	return result
+}
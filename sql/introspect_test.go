@@ -0,0 +1,105 @@
+package sql_test
+
+import (
+	"strings"
+	"testing"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// strCol returns a string column of a columnar dict.
+func strCol(t *testing.T, ctx *goal.Context, v goal.V, key string) []string {
+	t.Helper()
+	col := dictLookup(t, ctx, mustDict(t, ctx, v), key)
+	as, ok := col.BV().(*goal.AS)
+	if !ok {
+		t.Fatalf("%s column: expected AS, got %q (%s)", key, col.Type(), col.Sprint(ctx, true))
+	}
+	return as.Slice
+}
+
+// introspectSchema creates the tables shared by the introspection tests.
+func introspectSchema(t *testing.T, ctx *goal.Context) {
+	t.Helper()
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE users (id INTEGER PRIMARY KEY, name VARCHAR NOT NULL, email VARCHAR DEFAULT 'none')"]`)
+	eval(t, ctx, `sql.exec[db;"CREATE UNIQUE INDEX users_email ON users (email)"]`)
+	eval(t, ctx, `sql.exec[db;"CREATE VIEW names AS SELECT name FROM users"]`)
+}
+
+// checkIntrospection runs the checks shared by the SQLite and DuckDB tests.
+func checkIntrospection(t *testing.T, ctx *goal.Context) {
+	t.Helper()
+
+	tables := eval(t, ctx, `sql.tables db`)
+	names := strCol(t, ctx, tables, "name")
+	types := strCol(t, ctx, tables, "type")
+	if len(names) != 2 || names[0] != "names" || names[1] != "users" {
+		t.Fatalf("sql.tables name: expected [names users], got %v", names)
+	}
+	if types[0] != "view" || types[1] != "table" {
+		t.Fatalf("sql.tables type: expected [view table], got %v", types)
+	}
+
+	cols := eval(t, ctx, `db sql.columns "users"`)
+	if got := strCol(t, ctx, cols, "name"); len(got) != 3 || got[0] != "id" || got[2] != "email" {
+		t.Fatalf("sql.columns name: expected [id name email], got %v", got)
+	}
+	d := mustDict(t, ctx, cols)
+	if got := dictLookup(t, ctx, d, "nullable").Sprint(ctx, true); got != "0 0 1" && got != "1 0 1" {
+		// SQLite reports INTEGER PRIMARY KEY columns as nullable.
+		t.Errorf("sql.columns nullable: expected 0 0 1, got %s", got)
+	}
+	if got := dictLookup(t, ctx, d, "pk").Sprint(ctx, true); got != "1 0 0" {
+		t.Errorf("sql.columns pk: expected 1 0 0, got %s", got)
+	}
+
+	idx := eval(t, ctx, `db sql.indexes "users"`)
+	idxNames := strCol(t, ctx, idx, "name")
+	found := false
+	for i, name := range idxNames {
+		if name == "users_email" {
+			found = true
+			if got := strCol(t, ctx, idx, "columns")[i]; !strings.Contains(got, "email") {
+				t.Errorf("users_email columns: expected email, got %q", got)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("sql.indexes: users_email not in %v", idxNames)
+	}
+
+	if n := mustI(t, eval(t, ctx, `#(db sql.columns "missing")"name"`)); n != 0 {
+		t.Errorf("sql.columns on a missing table: expected no rows, got %d", n)
+	}
+	evalPanic(t, ctx, `sql.tables 1`)
+	evalPanic(t, ctx, `db sql.columns 1`)
+}
+
+// ---------------------------------------------------------------------------
+// TestIntrospection
+// ---------------------------------------------------------------------------
+
+func TestIntrospectionSQLite(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	introspectSchema(t, ctx)
+	checkIntrospection(t, ctx)
+}
+
+func TestIntrospectionDuckDB(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	introspectSchema(t, ctx)
+	checkIntrospection(t, ctx)
+}
+
+func TestIntrospectionInTx(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+
+	// Tables created in a transaction are visible to it before commit.
+	v := eval(t, ctx, `sql.tx[db;{[tx] sql.exec[tx;"CREATE TABLE t (x INTEGER)"]; sql.tables tx}]`)
+	if got := strCol(t, ctx, v, "name"); len(got) != 1 || got[0] != "t" {
+		t.Fatalf("sql.tables tx: expected [t], got %v", got)
+	}
+}
@@ -0,0 +1,316 @@
+package sql
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// sql.migrate  (dyad: conn sql.migrate dir  or  sql.migrate[conn;dir;opts])
+// ---------------------------------------------------------------------------
+
+// migrationsTable records the applied migrations of a database.
+const migrationsTable = "ari_schema_migrations"
+
+// migrationFile matches migration file names: NNNN_name.up.sql and
+// NNNN_name.down.sql.
+var migrationFile = regexp.MustCompile(`^([0-9]+)_(.+)\.(up|down)\.sql$`) //nolint:gochecknoglobals // compiled once
+
+// migration is one numbered migration and its up and down files ("" if
+// missing).
+type migration struct {
+	version  int64
+	name     string
+	up, down string
+}
+
+// vfMigrate brings a database schema to a given version by running the
+// migration files of a directory.
+//
+// dir is a directory path or a Goal fs value (e.g. libs or one returned by
+// subfs) holding files named NNNN_name.up.sql and NNNN_name.down.sql, where
+// NNNN is the version. Applied versions are recorded in the
+// ari_schema_migrations table. Pending up migrations are applied in version
+// order, each in its own transaction together with its bookkeeping row;
+// a failure stops there, leaving the earlier ones applied, and its error
+// lists them.
+//
+// An opts dict (see migrateOptions) sets the target version:
+//
+//	To  i  – migrate up or down to this version (default: the latest)
+//
+// Migrating down runs the down files of the applied versions above To, in
+// descending order.
+//
+// Returns a columnar dict with one row per migration run: "version",
+// "name" and "direction" ("up" or "down").
+//
+// Usage:
+//
+//	db sql.migrate "migrations"
+//	sql.migrate[db;"migrations";..[To:3]]
+func vfMigrate(_ *goal.Context, args []goal.V) goal.V {
+	var opts migrateOptions
+	switch len(args) {
+	case 2:
+		// args[0] = dir (right), args[1] = conn (left)
+	case 3:
+		// args[0] = opts, args[1] = dir, args[2] = conn
+		if err := parseOptions("sql.migrate[conn;dir;opts]", args[0], &opts); err != nil {
+			return goal.Panicf("%v", err)
+		}
+		args = args[1:]
+	default:
+		return goal.Panicf("conn sql.migrate dir : expected 2 or 3 arguments, got %d", len(args))
+	}
+	c, ok := args[1].BV().(*Conn)
+	if !ok {
+		return goal.Panicf("conn sql.migrate dir : expected sql.conn in left arg, got %q", args[1].Type())
+	}
+	if c.closed {
+		return goal.Panicf("conn sql.migrate dir : connection is closed")
+	}
+	if err := c.checkPool(); err != nil {
+		return goal.Panicf("conn sql.migrate dir : %v", err)
+	}
+	var fsys fs.FS
+	switch dir := args[0].BV().(type) {
+	case goal.S:
+		fsys = os.DirFS(string(dir))
+	case fs.FS:
+		fsys = dir
+	default:
+		return goal.Panicf("conn sql.migrate dir : expected directory path or fs value, got %q", args[0].Type())
+	}
+
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		return goal.Panicf("sql.migrate: %v", err)
+	}
+	defer c.invalidateCache()
+	ctx, done := callContext(c.timeout)
+	defer done()
+	applied, err := appliedVersions(ctx, c)
+	if err != nil {
+		return goal.Panicf("sql.migrate: %v", callErr(ctx, err))
+	}
+	target := opts.to
+	if !opts.toSet && len(migrations) > 0 {
+		target = migrations[len(migrations)-1].version
+	}
+	steps, err := migrationPlan(migrations, applied, target)
+	if err != nil {
+		return goal.Panicf("sql.migrate: %v", err)
+	}
+
+	var versions []int64
+	var names, directions, migrated []string
+	for _, st := range steps {
+		if err := runMigration(ctx, c, fsys, st.m, st.up); err != nil {
+			if len(migrated) > 0 {
+				return goal.Panicf("sql.migrate: %v (migrated before the failure: %s)", callErr(ctx, err), strings.Join(migrated, ", "))
+			}
+			return goal.Panicf("sql.migrate: %v", callErr(ctx, err))
+		}
+		versions = append(versions, st.m.version)
+		names = append(names, st.m.name)
+		directions = append(directions, st.direction())
+		migrated = append(migrated, fmt.Sprintf("%d %s", st.m.version, st.direction()))
+	}
+	keys := goal.NewAS([]string{"version", "name", "direction"})
+	vals := goal.NewAV([]goal.V{
+		goal.NewAI(nonNil(versions)),
+		goal.NewAS(nonNil(names)),
+		goal.NewAS(nonNil(directions)),
+	})
+	return goal.NewD(keys, vals)
+}
+
+// migrateOptions holds the settings of sql.migrate parsed from an opts dict.
+type migrateOptions struct {
+	to    int64 // target version
+	toSet bool
+}
+
+// apply sets a single migration option.
+func (opts *migrateOptions) apply(key string, v goal.V) error {
+	switch key {
+	case "To":
+		n, err := countArg(v, key)
+		if err != nil {
+			return err
+		}
+		opts.to, opts.toSet = int64(n), true
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// loadMigrations reads the migration files at the top of fsys, sorted by
+// version.
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*migration{}
+	for _, e := range entries {
+		sm := migrationFile.FindStringSubmatch(e.Name())
+		if sm == nil || e.IsDir() {
+			continue
+		}
+		version, err := strconv.ParseInt(sm[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid version: %w", e.Name(), err)
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &migration{version: version, name: sm[2]}
+			byVersion[version] = m
+		} else if m.name != sm[2] {
+			return nil, fmt.Errorf("version %d used by both %q and %q", version, m.name, sm[2])
+		}
+		if sm[3] == "up" {
+			m.up = e.Name()
+		} else {
+			m.down = e.Name()
+		}
+	}
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d (%s) has no .up.sql file", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b migration) int { return cmp.Compare(a.version, b.version) })
+	return migrations, nil
+}
+
+// appliedVersions creates the bookkeeping table if needed and returns the
+// versions recorded in it.
+func appliedVersions(ctx context.Context, c *Conn) (map[int64]bool, error) {
+	sch := driverSchemes[c.driver]
+	if err := c.exec(ctx, "sql.migrate", c.target(), "CREATE TABLE IF NOT EXISTS "+migrationsTable+" (version "+sch.columnType("BIGINT")+
+		" PRIMARY KEY, name "+sch.columnType("VARCHAR")+" NOT NULL, applied_at "+sch.columnType("TIMESTAMP")+
+		" DEFAULT CURRENT_TIMESTAMP)"); err != nil {
+		return nil, err
+	}
+	query := "SELECT version FROM " + migrationsTable
+	start := time.Now()
+	applied, err := scanVersions(ctx, c, query)
+	c.observe(stmtEvent{verb: "sql.migrate", query: query, rows: int64(len(applied)), elapsed: time.Since(start), err: err})
+	return applied, err
+}
+
+// scanVersions runs query, which selects migration versions, and returns
+// them.
+func scanVersions(ctx context.Context, c *Conn, query string) (map[int64]bool, error) {
+	rows, err := c.target().QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int64]bool{}
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
+
+// migrationStep is a migration to run up or down.
+type migrationStep struct {
+	m  migration
+	up bool
+}
+
+// direction returns "up" or "down".
+func (st migrationStep) direction() string {
+	if st.up {
+		return "up"
+	}
+	return "down"
+}
+
+// migrationPlan returns the steps bringing a database with the given
+// applied versions to version target: pending migrations up to target in
+// ascending order, or applied ones above target in descending order.
+func migrationPlan(migrations []migration, applied map[int64]bool, target int64) ([]migrationStep, error) {
+	known := make(map[int64]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.version] = true
+	}
+	var steps []migrationStep
+	for v := range applied {
+		if v > target && !known[v] {
+			return nil, fmt.Errorf("applied migration %d has no files to roll it back", v)
+		}
+	}
+	for i := len(migrations) - 1; i >= 0; i-- {
+		m := migrations[i]
+		if m.version > target && applied[m.version] {
+			if m.down == "" {
+				return nil, fmt.Errorf("migration %d (%s) has no .down.sql file", m.version, m.name)
+			}
+			steps = append(steps, migrationStep{m, false})
+		}
+	}
+	for _, m := range migrations {
+		if m.version <= target && !applied[m.version] {
+			steps = append(steps, migrationStep{m, true})
+		}
+	}
+	return steps, nil
+}
+
+// runMigration runs the up or down file of a migration and updates the
+// bookkeeping table, in one transaction.
+func runMigration(ctx context.Context, c *Conn, fsys fs.FS, m migration, up bool) error {
+	file := m.down
+	if up {
+		file = m.up
+	}
+	src, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return err
+	}
+	gtx, err := c.begin("sql.migrate", txOptions{})
+	if err != nil {
+		return fmt.Errorf("%s: begin: %w", file, err)
+	}
+	sch := driverSchemes[c.driver]
+	for i, stmt := range splitStatements(string(src), sch.script) {
+		if err := c.exec(ctx, "sql.migrate", gtx.tx, stmt); err != nil {
+			_ = gtx.end("sql.migrate", false)
+			return fmt.Errorf("%s: statement %d: %w", file, i, err)
+		}
+	}
+	if up {
+		err = c.exec(ctx, "sql.migrate", gtx.tx, sch.positional("INSERT INTO "+migrationsTable+" (version, name) VALUES (?, ?)"), m.version, m.name)
+	} else {
+		err = c.exec(ctx, "sql.migrate", gtx.tx, sch.positional("DELETE FROM "+migrationsTable+" WHERE version = ?"), m.version)
+	}
+	if err != nil {
+		_ = gtx.end("sql.migrate", false)
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	if err := gtx.end("sql.migrate", true); err != nil {
+		return fmt.Errorf("%s: commit: %w", file, err)
+	}
+	return nil
+}
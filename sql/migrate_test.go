@@ -0,0 +1,128 @@
+package sql_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	goal "codeberg.org/anaseto/goal"
+	goalfs "codeberg.org/anaseto/goal/io/fs"
+)
+
+// migrationFiles is a small two-version migration set.
+var migrationFiles = map[string]string{ //nolint:gochecknoglobals // test fixture
+	"0001_users.up.sql":    "CREATE TABLE users (id INTEGER PRIMARY KEY, name VARCHAR);\nINSERT INTO users VALUES (1, 'a;b');",
+	"0001_users.down.sql":  "DROP TABLE users;",
+	"0002_orders.up.sql":   "CREATE TABLE orders (id INTEGER, user_id INTEGER);",
+	"0002_orders.down.sql": "DROP TABLE orders;",
+	"README.md":            "not a migration",
+}
+
+// writeMigrations writes files to a new temporary directory and returns its
+// path.
+func writeMigrations(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// ---------------------------------------------------------------------------
+// TestMigrate
+// ---------------------------------------------------------------------------
+
+func TestMigrate(t *testing.T) {
+	for _, uri := range []string{"sqlite://:memory:", "duckdb://"} {
+		ctx := newCtx(t)
+		ctx.AssignGlobal("db", eval(t, ctx, `sql.open["`+uri+`";..[MaxOpenConns:1]]`))
+		ctx.AssignGlobal("dir", goal.NewS(writeMigrations(t, migrationFiles)))
+		tables := func() int64 {
+			return mustI(t, eval(t, ctx, `#(sql.tables db)"name"`))
+		}
+
+		// Up to the latest version.
+		v := eval(t, ctx, `db sql.migrate dir`)
+		if got := dictLookup(t, ctx, mustDict(t, ctx, v), "version").Sprint(ctx, true); got != "1 2" {
+			t.Fatalf("%s: expected versions 1 2, got %s", uri, got)
+		}
+		if got := strCol(t, ctx, v, "direction"); got[0] != "up" || got[1] != "up" {
+			t.Fatalf("%s: expected up up, got %q", uri, got)
+		}
+		if n := tables(); n != 3 {
+			t.Fatalf("%s: expected 3 tables, got %d", uri, n)
+		}
+
+		// Nothing left to do.
+		if n := mustI(t, eval(t, ctx, `#(db sql.migrate dir)"version"`)); n != 0 {
+			t.Fatalf("%s: expected no pending migrations, got %d", uri, n)
+		}
+
+		// Down to version 1, then to 0, then up to 1 again.
+		v = eval(t, ctx, `sql.migrate[db;dir;..[To:1]]`)
+		if got := strCol(t, ctx, v, "name"); len(got) != 1 || got[0] != "orders" {
+			t.Fatalf("%s: expected orders rolled back, got %q", uri, got)
+		}
+		if got := strCol(t, ctx, v, "direction"); got[0] != "down" {
+			t.Fatalf("%s: expected down, got %q", uri, got)
+		}
+		eval(t, ctx, `sql.migrate[db;dir;..[To:0]]`)
+		if n := tables(); n != 1 {
+			t.Fatalf("%s: expected only the bookkeeping table, got %d tables", uri, n)
+		}
+		eval(t, ctx, `sql.migrate[db;dir;..[To:1]]`)
+		if n := mustI(t, eval(t, ctx, `*sql.q[db;"SELECT count(*) AS n FROM ari_schema_migrations"]"n"`)); n != 1 {
+			t.Fatalf("%s: expected 1 applied version, got %d", uri, n)
+		}
+	}
+}
+
+func TestMigrateFS(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for name, src := range migrationFiles {
+		fsys[name] = &fstest.MapFile{Data: []byte(src)}
+	}
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	ctx.AssignGlobal("m", goalfs.NewFS(fsys, "m"))
+	if n := mustI(t, eval(t, ctx, `#(db sql.migrate m)"version"`)); n != 2 {
+		t.Fatalf("expected 2 migrations applied from fs value, got %d", n)
+	}
+}
+
+func TestMigrateErrors(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", eval(t, ctx, `sql.open["sqlite://:memory:";..[MaxOpenConns:1]]`))
+
+	// A failing migration is rolled back and stops the run; earlier ones
+	// stay applied.
+	ctx.AssignGlobal("dir", goal.NewS(writeMigrations(t, map[string]string{
+		"1_a.up.sql": "CREATE TABLE a (x INTEGER);",
+		"2_b.up.sql": "CREATE TABLE b (x INTEGER); INSERT INTO nope VALUES (1);",
+	})))
+	if msg := evalPanic(t, ctx, `db sql.migrate dir`); !strings.Contains(msg, "migrated before the failure: 1 up") {
+		t.Errorf("expected the applied version in the error, got %s", msg)
+	}
+	if n := mustI(t, eval(t, ctx, `#(sql.tables db)"name"`)); n != 2 {
+		t.Fatalf("expected tables a and ari_schema_migrations, got %d tables", n)
+	}
+	// No down file to roll back version 1.
+	evalPanic(t, ctx, `sql.migrate[db;dir;..[To:0]]`)
+
+	for _, files := range []map[string]string{
+		{"1_a.up.sql": "", "1_b.up.sql": ""}, // duplicate version
+		{"1_a.down.sql": ""},                 // no up file
+	} {
+		ctx.AssignGlobal("dir", goal.NewS(writeMigrations(t, files)))
+		evalPanic(t, ctx, `db sql.migrate dir`)
+	}
+	evalPanic(t, ctx, `db sql.migrate "/nonexistent/migrations"`)
+	evalPanic(t, ctx, `db sql.migrate 42`)
+	evalPanic(t, ctx, `sql.migrate[db;"x";..[To:-1]]`)
+	evalPanic(t, ctx, `sql.migrate[db;"x";..[Version:1]]`)
+}
@@ -0,0 +1,224 @@
+package sql
+
+import (
+	"cmp"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// Nested values: LIST, STRUCT and MAP
+// ---------------------------------------------------------------------------
+
+// nestedArray converts the elements of a LIST (or ARRAY) value to a Goal
+// array. As for AV columns, NULL elements are 0n and Goal normalises
+// uniform elements to AI, AF or AS.
+func nestedArray(elems []any) goal.V {
+	vals := make([]goal.V, len(elems))
+	for i, el := range elems {
+		vals[i] = sqlValueToGoal(el)
+	}
+	return goal.NewAV(vals)
+}
+
+// structDict converts a STRUCT value to a dict keyed by field name. The
+// driver returns structs as Go maps, so fields are sorted by name.
+func structDict(fields map[string]any) goal.V {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	vals := make([]any, len(names))
+	for i, name := range names {
+		vals[i] = fields[name]
+	}
+	return goal.NewD(goal.NewAS(names), nestedArray(vals))
+}
+
+// mapDict converts a MAP value to a dict whose keys keep their type (AI,
+// AF, AS, …), sorted by key.
+func mapDict(m map[any]any) goal.V {
+	keys := make([]any, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, compareKeys)
+	vals := make([]any, len(keys))
+	for i, k := range keys {
+		vals[i] = m[k]
+	}
+	return goal.NewD(nestedArray(keys), nestedArray(vals))
+}
+
+// compareKeys orders MAP keys: numbers and strings by value, other keys by
+// their printed form.
+func compareKeys(a, b any) int {
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y)
+		}
+	default:
+		if kindOf(a) == kindInt && kindOf(b) == kindInt {
+			return cmp.Compare(intValue(a), intValue(b))
+		}
+		if kindOf(a) == kindFloat && kindOf(b) == kindFloat {
+			return cmp.Compare(floatValue(a), floatValue(b))
+		}
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+// bigIntToGoal converts a HUGEINT value: an integer when it fits in 64
+// bits, a float otherwise.
+func bigIntToGoal(x *big.Int) goal.V {
+	if x.IsInt64() {
+		return goal.NewI(x.Int64())
+	}
+	f, _ := new(big.Float).SetInt(x).Float64()
+	return goal.NewF(f)
+}
+
+// uuidStrings returns the values of a UUID column, which the driver scans
+// as 16-byte slices, in their canonical text form.
+func uuidStrings(raw []any) []any {
+	out := make([]any, len(raw))
+	for i, v := range raw {
+		if b, ok := v.([]byte); ok && len(b) == 16 {
+			v = fmt.Sprintf("%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:])
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// ---------------------------------------------------------------------------
+// Nested parameters
+// ---------------------------------------------------------------------------
+
+// structArg and mapArg are the driver-side forms of a dict parameter, bound
+// as a STRUCT (string keys) or a MAP (other keys). An array parameter is a
+// []any bound as a LIST. Order is kept: field i is names[i] or keys[i].
+type (
+	structArg struct {
+		names []string
+		vals  []any
+	}
+	mapArg struct {
+		keys, vals []any
+	}
+)
+
+// arrayArg converts an array nested in the parameters to its driver-side
+// form.
+func arrayArg(v goal.V) ([]any, error) {
+	n, _ := columnLen(v)
+	out := make([]any, n)
+	for i := range out {
+		x, err := columnValue(v, i)
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %w", i, err)
+		}
+		if _, ok := x.(listArg); ok {
+			return nil, fmt.Errorf("[%d]: sql.list inside an array parameter", i)
+		}
+		out[i] = x
+	}
+	return out, nil
+}
+
+// dictArg converts a dict nested in the parameters to its driver-side form.
+func dictArg(d *goal.D) (any, error) {
+	n := d.Len()
+	vals := make([]any, n)
+	for i := range vals {
+		x, err := goalScalarToSQL(d.ValueArray().At(i))
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %w", i, err)
+		}
+		if _, ok := x.(listArg); ok {
+			return nil, fmt.Errorf("[%d]: sql.list inside a dict parameter", i)
+		}
+		vals[i] = x
+	}
+	if kas, ok := d.KeyArray().(*goal.AS); ok && n > 0 {
+		return structArg{names: kas.Slice, vals: vals}, nil
+	}
+	keys := make([]any, n)
+	for i := range keys {
+		k, err := goalScalarToSQL(d.KeyArray().At(i))
+		if err != nil {
+			return nil, fmt.Errorf("key [%d]: %w", i, err)
+		}
+		keys[i] = k
+	}
+	return mapArg{keys: keys, vals: vals}, nil
+}
+
+// isNested reports whether a is an array or dict parameter, or a sql.list
+// holding one.
+func isNested(a any) bool {
+	switch x := a.(type) {
+	case []any, structArg, mapArg:
+		return true
+	case listArg:
+		return slices.ContainsFunc(x, isNested)
+	}
+	return false
+}
+
+// writeArg writes the SQL text binding a to sb, and appends the driver
+// arguments of its placeholders to out. Plain values bind one ?; sql.list
+// values expand to "?, ?, …" (NULL when empty); nested values become DuckDB
+// LIST ([…]), STRUCT ({'name': …}) and MAP (MAP([…], […])) constructors.
+func writeArg(sb *strings.Builder, out []any, a any) []any {
+	switch x := a.(type) {
+	case listArg:
+		if len(x) == 0 {
+			sb.WriteString("NULL")
+			return out
+		}
+		return writeArgs(sb, out, x)
+	case []any:
+		sb.WriteByte('[')
+		out = writeArgs(sb, out, x)
+		sb.WriteByte(']')
+		return out
+	case structArg:
+		sb.WriteByte('{')
+		for i, name := range x.names {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(quoteString(name) + ": ")
+			out = writeArg(sb, out, x.vals[i])
+		}
+		sb.WriteByte('}')
+		return out
+	case mapArg:
+		sb.WriteString("MAP([")
+		out = writeArgs(sb, out, x.keys)
+		sb.WriteString("], [")
+		out = writeArgs(sb, out, x.vals)
+		sb.WriteString("])")
+		return out
+	}
+	sb.WriteByte('?')
+	return append(out, a)
+}
+
+// writeArgs writes the comma-separated values of args with writeArg.
+func writeArgs(sb *strings.Builder, out []any, args []any) []any {
+	for i, a := range args {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		out = writeArg(sb, out, a)
+	}
+	return out
+}
@@ -0,0 +1,125 @@
+package sql_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// mustS extracts a Goal string or fails.
+func mustS(t *testing.T, v goal.V) string {
+	t.Helper()
+	s, ok := v.BV().(goal.S)
+	if !ok {
+		t.Fatalf("expected string, got %q", v.Type())
+	}
+	return string(s)
+}
+
+// ---------------------------------------------------------------------------
+// TestDuckDBNestedTypes
+// ---------------------------------------------------------------------------
+
+func TestDuckDBNestedTypes(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	ctx.AssignGlobal("t", eval(t, ctx, `sql.q[db;"SELECT [1, 2, 3] AS l, {'b': 'x', 'a': 1} AS s,
+		MAP {'k1': 10, 'k2': 20} AS m, 1.25::DECIMAL(10,2) AS d, 42::HUGEINT AS h,
+		INTERVAL 1 MONTH + INTERVAL 2 DAY AS iv, '6ba7b810-9dad-11d1-80b4-00c04fd430c8'::UUID AS u"]`))
+
+	for _, tt := range []struct {
+		expr string
+		want int64
+	}{
+		{`+/*t"l"`, 6},
+		{`(*t"s")"a"`, 1},
+		{`(*t"m")"k2"`, 20},
+		{`*t"h"`, 42},
+		{`(*t"iv")"months"`, 1},
+		{`(*t"iv")"days"`, 2},
+	} {
+		if got := mustI(t, eval(t, ctx, tt.expr)); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.expr, tt.want, got)
+		}
+	}
+	if got := mustS(t, eval(t, ctx, `(*t"s")"b"`)); got != "x" {
+		t.Errorf("struct field b: expected x, got %s", got)
+	}
+	if got := eval(t, ctx, `*t"d"`); !got.IsF() || got.F() != 1.25 {
+		t.Errorf("decimal: expected 1.25, got %s", got.Sprint(ctx, true))
+	}
+	if got := strCol(t, ctx, eval(t, ctx, `t`), "u"); got[0] != "6ba7b810-9dad-11d1-80b4-00c04fd430c8" {
+		t.Errorf("uuid: got %q", got[0])
+	}
+
+	// MAP keys keep their type.
+	if got := eval(t, ctx, `!*sql.q[db;"SELECT MAP {2: 'b', 1: 'a'} AS m"]"m"`).Sprint(ctx, true); got != "1 2" {
+		t.Errorf("map keys: expected 1 2, got %s", got)
+	}
+}
+
+func TestDuckDBReadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	src := `{"id": 1, "tags": ["a", "b"], "meta": {"score": 1.5}}
+{"id": 2, "tags": [], "meta": {"score": 2.5}}
+`
+	if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	ctx.AssignGlobal("t", eval(t, ctx, `sql.q[db;"SELECT * FROM read_json_auto('`+path+`') ORDER BY id"]`))
+	if n := mustI(t, eval(t, ctx, `#*t"tags"`)); n != 2 {
+		t.Errorf("tags: expected 2 elements, got %d", n)
+	}
+	if got := eval(t, ctx, `((t"meta")1)"score"`); !got.IsF() || got.F() != 2.5 {
+		t.Errorf("meta.score: expected 2.5, got %s", got.Sprint(ctx, true))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// TestNestedParams
+// ---------------------------------------------------------------------------
+
+func TestDuckDBNestedParams(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (l INTEGER[], s STRUCT(a INTEGER, b VARCHAR), m MAP(INTEGER, VARCHAR))"]`)
+	eval(t, ctx, `sql.exec[db;"INSERT INTO t VALUES (?, ?, ?)";(1 2 3;..[a:1;b:"it's"];1 2!("x";"y"))]`)
+
+	ctx.AssignGlobal("r", eval(t, ctx, `db sql.q "SELECT * FROM t"`))
+	if n := mustI(t, eval(t, ctx, `+/*r"l"`)); n != 6 {
+		t.Errorf("list: expected sum 6, got %d", n)
+	}
+	if got := mustS(t, eval(t, ctx, `(*r"s")"b"`)); got != "it's" {
+		t.Errorf("struct: expected it's, got %s", got)
+	}
+	if got := mustS(t, eval(t, ctx, `(*r"m")2`)); got != "y" {
+		t.Errorf("map: expected y, got %s", got)
+	}
+
+	// Named parameters and nesting.
+	if n := mustI(t, eval(t, ctx, `*sql.q[db;"SELECT list_sum(:xs) AS n";..[xs:1 2 3]]"n"`)); n != 6 {
+		t.Errorf("named list: expected 6, got %d", n)
+	}
+	if n := mustI(t, eval(t, ctx, `*sql.q[db;"SELECT len(?) AS n";,(1 2;3 4 5)]"n"`)); n != 2 {
+		t.Errorf("nested list: expected 2, got %d", n)
+	}
+
+	// Prepared statements cannot take them.
+	ctx.AssignGlobal("st", eval(t, ctx, `db sql.prepare "SELECT len(?) AS n"`))
+	evalPanic(t, ctx, `st sql.q ,1 2`)
+}
+
+func TestNestedParamsSQLite(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	msg := evalPanic(t, ctx, `sql.q[db;"SELECT ? AS x";,1 2]`)
+	if !strings.Contains(msg, "not supported") {
+		t.Errorf("expected unsupported error, got %s", msg)
+	}
+	evalPanic(t, ctx, `sql.q[db;"SELECT :x AS x";..[x:..[a:1]]]`)
+}
@@ -0,0 +1,522 @@
+package sql
+
+import (
+	stdsql "database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// Options dicts
+// ---------------------------------------------------------------------------
+
+// parseOptions applies each key of an opts dict to opts.
+func parseOptions(verb string, v goal.V, opts interface{ apply(string, goal.V) error }) error {
+	d, ok := v.BV().(*goal.D)
+	if !ok {
+		return fmt.Errorf("%s : expected opts dict, got %q", verb, v.Type())
+	}
+	if d.Len() == 0 {
+		return nil
+	}
+	kas, ok := d.KeyArray().(*goal.AS)
+	if !ok {
+		return fmt.Errorf("%s : opts keys must be strings, got %q", verb, d.KeyArray().Type())
+	}
+	for i, k := range kas.Slice {
+		if err := opts.apply(k, d.ValueArray().At(i)); err != nil {
+			return fmt.Errorf("%s : %w", verb, err)
+		}
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Query options (last argument of sql.q[conn;query;params;opts], …)
+// ---------------------------------------------------------------------------
+
+// queryOptions holds per-query settings parsed from an opts dict.
+type queryOptions struct {
+	// temporal returns DATE/TIME/TIMESTAMP columns as sql.time values
+	// instead of bare Unix-microsecond integers.
+	temporal bool
+
+	// timeout bounds the call, overriding the connection's TimeoutMilli
+	// when timeoutSet; zero means no limit.
+	timeout    time.Duration
+	timeoutSet bool
+
+	// fill holds the values replacing NULLs in integer, float and string
+	// columns.
+	fill nullFill
+
+	// nullMask returns ..[data:t;null:m], m holding a 0/1 NULL mask per
+	// column.
+	nullMask bool
+
+	// arrow reads the result through the driver's Arrow interface (sql.q
+	// on a DuckDB sql.conn), building columns without per-cell boxing.
+	// Nested, INTERVAL, UUID and TIME columns are not supported, nor are
+	// the Temporal option, transactions and prepared statements.
+	arrow bool
+
+	// cache, when cacheSet, overrides whether sql.q uses the connection's
+	// cache of results (see vfCached).
+	cache    bool
+	cacheSet bool
+
+	// batch is the number of rows sql.next returns as a columnar dict,
+	// or 0 for one row as a dict (sql.rows only).
+	batch int
+
+	// allowWrites lets sql.explain run a statement that may write, to
+	// profile it (sql.explain on DuckDB only).
+	allowWrites bool
+
+	// scanValue is the driver's conversion of result values, if any (see
+	// Scheme.Value); it is not an option but comes with the connection.
+	scanValue func(v any, dbType string) (any, bool)
+}
+
+// nullFill holds the values replacing NULLs in typed result columns, set
+// with the Fill option's "i", "n" and "s" keys. Without an "i" fill,
+// integer columns with NULLs are returned as AF with 0n.
+type nullFill struct {
+	i    int64
+	iSet bool
+	n    float64
+	nSet bool
+	s    string
+}
+
+// float returns the fill value for float columns: 0n unless set.
+func (fill nullFill) float() float64 {
+	if fill.nSet {
+		return fill.n
+	}
+	return math.NaN()
+}
+
+// parseQueryOptions reads an opts dict into a queryOptions value.
+func parseQueryOptions(verb string, v goal.V) (queryOptions, error) {
+	var opts queryOptions
+	if err := parseOptions(verb, v, &opts); err != nil {
+		return opts, err
+	}
+	if opts.arrow && verb != "sql.q" && verb != "sql.cached" {
+		return opts, fmt.Errorf("%s : the Arrow option only applies to sql.q", verb)
+	}
+	if opts.cacheSet && verb != "sql.q" {
+		return opts, fmt.Errorf("%s : the Cache option only applies to sql.q", verb)
+	}
+	if opts.batch > 0 && verb != "sql.rows" {
+		return opts, fmt.Errorf("%s : the Batch option only applies to sql.rows", verb)
+	}
+	if opts.allowWrites && verb != "sql.explain" {
+		return opts, fmt.Errorf("%s : the AllowWrites option only applies to sql.explain", verb)
+	}
+	if opts.nullMask && verb == "sql.rows" && opts.batch == 0 {
+		return opts, fmt.Errorf("%s : the NullMask option needs Batch", verb)
+	}
+	return opts, nil
+}
+
+// apply sets a single query option.
+func (opts *queryOptions) apply(key string, v goal.V) error {
+	switch key {
+	case "Temporal":
+		b, err := boolArg(v, key)
+		if err != nil {
+			return err
+		}
+		opts.temporal = b
+	case "TimeoutMilli":
+		d, err := millisArg(v, key)
+		if err != nil {
+			return err
+		}
+		opts.timeout, opts.timeoutSet = d, true
+	case "Fill":
+		fill, err := fillArg(v, key)
+		if err != nil {
+			return err
+		}
+		opts.fill = fill
+	case "NullMask":
+		b, err := boolArg(v, key)
+		if err != nil {
+			return err
+		}
+		opts.nullMask = b
+	case "Arrow":
+		b, err := boolArg(v, key)
+		if err != nil {
+			return err
+		}
+		opts.arrow = b
+	case "Cache":
+		b, err := boolArg(v, key)
+		if err != nil {
+			return err
+		}
+		opts.cache, opts.cacheSet = b, true
+	case "Batch":
+		n, err := countArg(v, key)
+		if err != nil {
+			return err
+		}
+		opts.batch = n
+	case "AllowWrites":
+		b, err := boolArg(v, key)
+		if err != nil {
+			return err
+		}
+		opts.allowWrites = b
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// Connection options (sql.open[uri;opts])
+// ---------------------------------------------------------------------------
+
+// connOptions holds per-connection settings parsed from an opts dict.
+type connOptions struct {
+	// timeout bounds each call on the connection; zero means no limit.
+	timeout time.Duration
+
+	// Connection pool limits, applied with the *stdsql.DB setters;
+	// negative means the database/sql default.
+	maxOpenConns    int
+	maxIdleConns    int
+	connMaxLifetime time.Duration
+	connMaxIdleTime time.Duration
+
+	// cache makes sql.q cache results; cacheSize (negative for the
+	// default) and cacheTTL (0 for no limit) bound the connection's cache,
+	// which sql.cached also uses.
+	cache     bool
+	cacheSize int
+	cacheTTL  time.Duration
+
+	// trace logs each statement to the Goal context's log, with the
+	// values of parameters if traceParams. This covers the statements the
+	// verbs build themselves, such as BEGIN, SAVEPOINT or the bookkeeping
+	// of sql.migrate; sql.insert and sql.read log one line per load, and
+	// sql.cursor and sql.rows one when their query starts.
+	trace       bool
+	traceParams bool
+
+	// sharedCache opens sqlite://:memory: as one database shared by the
+	// connections of the pool, in SQLite's shared-cache mode.
+	sharedCache bool
+
+	// settingsOption is the key of the driver's settings dict, if any
+	// (see driverScheme), and settings the settings it holds.
+	settingsOption string
+	settings       []setting
+}
+
+// setting is a driver setting: a SQLite pragma or a DuckDB configuration
+// option.
+type setting struct {
+	name, value string
+}
+
+// newConnOptions returns the default options of a connection with the
+// driver described by sch.
+func newConnOptions(sch driverScheme) connOptions {
+	return connOptions{
+		maxOpenConns:    -1,
+		maxIdleConns:    -1,
+		connMaxLifetime: -1,
+		connMaxIdleTime: -1,
+		cacheSize:       -1,
+		settingsOption:  sch.settingsOption,
+	}
+}
+
+// parseConnOptions reads an opts dict into the options of a connection
+// with the driver described by sch.
+func parseConnOptions(verb string, v goal.V, sch driverScheme) (connOptions, error) {
+	opts := newConnOptions(sch)
+	return opts, parseOptions(verb, v, &opts)
+}
+
+// apply sets a single connection option.
+func (opts *connOptions) apply(key string, v goal.V) error {
+	var err error
+	switch key {
+	case "TimeoutMilli":
+		opts.timeout, err = millisArg(v, key)
+	case "MaxOpenConns":
+		opts.maxOpenConns, err = countArg(v, key)
+	case "MaxIdleConns":
+		opts.maxIdleConns, err = countArg(v, key)
+	case "ConnMaxLifetimeMilli":
+		opts.connMaxLifetime, err = millisArg(v, key)
+	case "ConnMaxIdleTimeMilli":
+		opts.connMaxIdleTime, err = millisArg(v, key)
+	case "Cache":
+		opts.cache, err = boolArg(v, key)
+	case "CacheSize":
+		opts.cacheSize, err = countArg(v, key)
+	case "CacheTTLMilli":
+		opts.cacheTTL, err = millisArg(v, key)
+	case "Trace":
+		opts.trace, err = boolArg(v, key)
+	case "TraceParams":
+		opts.traceParams, err = boolArg(v, key)
+	case "SharedCache":
+		opts.sharedCache, err = boolArg(v, key)
+	default:
+		if key == "" || key != opts.settingsOption {
+			return fmt.Errorf("unknown option %q", key)
+		}
+		opts.settings, err = settingsArg(v, key)
+	}
+	return err
+}
+
+// newCache returns the query cache of a connection with these options, or
+// nil if none is configured (sql.cached then creates a default one).
+func (opts *connOptions) newCache() *queryCache {
+	if !opts.cache && opts.cacheSize < 0 && opts.cacheTTL == 0 {
+		return nil
+	}
+	return newQueryCache(opts.cacheSize, opts.cacheTTL)
+}
+
+// configurePool applies the connection pool limits to db.
+func (opts *connOptions) configurePool(db *stdsql.DB) {
+	if opts.maxOpenConns >= 0 {
+		db.SetMaxOpenConns(opts.maxOpenConns)
+	}
+	if opts.maxIdleConns >= 0 {
+		db.SetMaxIdleConns(opts.maxIdleConns)
+	}
+	if opts.connMaxLifetime >= 0 {
+		db.SetConnMaxLifetime(opts.connMaxLifetime)
+	}
+	if opts.connMaxIdleTime >= 0 {
+		db.SetConnMaxIdleTime(opts.connMaxIdleTime)
+	}
+}
+
+// poolSettings returns the options given other than driver settings, in
+// the form of their opts keys, for display.
+func (opts *connOptions) poolSettings() []setting {
+	var out []setting
+	add := func(name string, n int64, set bool) {
+		if set {
+			out = append(out, setting{name, strconv.FormatInt(n, 10)})
+		}
+	}
+	add("MaxOpenConns", int64(opts.maxOpenConns), opts.maxOpenConns >= 0)
+	add("MaxIdleConns", int64(opts.maxIdleConns), opts.maxIdleConns >= 0)
+	add("ConnMaxLifetimeMilli", opts.connMaxLifetime.Milliseconds(), opts.connMaxLifetime >= 0)
+	add("ConnMaxIdleTimeMilli", opts.connMaxIdleTime.Milliseconds(), opts.connMaxIdleTime >= 0)
+	add("TimeoutMilli", opts.timeout.Milliseconds(), opts.timeout > 0)
+	add("Cache", 1, opts.cache)
+	add("CacheSize", int64(opts.cacheSize), opts.cacheSize >= 0)
+	add("CacheTTLMilli", opts.cacheTTL.Milliseconds(), opts.cacheTTL > 0)
+	add("Trace", 1, opts.trace)
+	add("TraceParams", 1, opts.traceParams)
+	add("SharedCache", 1, opts.sharedCache)
+	return out
+}
+
+// ---------------------------------------------------------------------------
+// Transaction options (sql.tx[conn;fn;opts])
+// ---------------------------------------------------------------------------
+
+// txOptions holds the settings of a top-level transaction parsed from an
+// opts dict.
+type txOptions struct {
+	stdsql.TxOptions
+}
+
+// parseTxOptions reads an opts dict into a txOptions value.
+func parseTxOptions(verb string, v goal.V) (txOptions, error) {
+	var opts txOptions
+	return opts, parseOptions(verb, v, &opts)
+}
+
+// apply sets a single transaction option.
+func (opts *txOptions) apply(key string, v goal.V) error {
+	var err error
+	switch key {
+	case "Isolation":
+		var s string
+		if s, err = stringArg(v, key); err == nil {
+			opts.Isolation, err = isolationLevel(s)
+		}
+	case "ReadOnly":
+		opts.ReadOnly, err = boolArg(v, key)
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return err
+}
+
+// isolationLevel parses an isolation level name such as "read committed"
+// (case-insensitive).
+func isolationLevel(name string) (stdsql.IsolationLevel, error) {
+	names := make([]string, 0, stdsql.LevelLinearizable+1)
+	for l := stdsql.LevelDefault; l <= stdsql.LevelLinearizable; l++ {
+		if strings.EqualFold(name, l.String()) {
+			return l, nil
+		}
+		names = append(names, strings.ToLower(l.String()))
+	}
+	return 0, fmt.Errorf("unknown isolation level %q (expected one of: %s)", name, strings.Join(names, ", "))
+}
+
+// ---------------------------------------------------------------------------
+// Type-extraction helpers
+// ---------------------------------------------------------------------------
+
+// boolArg extracts a Go bool from a Goal number (0 = false, anything else =
+// true).
+func boolArg(v goal.V, key string) (bool, error) {
+	if !v.IsI() && !v.IsF() {
+		return false, fmt.Errorf("sql option %q must be 0 or 1, got %q", key, v.Type())
+	}
+	return v.IsTrue(), nil
+}
+
+// stringArg extracts a Go string from a Goal string.
+func stringArg(v goal.V, key string) (string, error) {
+	s, ok := v.BV().(goal.S)
+	if !ok {
+		return "", fmt.Errorf("sql option %q must be a string, got %q", key, v.Type())
+	}
+	return string(s), nil
+}
+
+// countArg extracts a non-negative integer.
+func countArg(v goal.V, key string) (int, error) {
+	if !v.IsI() {
+		return 0, fmt.Errorf("sql option %q must be an integer, got %q", key, v.Type())
+	}
+	if v.I() < 0 {
+		return 0, fmt.Errorf("sql option %q must be non-negative, got %d", key, v.I())
+	}
+	return int(v.I()), nil
+}
+
+// settingsArg extracts driver settings from a dict mapping setting names to
+// strings or numbers.
+func settingsArg(v goal.V, key string) ([]setting, error) {
+	d, ok := v.BV().(*goal.D)
+	if !ok {
+		return nil, fmt.Errorf("sql option %q must be a dict, got %q", key, v.Type())
+	}
+	if d.Len() == 0 {
+		return nil, nil
+	}
+	kas, ok := d.KeyArray().(*goal.AS)
+	if !ok {
+		return nil, fmt.Errorf("sql option %q: keys must be strings, got %q", key, d.KeyArray().Type())
+	}
+	out := make([]setting, len(kas.Slice))
+	for i, name := range kas.Slice {
+		if !isIdent(name) {
+			return nil, fmt.Errorf("sql option %q: invalid setting name %q", key, name)
+		}
+		x := d.ValueArray().At(i)
+		var value string
+		switch {
+		case x.IsI():
+			value = strconv.FormatInt(x.I(), 10)
+		case x.IsF():
+			value = strconv.FormatFloat(x.F(), 'g', -1, 64)
+		default:
+			s, ok := x.BV().(goal.S)
+			if !ok {
+				return nil, fmt.Errorf("sql option %q: setting %q must be a string or number, got %q", key, name, x.Type())
+			}
+			value = string(s)
+		}
+		out[i] = setting{name, value}
+	}
+	return out, nil
+}
+
+// fillArg extracts NULL fill values from a dict keyed by Goal type name:
+// "i" (integer), "n" (number, for float columns) and "s" (string).
+func fillArg(v goal.V, key string) (nullFill, error) {
+	var fill nullFill
+	d, ok := v.BV().(*goal.D)
+	if !ok {
+		return fill, fmt.Errorf("sql option %q must be a dict, got %q", key, v.Type())
+	}
+	if d.Len() == 0 {
+		return fill, nil
+	}
+	ks, ok := d.KeyArray().(*goal.AS)
+	if !ok {
+		return fill, fmt.Errorf("sql option %q: keys must be strings, got %q", key, d.KeyArray().Type())
+	}
+	vs := d.ValueArray()
+	for i, k := range ks.Slice {
+		x := vs.At(i)
+		switch k {
+		case "i":
+			if !x.IsI() {
+				return fill, fmt.Errorf("sql option %q: fill for \"i\" must be an integer, got %q", key, x.Type())
+			}
+			fill.i, fill.iSet = x.I(), true
+		case "n":
+			switch {
+			case x.IsI():
+				fill.n = float64(x.I())
+			case x.IsF():
+				fill.n = x.F()
+			default:
+				return fill, fmt.Errorf("sql option %q: fill for \"n\" must be a number, got %q", key, x.Type())
+			}
+			fill.nSet = true
+		case "s":
+			s, ok := x.BV().(goal.S)
+			if !ok {
+				return fill, fmt.Errorf("sql option %q: fill for \"s\" must be a string, got %q", key, x.Type())
+			}
+			fill.s = string(s)
+		default:
+			return fill, fmt.Errorf("sql option %q: unknown type %q (want \"i\", \"n\" or \"s\")", key, k)
+		}
+	}
+	return fill, nil
+}
+
+// isIdent reports whether s is a plain SQL identifier.
+func isIdent(s string) bool {
+	if s == "" || !isNameStart(s[0]) {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if !isNameChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// millisArg extracts a non-negative duration given in milliseconds.
+func millisArg(v goal.V, key string) (time.Duration, error) {
+	if !v.IsI() {
+		return 0, fmt.Errorf("sql option %q must be an integer, got %q", key, v.Type())
+	}
+	if v.I() < 0 {
+		return 0, fmt.Errorf("sql option %q must be non-negative, got %d", key, v.I())
+	}
+	return time.Duration(v.I()) * time.Millisecond, nil
+}
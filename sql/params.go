@@ -0,0 +1,355 @@
+package sql
+
+import (
+	stdsql "database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// Parameter binding
+// ---------------------------------------------------------------------------
+
+// bindArgs converts query parameters to driver arguments for a driver
+// described by sch. It returns the query to execute, which differs from
+// query when named placeholders had to be rewritten to positional form or
+// sql.list parameters expanded.
+//
+// A dict of scalar values binds :name placeholders by key (see namedArgs);
+// any other value binds positional ? placeholders (see goalToSQLArgs).
+// Arrays and dicts nested in the parameters bind LIST, STRUCT and MAP
+// values on drivers with nestedParams.
+func bindArgs(sch driverScheme, query string, params goal.V) (string, []any, error) {
+	d, ok := params.BV().(*goal.D)
+	if !ok {
+		args, err := goalToSQLArgs(params)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := checkNested(sch, args); err != nil {
+			return "", nil, err
+		}
+		return positionalArgs(sch, query, args)
+	}
+	names, positional := parseNamed(query, sch.script)
+	if len(names) == 0 {
+		return "", nil, fmt.Errorf("named parameters given, but query has no :name placeholders")
+	}
+	lookup, err := dictParams(d)
+	if err != nil {
+		return "", nil, err
+	}
+	vals, err := namedValues(names, lookup)
+	if err != nil {
+		return "", nil, err
+	}
+	if err := checkNested(sch, vals); err != nil {
+		return "", nil, err
+	}
+	if sch.namedParams && !hasList(vals) {
+		return query, namedArgs(sch, names, vals), nil
+	}
+	return positionalArgs(sch, positional, vals)
+}
+
+// positionalArgs expands the sql.list parameters of a query with positional
+// placeholders, then rewrites them to the driver's syntax.
+func positionalArgs(sch driverScheme, query string, args []any) (string, []any, error) {
+	query, args, err := expandLists(query, args, sch.script)
+	if err != nil {
+		return "", nil, err
+	}
+	return sch.positional(query), args, nil
+}
+
+// namedValues looks up the value of each :name placeholder in names (in
+// order of appearance, repeats included).
+func namedValues(names []string, lookup func(string) (any, error)) ([]any, error) {
+	vals := make([]any, len(names))
+	for i, name := range names {
+		v, err := lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// namedArgs turns the per-placeholder values of namedValues into driver
+// arguments. Drivers with native named parameters get one stdsql.Named per
+// distinct name; others get one positional argument per placeholder.
+func namedArgs(sch driverScheme, names []string, vals []any) []any {
+	if !sch.namedParams {
+		return vals
+	}
+	args := make([]any, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			args = append(args, stdsql.Named(name, vals[i]))
+		}
+	}
+	return args
+}
+
+// dictParams returns a lookup function over a dict of named parameters.
+func dictParams(d *goal.D) (func(string) (any, error), error) {
+	kas, ok := d.KeyArray().(*goal.AS)
+	if !ok {
+		return nil, fmt.Errorf("named parameter keys must be strings, got %q", d.KeyArray().Type())
+	}
+	index := make(map[string]int, len(kas.Slice))
+	for i, k := range kas.Slice {
+		index[k] = i
+	}
+	vals := d.ValueArray()
+	return func(name string) (any, error) {
+		i, ok := index[name]
+		if !ok {
+			return nil, fmt.Errorf("missing named parameter %q", name)
+		}
+		v, err := goalScalarToSQL(vals.At(i))
+		if err != nil {
+			return nil, fmt.Errorf("parameter %q: %w", name, err)
+		}
+		return v, nil
+	}, nil
+}
+
+// placeholder is the position of a parameter placeholder in a query.
+type placeholder struct {
+	start, end int
+	name       string // "" for a positional ? placeholder
+	numbered   bool   // ?NNN
+}
+
+// scanPlaceholders returns the ? and :name placeholders of query, skipping
+// string literals, quoted identifiers (with the driver's syntax, as
+// splitStatements does), comments and :: casts. A colon right after [, a
+// digit, a name or a closing quote is not a placeholder either, as in the
+// DuckDB slice x[a:b] and struct {'k':v}.
+func scanPlaceholders(query string, syn scriptSyntax) []placeholder {
+	var phs []placeholder
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case c == '\'' || c == '"':
+			i = skipQuoted(query, i, c)
+		case syn.bracketIdents && c == '`':
+			i = skipQuoted(query, i, c)
+		case syn.bracketIdents && c == '[':
+			if j := strings.IndexByte(query[i:], ']'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(query)
+			}
+		case syn.dollarQuotes && c == '$':
+			i = skipDollarQuoted(query, i)
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(query)
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = len(query)
+			}
+		case c == ':' && strings.HasPrefix(query[i:], "::"):
+			i += 2
+		case c == ':' && i+1 < len(query) && isNameStart(query[i+1]) && !(i > 0 && afterOperand(query[i-1])):
+			j := i + 2
+			for j < len(query) && isNameChar(query[j]) {
+				j++
+			}
+			phs = append(phs, placeholder{start: i, end: j, name: query[i+1 : j]})
+			i = j
+		case c == '?':
+			j := i + 1
+			for j < len(query) && '0' <= query[j] && query[j] <= '9' {
+				j++
+			}
+			phs = append(phs, placeholder{start: i, end: j, numbered: j > i+1})
+			i = j
+		default:
+			i++
+		}
+	}
+	return phs
+}
+
+// afterOperand reports whether a colon following c separates two operands,
+// as in a slice or a struct field, rather than starting a :name placeholder.
+func afterOperand(c byte) bool {
+	return c == '[' || isNameChar(c) || c == '\'' || c == '"' || c == '`' || c == ']'
+}
+
+// parseNamed returns the :name placeholders of query in order of
+// appearance and the query with each replaced by a positional ?. names is
+// nil if the query has no named placeholders.
+func parseNamed(query string, syn scriptSyntax) ([]string, string) {
+	var names []string
+	var sb strings.Builder
+	last := 0 // start of the query text not yet copied to sb
+	for _, ph := range scanPlaceholders(query, syn) {
+		if ph.name == "" {
+			continue
+		}
+		names = append(names, ph.name)
+		sb.WriteString(query[last:ph.start])
+		sb.WriteByte('?')
+		last = ph.end
+	}
+	if names == nil {
+		return nil, query
+	}
+	sb.WriteString(query[last:])
+	return names, sb.String()
+}
+
+// skipQuoted returns the index just past the quoted string or identifier
+// starting at query[i], where doubled quotes escape the quote character.
+func skipQuoted(query string, i int, quote byte) int {
+	for j := i + 1; j < len(query); j++ {
+		if query[j] != quote {
+			continue
+		}
+		if j+1 < len(query) && query[j+1] == quote {
+			j++
+			continue
+		}
+		return j + 1
+	}
+	return len(query)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || '0' <= c && c <= '9'
+}
+
+// ---------------------------------------------------------------------------
+// List parameters (sql.list)
+// ---------------------------------------------------------------------------
+
+// listArg is the driver-side form of a sql.list parameter: expandLists
+// replaces its placeholder with one placeholder per value.
+type listArg []any
+
+// hasList reports whether args holds a sql.list or nested parameter, whose
+// placeholder expandLists must rewrite.
+func hasList(args []any) bool {
+	for _, a := range args {
+		if _, ok := a.(listArg); ok || isNested(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkNested rejects array and dict parameters on drivers without nested
+// types.
+func checkNested(sch driverScheme, args []any) error {
+	if !sch.nestedParams && slices.ContainsFunc(args, isNested) {
+		return fmt.Errorf("array and dict parameters are not supported by the %s driver", sch.driverName)
+	}
+	return nil
+}
+
+// expandLists rewrites each positional ? placeholder bound to a sql.list
+// into one placeholder per list value (NULL for an empty list, which
+// matches nothing in an IN clause), and each one bound to a nested value
+// into a constructor (see writeArg), and flattens args to match.
+func expandLists(query string, args []any, syn scriptSyntax) (string, []any, error) {
+	if !hasList(args) {
+		return query, args, nil
+	}
+	phs := scanPlaceholders(query, syn)
+	if len(phs) != len(args) {
+		return "", nil, fmt.Errorf("query has %d placeholders, got %d parameters", len(phs), len(args))
+	}
+	var sb strings.Builder
+	out := make([]any, 0, len(args))
+	last := 0
+	for k, ph := range phs {
+		if ph.name != "" || ph.numbered {
+			return "", nil, fmt.Errorf("sql.list and nested parameters require plain ? placeholders, got %q", query[ph.start:ph.end])
+		}
+		sb.WriteString(query[last:ph.start])
+		last = ph.end
+		out = writeArg(&sb, out, args[k])
+	}
+	sb.WriteString(query[last:])
+	return sb.String(), out, nil
+}
+
+// List wraps a Goal array bound as a single query parameter (sql.list).
+// Its ? placeholder expands to one placeholder per element, so
+// "WHERE id IN (?)" filters by every value of the array.
+type List struct {
+	col goal.V // column array (AI, AF, AS, AV or sql.time)
+}
+
+func (l *List) Append(ctx *goal.Context, dst []byte, _ bool) []byte {
+	dst = append(dst, "sql.list["...)
+	dst = append(dst, l.col.Sprint(ctx, true)...)
+	return append(dst, ']')
+}
+func (l *List) Matches(y goal.BV) bool { yv, ok := y.(*List); return ok && l == yv }
+func (l *List) Type() string           { return "sql.list" }
+
+// arg converts the list to its driver-side form.
+func (l *List) arg() (listArg, error) {
+	n, _ := columnLen(l.col)
+	out := make(listArg, n)
+	for i := range out {
+		v, err := columnValue(l.col, i)
+		if err != nil {
+			return nil, fmt.Errorf("sql.list[%d]: %w", i, err)
+		}
+		if _, ok := v.(listArg); ok {
+			return nil, fmt.Errorf("sql.list[%d]: nested sql.list", i)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// ---------------------------------------------------------------------------
+// sql.list  (monad: sql.list x)
+// ---------------------------------------------------------------------------
+
+// vfList wraps an array as a single list parameter. Its ? placeholder
+// expands to one placeholder per element ("NULL" when empty), on every
+// driver. On DuckDB, "[?]" thus binds a native LIST value. Prepared
+// statements cannot take sql.list parameters, since the expansion changes
+// the SQL text.
+//
+// Usage:
+//
+//	db sql.q["SELECT * FROM users WHERE id IN (?)" ; ,sql.list 1 2 3]
+//	db sql.q["SELECT * FROM t WHERE b IN (:bs)" ; ..[bs:sql.list ("x";"y")]]
+//	db sql.q["SELECT list_sum([?]) AS s" ; ,sql.list 1 2 3]    / DuckDB
+func vfList(_ *goal.Context, args []goal.V) goal.V {
+	if len(args) != 1 {
+		return goal.Panicf("sql.list x : expected 1 argument, got %d", len(args))
+	}
+	x := args[0]
+	if _, ok := columnLen(x); ok {
+		return goal.NewV(&List{col: x})
+	}
+	if _, isS := x.BV().(goal.S); isS || x.IsI() || x.IsF() {
+		// A scalar is a one-element list.
+		return goal.NewV(&List{col: goal.NewAV([]goal.V{x})})
+	}
+	return goal.Panicf("sql.list x : expected array, got %q", x.Type())
+}
@@ -0,0 +1,143 @@
+package sql_test
+
+import (
+	"testing"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// checkNamedParams runs the named-parameter checks shared by the SQLite and
+// DuckDB tests against a db holding t(a, b) = (1,x) (2,y) (3,x).
+func checkNamedParams(t *testing.T, ctx *goal.Context) {
+	t.Helper()
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (a INTEGER, b VARCHAR)"]`)
+	eval(t, ctx, `sql.exec[db;"INSERT INTO t VALUES (:a1, :b1), (:a2, :b2), (:a3, :b1)";..[a1:1;a2:2;a3:3;b1:"x";b2:"y"]]`)
+
+	tests := []struct{ src, want string }{
+		{`sql.q[db;"SELECT a FROM t WHERE a > :min AND b = :b ORDER BY a";..[b:"x";min:1]]`, ",3"},
+		// Repeated names bind the same value.
+		{`sql.q[db;"SELECT a FROM t WHERE a = :v OR a = :v + 1 ORDER BY a";..[v:1]]`, "1 2"},
+		// ':x' in a string literal and the :: cast are not placeholders.
+		{`sql.q[db;"SELECT a FROM t WHERE b <> ':b' AND a = CAST(:a AS INTEGER) -- :c";..[a:2]]`, ",2"},
+	}
+	for _, tt := range tests {
+		v := eval(t, ctx, tt.src)
+		if got := dictLookup(t, ctx, mustDict(t, ctx, v), "a").Sprint(ctx, true); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.src, tt.want, got)
+		}
+	}
+
+	evalPanic(t, ctx, `sql.q[db;"SELECT a FROM t WHERE a = :a";..[b:1]]`)   // missing key
+	evalPanic(t, ctx, `sql.q[db;"SELECT a FROM t WHERE a = ?";..[a:1]]`)    // no named placeholders
+	evalPanic(t, ctx, `sql.q[db;"SELECT a FROM t WHERE a = :a";..[a:1 2]]`) // array value
+}
+
+// ---------------------------------------------------------------------------
+// TestNamedParams
+// ---------------------------------------------------------------------------
+
+func TestNamedParamsSQLite(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	checkNamedParams(t, ctx)
+
+	// [bracket] and `backtick` identifiers are not scanned for placeholders.
+	v := eval(t, ctx, "sql.q[db;\"SELECT [a:b] + `c:d` AS a FROM (SELECT 3 AS [a:b], 4 AS `c:d`) WHERE :x = 1\";..[x:1]]")
+	if got := dictLookup(t, ctx, mustDict(t, ctx, v), "a").Sprint(ctx, true); got != ",7" {
+		t.Fatalf("bracket identifiers: expected ,7, got %s", got)
+	}
+}
+
+func TestNamedParamsDuckDB(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	checkNamedParams(t, ctx)
+
+	// DuckDB casts still work next to rewritten placeholders.
+	v := eval(t, ctx, `sql.q[db;"SELECT :n::INTEGER + 1 AS a";..[n:"41"]]`)
+	if got := dictLookup(t, ctx, mustDict(t, ctx, v), "a").Sprint(ctx, true); got != ",42" {
+		t.Fatalf(":n::INTEGER: expected ,42, got %s", got)
+	}
+
+	// Neither slices nor struct literals hold placeholders.
+	v = eval(t, ctx, `sql.q[db;"SELECT list_sum(l[b:c]) + struct_extract({'k':c}, 'k') AS a FROM (SELECT [1, 2, 3, 4] AS l, 2 AS b, 3 AS c) WHERE :x = 1";..[x:1]]`)
+	if got := dictLookup(t, ctx, mustDict(t, ctx, v), "a").Sprint(ctx, true); got != ",8" {
+		t.Fatalf("slice and struct: expected ,8, got %s", got)
+	}
+}
+
+func TestNamedParamsStmt(t *testing.T) {
+	for _, open := range []func(*testing.T, *goal.Context, ...string) goal.V{openMem, openDuckDB} {
+		ctx := newCtx(t)
+		ctx.AssignGlobal("db", open(t, ctx))
+		eval(t, ctx, `sql.exec[db;"CREATE TABLE t (a INTEGER, b VARCHAR)"]`)
+		ctx.AssignGlobal("ins", eval(t, ctx, `db sql.prepare "INSERT INTO t VALUES (:a, :b)"`))
+
+		eval(t, ctx, `ins sql.exec ..[b:"x";a:1]`)
+		// Table columns bind by name, whatever their order.
+		eval(t, ctx, `ins sql.exec ..[b:("y";"z");a:2 3]`)
+		evalPanic(t, ctx, `ins sql.exec ..[a:4 5]`)
+
+		v := eval(t, ctx, `sql.q[db;"SELECT a, b FROM t ORDER BY a"]`)
+		if got := strCol(t, ctx, v, "b"); len(got) != 3 || got[0] != "x" || got[2] != "z" {
+			t.Fatalf("named stmt inserts: expected [x y z], got %v", got)
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// TestListParams
+// ---------------------------------------------------------------------------
+
+// checkListParams runs the sql.list checks shared by the SQLite and DuckDB
+// tests against a db holding t(a, b) = (1,x) (2,y) (3,x).
+func checkListParams(t *testing.T, ctx *goal.Context) {
+	t.Helper()
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (a INTEGER, b VARCHAR)"]`)
+	eval(t, ctx, `sql.exec[db;"INSERT INTO t VALUES (1,'x'), (2,'y'), (3,'x')"]`)
+
+	tests := []struct{ src, want string }{
+		{`sql.q[db;"SELECT a FROM t WHERE a IN (?) ORDER BY a";,sql.list 1 3]`, "1 3"},
+		{`sql.q[db;"SELECT a FROM t WHERE b IN (?) AND a > ? ORDER BY a";(sql.list ("x";"z");1)]`, ",3"},
+		{`sql.q[db;"SELECT a FROM t WHERE a IN (?)";,sql.list 2]`, ",2"},
+		{`sql.q[db;"SELECT a FROM t WHERE a IN (:as) AND b = :b ORDER BY a";..[as:sql.list 1 2 3;b:"x"]]`, "1 3"},
+	}
+	for _, tt := range tests {
+		v := eval(t, ctx, tt.src)
+		if got := dictLookup(t, ctx, mustDict(t, ctx, v), "a").Sprint(ctx, true); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.src, tt.want, got)
+		}
+	}
+
+	// An empty list matches nothing.
+	if n := mustI(t, eval(t, ctx, `#sql.q[db;"SELECT a FROM t WHERE a IN (?)";,sql.list !0]"a"`)); n != 0 {
+		t.Errorf("empty sql.list: expected no rows, got %d", n)
+	}
+
+	ctx.AssignGlobal("st", eval(t, ctx, `db sql.prepare "SELECT a FROM t WHERE a IN (?)"`))
+	evalPanic(t, ctx, `st sql.q ,sql.list 1 2`)
+	evalPanic(t, ctx, `sql.q[db;"SELECT a FROM t WHERE a IN (?)";(sql.list 1 2;3)]`) // placeholder count
+	evalPanic(t, ctx, `sql.list ..[a:1]`)
+}
+
+func TestListParamsSQLite(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	checkListParams(t, ctx)
+}
+
+func TestListParamsDuckDB(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	checkListParams(t, ctx)
+
+	// Inside brackets the expanded placeholders form a native LIST.
+	v := eval(t, ctx, `sql.q[db;"SELECT len([?]) AS n, list_contains([?], 'b') AS c";(sql.list 1 2 3;sql.list ("a";"b"))]`)
+	d := mustDict(t, ctx, v)
+	if got := dictLookup(t, ctx, d, "n").Sprint(ctx, true); got != ",3" {
+		t.Fatalf("len([?]): expected ,3, got %s", got)
+	}
+	if got := dictLookup(t, ctx, d, "c").Sprint(ctx, true); got != ",1" {
+		t.Fatalf("list_contains([?], 'b'): expected ,1, got %s", got)
+	}
+}
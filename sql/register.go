@@ -0,0 +1,297 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// sql.register    (triad: sql.register[conn;"name";t])
+// sql.unregister  (dyad: conn sql.unregister "name")
+// ---------------------------------------------------------------------------
+
+// vfRegister makes a Goal columnar dict queryable by SQL under a name, so
+// that it can be joined with database tables, and returns the name.
+//
+// The dict is loaded into a TEMP table of that name, which sql.unregister
+// and sql.close drop again and which is gone with the connection holding it
+// if the process exits first. A TEMP table belongs to one connection of the
+// pool, so the first sql.register pins one for the sql.conn until
+// sql.close, and its statements run on it, as does a transaction started
+// while it is free; other transactions do not see the table. DuckDB loads the table through
+// its Arrow interface, other drivers with INSERT statements.
+//
+// Registering a name again replaces the data; a name already used by a
+// table sql.register did not create is an error. Column types follow the
+// Goal arrays: AI gives BIGINT, AF DOUBLE, AS VARCHAR, sql.time columns
+// their SQL type, and AV columns the type of their values.
+//
+// Usage:
+//
+//	sql.register[db;"users";json.parse http.get[…]"body"]
+//	db sql.q "SELECT o.* FROM orders o JOIN users u ON o.user_id = u.id"
+//	db sql.unregister "users"
+func vfRegister(_ *goal.Context, args []goal.V) goal.V {
+	if len(args) != 3 {
+		return goal.Panicf("sql.register[conn;name;t] : expected 3 arguments, got %d", len(args))
+	}
+	// args[0] = t, args[1] = name, args[2] = conn
+	ns, ok := args[1].BV().(goal.S)
+	if !ok {
+		return goal.Panicf("sql.register[conn;name;t] : expected string name, got %q", args[1].Type())
+	}
+	name := string(ns)
+	if strings.Contains(name, ".") {
+		return goal.Panicf("sql.register[conn;name;t] : expected name without schema, got %q", name)
+	}
+	names, cols, nrows, err := parseTable("sql.register[conn;name;t]", args[0])
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	if len(names) == 0 {
+		return goal.Panicf("sql.register[conn;name;t] : expected at least one column")
+	}
+	c, ok := args[2].BV().(*Conn)
+	if !ok {
+		return goal.Panicf("sql.register[conn;name;t] : expected sql.conn as first argument, got %q", args[2].Type())
+	}
+	if err := c.checkRegister(); err != nil {
+		return goal.Panicf("sql.register[conn;name;t] : %v", err)
+	}
+	reg := &registration{names: names, types: make([]string, len(cols)), cols: cols, nrows: nrows}
+	for i, col := range cols {
+		if reg.types[i], err = registerType(col, nrows); err != nil {
+			return goal.Panicf("sql.register %q: column %q: %v", name, names[i], err)
+		}
+	}
+
+	ctx, done := callContext(c.timeout)
+	defer done()
+	if err := c.register(ctx, "sql.register", name, reg); err != nil {
+		return goal.Panicf("sql.register %q: %v", name, callErr(ctx, err))
+	}
+	return goal.NewS(name)
+}
+
+// vfUnregister drops a table created by sql.register and returns 1i.
+//
+// Usage:
+//
+//	db sql.unregister "users"
+func vfUnregister(_ *goal.Context, args []goal.V) goal.V {
+	if len(args) != 2 {
+		return goal.Panicf("conn sql.unregister name : expected 2 arguments, got %d", len(args))
+	}
+	// args[0] = name (right), args[1] = conn (left)
+	ns, ok := args[0].BV().(goal.S)
+	if !ok {
+		return goal.Panicf("conn sql.unregister name : expected string name, got %q", args[0].Type())
+	}
+	c, ok := args[1].BV().(*Conn)
+	if !ok {
+		return goal.Panicf("conn sql.unregister name : expected sql.conn in left arg, got %q", args[1].Type())
+	}
+	if err := c.checkRegister(); err != nil {
+		return goal.Panicf("conn sql.unregister name : %v", err)
+	}
+	if _, ok := c.registered[string(ns)]; !ok {
+		return goal.Panicf("conn sql.unregister name : %q was not registered with sql.register", string(ns))
+	}
+	ctx, done := callContext(c.timeout)
+	defer done()
+	if err := c.unregister(ctx, "sql.unregister", string(ns)); err != nil {
+		return goal.Panicf("sql.unregister %q: %v", string(ns), callErr(ctx, err))
+	}
+	return goal.NewI(1)
+}
+
+// registration is a Goal table registered with sql.register, kept so that
+// it can be loaded again on a new connection (see Conn.repin).
+type registration struct {
+	names []string // column names
+	types []string // SQL types of the columns (see registerType)
+	cols  []goal.V
+	nrows int
+}
+
+// checkRegister returns an error if the registered tables of c cannot be
+// changed: they are on the connection of an open transaction, or no
+// connection of the pool is left to hold them.
+func (c *Conn) checkRegister() error {
+	switch {
+	case c.closed:
+		return errors.New("connection is closed")
+	case c.pinTx != nil:
+		return errors.New("a transaction is open on the connection of registered tables: end it first")
+	}
+	return c.checkPool()
+}
+
+// register creates the TEMP table name on the pinned connection of c,
+// pinning one first, and loads reg into it, replacing an earlier
+// registration of the same name.
+func (c *Conn) register(ctx context.Context, verb, name string, reg *registration) error {
+	defer c.invalidateCache()
+	if c.pin == nil {
+		pin, err := c.db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		c.pin = pin
+	}
+	if _, ok := c.registered[name]; ok {
+		if err := c.unregister(ctx, verb, name); err != nil {
+			return err
+		}
+	} else if _, err := tableColumnNames(ctx, c.pin, name); err == nil {
+		// A TEMP table would hide it from the statements of c.
+		return fmt.Errorf("table %q already exists", name)
+	}
+	sch := driverSchemes[c.driver]
+	defs := make([]string, len(reg.names))
+	for i, col := range reg.names {
+		defs[i] = quoteName(col) + " " + sch.columnType(reg.types[i])
+	}
+	if err := c.exec(ctx, verb, c.pin, "CREATE TEMP TABLE "+quoteName(name)+" ("+strings.Join(defs, ", ")+")"); err != nil {
+		return err
+	}
+	start := time.Now()
+	n, err := c.load(ctx, name, reg)
+	c.observe(stmtEvent{verb: verb, query: "INSERT INTO " + quoteName(name), rows: n, elapsed: time.Since(start), err: err})
+	if err != nil {
+		_, _ = c.pin.ExecContext(context.Background(), "DROP TABLE IF EXISTS temp."+quoteName(name))
+		return err
+	}
+	if c.registered == nil {
+		c.registered = make(map[string]*registration)
+	}
+	c.registered[name] = reg
+	return nil
+}
+
+// load inserts the rows of reg into the registered table name and returns
+// their number.
+func (c *Conn) load(ctx context.Context, name string, reg *registration) (int64, error) {
+	if reg.nrows == 0 {
+		return 0, nil
+	}
+	sch := driverSchemes[c.driver]
+	if sch.loadTable != nil {
+		err := sch.loadTable(ctx, c.pin, name, reg.types, reg.cols, reg.nrows)
+		if err == nil {
+			return int64(reg.nrows), nil
+		}
+		if !errors.Is(err, errors.ErrUnsupported) {
+			return 0, err
+		}
+	}
+	tx, err := c.pin.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	res, err := insertRows(ctx, sch, tx, name, reg.names, reg.cols, reg.nrows)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return res.rowsAffected, nil
+}
+
+// unregister drops a registered table for verb.
+func (c *Conn) unregister(ctx context.Context, verb, name string) error {
+	defer c.invalidateCache()
+	if err := c.exec(ctx, verb, c.pin, "DROP TABLE IF EXISTS temp."+quoteName(name)); err != nil {
+		return err
+	}
+	delete(c.registered, name)
+	return nil
+}
+
+// repin replaces the pinned connection of c by a new one of the pool and
+// registers its tables again there, for verb, copying a private in-memory
+// database over. Its open cursors, transactions and prepared statements
+// must not use the old one.
+func (c *Conn) repin(ctx context.Context, verb string) error {
+	regs := c.registered
+	var restore func(*stdsql.Conn) error
+	if c.private {
+		var err error
+		if restore, err = driverSchemes[c.driver].snapshot(ctx, c.pin); err != nil {
+			return fmt.Errorf("copy the in-memory database: %w", err)
+		}
+	}
+	// The TEMP tables go with the old connection, which the pool discards.
+	err := c.pin.Close()
+	c.pin, c.registered = nil, nil
+	if restore != nil {
+		pin, perr := c.db.Conn(ctx)
+		if perr != nil {
+			return errors.Join(err, perr)
+		}
+		c.pin = pin
+		if rerr := restore(pin); rerr != nil {
+			return errors.Join(err, fmt.Errorf("copy the in-memory database: %w", rerr))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(regs)) {
+		if rerr := c.register(ctx, verb, name, regs[name]); rerr != nil {
+			err = errors.Join(err, fmt.Errorf("register %q again: %w", name, rerr))
+		}
+	}
+	return err
+}
+
+// registerType returns the SQL type of a column of a registered table.
+func registerType(col goal.V, nrows int) (string, error) {
+	switch xv := col.BV().(type) {
+	case *goal.AI, *goal.AB:
+		return "BIGINT", nil
+	case *goal.AF:
+		return "DOUBLE", nil
+	case *goal.AS:
+		return "VARCHAR", nil
+	case *Times:
+		if xv.sqlType == "" {
+			return "TIMESTAMP", nil
+		}
+		return xv.sqlType, nil
+	}
+	kind := kindNull
+	for i := range nrows {
+		v, err := columnValue(col, i)
+		if err != nil {
+			return "", fmt.Errorf("[%d]: %w", i, err)
+		}
+		if v == nil {
+			continue
+		}
+		k := kindOf(v)
+		if _, ok := v.([]byte); !ok && k == kindOther {
+			return "", fmt.Errorf("[%d]: unsupported value of type %T", i, v)
+		}
+		var ok bool
+		if kind, ok = mergeKind(kind, k); !ok {
+			return "", fmt.Errorf("[%d]: values of mixed types", i)
+		}
+	}
+	switch kind {
+	case kindInt:
+		return "BIGINT", nil
+	case kindFloat:
+		return "DOUBLE", nil
+	case kindString, kindNull:
+		return "VARCHAR", nil
+	}
+	return "BLOB", nil
+}
@@ -0,0 +1,111 @@
+package sql_test
+
+import (
+	"strings"
+	"testing"
+)
+
+// ---------------------------------------------------------------------------
+// TestRegister
+// ---------------------------------------------------------------------------
+
+func TestRegister(t *testing.T) {
+	for _, uri := range []string{"sqlite://:memory:", "duckdb://"} {
+		ctx := newCtx(t)
+		ctx.AssignGlobal("db", eval(t, ctx, `sql.open["`+uri+`";..[MaxOpenConns:1]]`))
+		eval(t, ctx, `sql.exec[db;"CREATE TABLE orders (id INTEGER, user_id INTEGER, total DOUBLE)"]`)
+		eval(t, ctx, `sql.exec[db;"INSERT INTO orders VALUES (1, 10, 2.5), (2, 20, 4.0), (3, 10, 1.0)"]`)
+
+		if got := mustS(t, eval(t, ctx, `sql.register[db;"users";..[id:10 20;name:("ann";"bob");score:1.5 0n]]`)); got != "users" {
+			t.Fatalf("%s: expected users, got %s", uri, got)
+		}
+		v := eval(t, ctx, `db sql.q "SELECT u.name, sum(o.total) AS total FROM orders o JOIN users u ON o.user_id = u.id GROUP BY u.name ORDER BY u.name"`)
+		if got := strCol(t, ctx, v, "name"); len(got) != 2 || got[0] != "ann" {
+			t.Errorf("%s: join: got names %q", uri, got)
+		}
+		if got := dictLookup(t, ctx, mustDict(t, ctx, v), "total").Sprint(ctx, true); got != "3.5 4.0" {
+			t.Errorf("%s: join: expected totals 3.5 4.0, got %s", uri, got)
+		}
+		if n := mustI(t, eval(t, ctx, `+/nan (db sql.q "SELECT score FROM users")"score"`)); n != 1 {
+			t.Errorf("%s: expected one NULL score, got %d", uri, n)
+		}
+
+		// Registering again replaces the data; AV columns take the type of
+		// their values.
+		eval(t, ctx, `sql.register[db;"users";..[id:30 40;name:("cy";0n)]]`)
+		if got := strCol(t, ctx, eval(t, ctx, `db sql.q "SELECT name FROM users ORDER BY id"`), "name"); len(got) != 2 || got[0] != "cy" {
+			t.Errorf("%s: replace: got %q", uri, got)
+		}
+
+		// A table sql.register did not create is left alone.
+		evalPanic(t, ctx, `sql.register[db;"orders";..[id:,1]]`)
+		evalPanic(t, ctx, `db sql.unregister "orders"`)
+
+		if got := mustI(t, eval(t, ctx, `db sql.unregister "users"`)); got != 1 {
+			t.Errorf("%s: unregister: expected 1, got %d", uri, got)
+		}
+		evalPanic(t, ctx, `db sql.q "SELECT * FROM users"`)
+		evalPanic(t, ctx, `db sql.unregister "users"`)
+		if n := mustI(t, eval(t, ctx, `#(db sql.q "SELECT * FROM orders")"id"`)); n != 3 {
+			t.Errorf("%s: orders: expected 3 rows, got %d", uri, n)
+		}
+		eval(t, ctx, `sql.close db`)
+	}
+}
+
+func TestRegisterTx(t *testing.T) {
+	for _, uri := range []string{"sqlite://:memory:", "duckdb://"} {
+		ctx := newCtx(t)
+		ctx.AssignGlobal("db", eval(t, ctx, `sql.open "`+uri+`"`))
+		eval(t, ctx, `sql.register[db;"users";..[id:10 20;name:("ann";"bob")]]`)
+		// The first transaction runs on the connection of the table.
+		if n := mustI(t, eval(t, ctx, `sql.tx[db;{[tx] #(tx sql.q "SELECT * FROM users")"id"}]`)); n != 2 {
+			t.Errorf("%s: tx: expected 2 rows, got %d", uri, n)
+		}
+		eval(t, ctx, `tx: sql.begin db`)
+		evalPanic(t, ctx, `sql.register[db;"users";..[id:,30]]`)
+		eval(t, ctx, `sql.rollback tx`)
+		if n := mustI(t, eval(t, ctx, `#(db sql.q "SELECT * FROM users")"id"`)); n != 2 {
+			t.Errorf("%s: after tx: expected 2 rows, got %d", uri, n)
+		}
+		eval(t, ctx, `sql.close db`)
+	}
+}
+
+func TestRegisterDroppedOnClose(t *testing.T) {
+	path := t.TempDir() + "/reg.db"
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", eval(t, ctx, `sql.open["sqlite://`+path+`"]`))
+	eval(t, ctx, `sql.register[db;"tmp";..[x:1 2 3]]`)
+	// The TEMP table is not written to the database file.
+	ctx.AssignGlobal("db2", eval(t, ctx, `sql.open["sqlite://`+path+`"]`))
+	if n := mustI(t, eval(t, ctx, `#(sql.tables db2)"name"`)); n != 0 {
+		t.Errorf("expected no tables in the file while registered, got %d", n)
+	}
+	eval(t, ctx, `sql.close db2`)
+	eval(t, ctx, `sql.close db`)
+
+	ctx.AssignGlobal("db", eval(t, ctx, `sql.open["sqlite://`+path+`"]`))
+	if n := mustI(t, eval(t, ctx, `#(sql.tables db)"name"`)); n != 0 {
+		t.Errorf("expected no tables after close, got %d", n)
+	}
+	eval(t, ctx, `sql.close db`)
+}
+
+func TestRegisterErrors(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	for _, tt := range []struct{ src, want string }{
+		{`sql.register[db;"t";1 2 3]`, "columnar dict"},
+		{`sql.register[db;"t";..[a:1 2;b:,3]]`, "length"},
+		{`sql.register[db;"t";..[a:(1;"x")]]`, "mixed types"},
+		{`sql.register[db;"t";..[a:(1 2;3)]]`, "unsupported"},
+		{`sql.tx[db;{[tx] sql.register[tx;"t";..[a:,1]]}]`, "expected sql.conn"},
+		{`db sql.unregister 1`, "string name"},
+		{`sql.register[db;"main.t";..[a:,1]]`, "without schema"},
+	} {
+		if msg := evalPanic(t, ctx, tt.src); !strings.Contains(msg, tt.want) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.src, tt.want, msg)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package sql
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// BV wrapper: sql.rows
+// ---------------------------------------------------------------------------
+
+// Rows wraps an open *sql.Rows as a Goal boxed value (sql.rows) that
+// sql.next reads one row, or one batch, at a time, so that rows can be
+// processed as they arrive, e.g. posted one by one with http.post.
+//
+// The rows are closed once exhausted, on error, by sql.close, or when the
+// value is garbage collected; until then they hold one connection of the
+// pool.
+type Rows struct {
+	cur     *Cursor
+	batch   int // rows per sql.next result, or 0 for one row as a dict
+	cleanup runtime.Cleanup
+}
+
+func (r *Rows) Append(_ *goal.Context, dst []byte, _ bool) []byte {
+	state := "open"
+	if r.cur.done {
+		state = "done"
+	}
+	return append(dst, fmt.Sprintf("sql.rows[%s]", state)...)
+}
+func (r *Rows) Matches(y goal.BV) bool { yv, ok := y.(*Rows); return ok && r == yv }
+func (r *Rows) Type() string           { return "sql.rows" }
+
+// close releases the underlying rows. It is safe to call more than once.
+func (r *Rows) close() error {
+	r.cleanup.Stop()
+	return r.cur.close()
+}
+
+// next returns the next row as a dict, or the next batch as a QueryResult
+// dict, and false once the rows are exhausted.
+func (r *Rows) next() (goal.V, bool, error) {
+	n := r.batch
+	if n == 0 {
+		n = 1
+	}
+	result, count, err := r.cur.fetch(n)
+	if err != nil || count == 0 {
+		r.cleanup.Stop()
+		return goal.V{}, false, err
+	}
+	if r.batch > 0 {
+		return result, true, nil
+	}
+	return rowDict(r.cur.cols, result), true, nil
+}
+
+// rowDict turns a one-row QueryResult dict with the given columns into a
+// dict of the row's values. A sql.time value stays a one-element sql.time.
+func rowDict(cols []string, t goal.V) goal.V {
+	d, ok := t.BV().(*goal.D)
+	if !ok {
+		return t
+	}
+	av, ok := d.ValueArray().(*goal.AV)
+	if !ok {
+		return t
+	}
+	vals := make([]goal.V, len(av.Slice))
+	for i, col := range av.Slice {
+		switch c := col.BV().(type) {
+		case interface{ At(i int) goal.V }:
+			vals[i] = c.At(0)
+		default:
+			vals[i] = col
+		}
+	}
+	return goal.NewD(goal.NewAS(cols), goal.NewAV(vals))
+}
+
+// ---------------------------------------------------------------------------
+// sql.rows  (dyad: conn sql.rows "query"  or  sql.rows[conn;"query";args;opts])
+// ---------------------------------------------------------------------------
+
+// vfRows executes a query and returns a sql.rows value over its result
+// rows, which sql.next reads one at a time as dicts mapping column names to
+// values. With the Batch:n option, sql.next returns columnar dicts of up to
+// n rows instead, as sql.fetch does. The rows are closed once exhausted,
+// on error, by sql.close r, or when the sql.rows value is garbage
+// collected; until then they hold a connection.
+//
+// Usage:
+//
+//	r: db sql.rows "SELECT * FROM events"
+//	r: sql.rows[db;"SELECT * FROM events WHERE day=?";,"2024-01-02";..[Batch:1000]]
+//
+// conn accepts either sql.conn or sql.tx.
+func vfRows(_ *goal.Context, args []goal.V) goal.V {
+	call, err := parseConnQueryArgs("sql.rows", args)
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	query, sqlArgs, err := call.bind()
+	if err != nil {
+		return goal.Panicf("sql.rows: %v", err)
+	}
+
+	ctx, cancel := newContext(call.timeout)
+	untrack := track(cancel)
+	defer untrack()
+	start := time.Now()
+	rows, err := call.conn.QueryContext(ctx, query, sqlArgs...)
+	call.db.observe(stmtEvent{verb: "sql.rows", query: query, args: sqlArgs, rows: -1, elapsed: time.Since(start), err: err})
+	if !readOnlyQuery(call.query, call.scheme.script) {
+		call.db.invalidateCache()
+	}
+	if err != nil {
+		cancel()
+		return goal.Panicf("sql.rows %q: %v", call.query, callErr(ctx, err))
+	}
+	cols, colTypes, err := rowsColumns(rows)
+	if err != nil {
+		rows.Close()
+		cancel()
+		return goal.Panicf("sql.rows %q: %v", call.query, callErr(ctx, err))
+	}
+	cur := &Cursor{rows: rows, cols: cols, colTypes: colTypes, opts: call.opts, ctx: ctx, cancel: cancel, conn: call.db}
+	call.db.addCursor(cur)
+	r := &Rows{cur: cur, batch: call.opts.batch}
+	// The cleanup must not reference r, which would keep it reachable.
+	r.cleanup = runtime.AddCleanup(r, func(cur *Cursor) { _ = cur.close() }, cur)
+	return goal.NewV(r)
+}
+
+// ---------------------------------------------------------------------------
+// sql.next  (monad: sql.next r)
+// ---------------------------------------------------------------------------
+
+// vfNext returns the next row of a sql.rows value as a dict (or the next
+// batch as a columnar dict with the Batch option), and 0i once the rows are
+// exhausted, so that the while form of / loops over them.
+//
+// Usage:
+//
+//	row: sql.next r
+//	{x}{post x; sql.next r}/sql.next r
+func vfNext(_ *goal.Context, args []goal.V) goal.V {
+	if len(args) != 1 {
+		return goal.Panicf("sql.next r : expected 1 argument, got %d", len(args))
+	}
+	r, ok := args[0].BV().(*Rows)
+	if !ok {
+		return goal.Panicf("sql.next r : expected sql.rows, got %q", args[0].Type())
+	}
+	v, ok, err := r.next()
+	if err != nil {
+		return goal.Panicf("sql.next r : %v", err)
+	}
+	if !ok {
+		return goal.NewI(0)
+	}
+	return v
+}
@@ -0,0 +1,136 @@
+package sql_test
+
+import (
+	"strings"
+	"testing"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// TestRowsNext
+// ---------------------------------------------------------------------------
+
+func TestRowsNext(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT))
+
+	r := eval(t, ctx, `sql.rows[db;"SELECT id, name FROM t ORDER BY id"]`)
+	if r.Type() != "sql.rows" {
+		t.Fatalf("sql.rows: expected sql.rows, got %q", r.Type())
+	}
+	ctx.AssignGlobal("r", r)
+
+	for i, name := range []string{"a", "b", "c", "d", "e"} {
+		row := mustDict(t, ctx, eval(t, ctx, `sql.next r`))
+		if id := mustI(t, dictLookup(t, ctx, row, "id")); id != int64(i+1) {
+			t.Fatalf("row #%d: expected id %d, got %d", i, i+1, id)
+		}
+		if got := dictLookup(t, ctx, row, "name").Sprint(ctx, true); got != `"`+name+`"` {
+			t.Fatalf("row #%d: expected name %q, got %s", i, name, got)
+		}
+	}
+	// Exhausted rows return 0i, also on later calls.
+	for range 2 {
+		if v := eval(t, ctx, `sql.next r`); mustI(t, v) != 0 {
+			t.Fatalf("exhausted rows: expected 0i, got %s", v.Sprint(ctx, true))
+		}
+	}
+	if got := r.Sprint(ctx, false); got != "sql.rows[done]" {
+		t.Fatalf("exhausted rows: expected sql.rows[done], got %s", got)
+	}
+}
+
+func TestRowsLoop(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT))
+
+	v := eval(t, ctx, `r: sql.rows[db;"SELECT id FROM t WHERE id > ? ORDER BY id";,2]
+ids:!0; {x}{ids,:x"id"; sql.next r}/sql.next r; ids`)
+	if got := v.Sprint(ctx, true); got != "3 4 5" {
+		t.Fatalf("loop over rows: expected 3 4 5, got %s", got)
+	}
+}
+
+func TestRowsBatch(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT))
+	ctx.AssignGlobal("r", eval(t, ctx, `sql.rows[db;"SELECT id FROM t ORDER BY id";();..[Batch:2]]`))
+
+	for i, want := range []string{"1 2", "3 4", ",5"} {
+		v := eval(t, ctx, `sql.next r`)
+		if got := dictLookup(t, ctx, mustDict(t, ctx, v), "id").Sprint(ctx, true); got != want {
+			t.Fatalf("batch #%d: expected %s, got %s", i, want, got)
+		}
+	}
+	if v := eval(t, ctx, `sql.next r`); mustI(t, v) != 0 {
+		t.Fatalf("exhausted batches: expected 0i, got %s", v.Sprint(ctx, true))
+	}
+}
+
+func TestRowsTx(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT))
+
+	v := eval(t, ctx, `sql.tx[db;{[tx] r: tx sql.rows "SELECT count(*) AS n FROM t"; (sql.next r)"n"}]`)
+	if mustI(t, v) != 5 {
+		t.Fatalf("sql.rows in a transaction: expected 5, got %s", v.Sprint(ctx, true))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// TestRowsClose
+// ---------------------------------------------------------------------------
+
+func TestRowsClose(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT))
+	ctx.AssignGlobal("r", eval(t, ctx, `sql.rows[db;"SELECT id FROM t"]`))
+
+	eval(t, ctx, `sql.next r`)
+	if mustI(t, eval(t, ctx, `sql.close r`)) != 1 {
+		t.Fatal("sql.close r: expected 1")
+	}
+	if v := eval(t, ctx, `sql.next r`); mustI(t, v) != 0 {
+		t.Fatalf("next after close: expected 0i, got %s", v.Sprint(ctx, true))
+	}
+	// Closing released the connection to the pool.
+	if mustI(t, eval(t, ctx, `*(sql.q[db;"SELECT count(*) AS n FROM t"])"n"`)) != 5 {
+		t.Fatal("query after close: expected 5")
+	}
+}
+
+func TestRowsErrors(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT))
+
+	for _, tt := range []struct{ src, want string }{
+		{`sql.q[db;"SELECT id FROM t";();..[Batch:2]]`, "only applies to sql.rows"},
+		{`sql.rows[db;"SELECT id FROM t";();..[NullMask:1]]`, "needs Batch"},
+		{`sql.rows[db;"SELECT id FROM t";();..[Batch:-1]]`, "Batch"},
+		{`sql.rows[db;"SELECT nope FROM t"]`, "sql.rows"},
+		{`sql.next db`, "expected sql.rows"},
+	} {
+		if msg := evalPanic(t, ctx, tt.src); !strings.Contains(msg, tt.want) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.src, tt.want, msg)
+		}
+	}
+}
+
+func TestDuckDBRows(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	ctx.AssignGlobal("r", eval(t, ctx, `sql.rows[db;"SELECT range AS id FROM range(4)"]`))
+
+	var sum int64
+	for {
+		v := eval(t, ctx, `sql.next r`)
+		if _, ok := v.BV().(*goal.D); !ok {
+			break
+		}
+		sum += mustI(t, dictLookup(t, ctx, mustDict(t, ctx, v), "id"))
+	}
+	if sum != 6 {
+		t.Fatalf("duckdb rows: expected 6, got %d", sum)
+	}
+}
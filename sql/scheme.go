@@ -0,0 +1,167 @@
+package sql
+
+import (
+	stdsql "database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ---------------------------------------------------------------------------
+// Driver registry for embedders
+// ---------------------------------------------------------------------------
+
+// Scheme describes how the sql verbs use a database/sql driver opened under
+// a URI scheme added with RegisterScheme. The zero value suits a driver
+// taking ? placeholders, without introspection queries.
+type Scheme struct {
+	// DSN, if set, rewrites the part of a sql.open URI after "scheme://"
+	// into the data source name given to the driver, e.g. to add default
+	// parameters.
+	DSN func(dsn string) (string, error)
+
+	// Placeholders is the driver's syntax of positional parameters, to
+	// which the ? placeholders of queries (and :name ones, unless
+	// NamedParams) are rewritten.
+	Placeholders PlaceholderStyle
+
+	// NamedParams reports whether the driver binds :name placeholders from
+	// database/sql.Named arguments.
+	NamedParams bool
+
+	// Savepoints reports whether the database supports SAVEPOINT, which
+	// nested sql.tx calls use.
+	Savepoints bool
+
+	// DollarQuotes reports whether $$…$$ and $tag$…$tag$ quote strings, so
+	// that sql.script and sql.migrate do not split statements inside them.
+	DollarQuotes bool
+
+	// TablesSQL, ColumnsSQL and IndexesSQL are the queries of sql.tables,
+	// sql.columns and sql.indexes, which report unsupported when empty.
+	// TablesSQL takes no parameters and returns (schema, name, type);
+	// ColumnsSQL returns (name, type, nullable, default, pk) and IndexesSQL
+	// (name, unique, primary, columns), both taking the parameters (table,
+	// schema) in the driver's placeholder syntax.
+	TablesSQL  string
+	ColumnsSQL string
+	IndexesSQL string
+
+	// DefaultSchema is the schema of table names given to sql.columns and
+	// sql.indexes without one (default "main").
+	DefaultSchema string
+
+	// Types replaces the column types of the tables the verbs create:
+	// BIGINT, DOUBLE, VARCHAR, BLOB and TIMESTAMP (sql.register, and the
+	// bookkeeping table of sql.migrate) and INTEGER, REAL and TEXT
+	// (sql.read), e.g. "DOUBLE" by "DOUBLE PRECISION".
+	Types map[string]string
+
+	// Value, if set, converts a value scanned from a result column whose
+	// database type name is dbType, before the default conversion to Goal,
+	// reporting false to keep v. It can turn driver-specific types into
+	// int64, float64, string, []byte, bool or time.Time values.
+	Value func(v any, dbType string) (any, bool)
+}
+
+// PlaceholderStyle is the syntax of a driver's positional parameters.
+type PlaceholderStyle int
+
+// Placeholder styles.
+const (
+	PlaceholderQuestion PlaceholderStyle = iota // ? (SQLite, DuckDB, MySQL)
+	PlaceholderDollar                           // $1, $2, … (PostgreSQL)
+	PlaceholderAtP                              // @p1, @p2, … (SQL Server)
+)
+
+// RegisterScheme makes sql.open "scheme://dsn" open the database/sql driver
+// registered as driverName, so that a program embedding ari can use the
+// sql verbs with its own drivers. It must be called before Goal code runs,
+// as sql.open does not synchronise with it, and fails if the scheme is
+// already registered or the driver is not.
+//
+// Usage:
+//
+//	err := sql.RegisterScheme("postgres", "pgx", sql.Scheme{
+//		Placeholders:  sql.PlaceholderDollar,
+//		Savepoints:    true,
+//		DollarQuotes:  true,
+//		DefaultSchema: "public",
+//		Types:         map[string]string{"DOUBLE": "DOUBLE PRECISION", "BLOB": "BYTEA"},
+//	})
+func RegisterScheme(scheme, driverName string, opts Scheme) error {
+	if scheme == "" || strings.ContainsAny(scheme, ":/") {
+		return fmt.Errorf("sql.RegisterScheme: invalid scheme %q", scheme)
+	}
+	if _, ok := driverSchemes[scheme]; ok {
+		return fmt.Errorf("sql.RegisterScheme: scheme %q is already registered", scheme)
+	}
+	if !slices.Contains(stdsql.Drivers(), driverName) {
+		return fmt.Errorf("sql.RegisterScheme: unknown database/sql driver %q", driverName)
+	}
+	if opts.Placeholders < PlaceholderQuestion || opts.Placeholders > PlaceholderAtP {
+		return errors.New("sql.RegisterScheme: invalid placeholder style")
+	}
+	driverSchemes[scheme] = driverScheme{
+		driverName:    driverName,
+		namedParams:   opts.NamedParams,
+		placeholders:  opts.Placeholders,
+		savepoints:    opts.Savepoints,
+		script:        scriptSyntax{dollarQuotes: opts.DollarQuotes},
+		tablesSQL:     opts.TablesSQL,
+		columnsSQL:    opts.ColumnsSQL,
+		indexesSQL:    opts.IndexesSQL,
+		defaultSchema: opts.DefaultSchema,
+		types:         maps.Clone(opts.Types),
+		dsn:           opts.DSN,
+		scanValue:     opts.Value,
+	}
+	return nil
+}
+
+// positional rewrites the ? placeholders of query to the driver's syntax;
+// a numbered ?NNN keeps its number.
+func (sch driverScheme) positional(query string) string {
+	var prefix string
+	switch sch.placeholders {
+	case PlaceholderDollar:
+		prefix = "$"
+	case PlaceholderAtP:
+		prefix = "@p"
+	default:
+		return query
+	}
+	var sb strings.Builder
+	last, n := 0, 0 // start of the query text not yet copied to sb, placeholder count
+	for _, ph := range scanPlaceholders(query, sch.script) {
+		if ph.name != "" {
+			continue
+		}
+		n++
+		sb.WriteString(query[last:ph.start])
+		sb.WriteString(prefix)
+		if ph.numbered {
+			sb.WriteString(query[ph.start+1 : ph.end])
+		} else {
+			sb.WriteString(strconv.Itoa(n))
+		}
+		last = ph.end
+	}
+	if n == 0 {
+		return query
+	}
+	sb.WriteString(query[last:])
+	return sb.String()
+}
+
+// columnType returns the driver's name of a column type of created tables
+// (see Scheme.Types).
+func (sch driverScheme) columnType(t string) string {
+	if x, ok := sch.types[t]; ok {
+		return x
+	}
+	return t
+}
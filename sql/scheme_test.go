@@ -0,0 +1,195 @@
+package sql_test
+
+import (
+	stdsql "database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	goalsql "github.com/semperos/ari/sql"
+)
+
+// ---------------------------------------------------------------------------
+// fake driver
+// ---------------------------------------------------------------------------
+
+// fakeDriver is an in-process database/sql driver standing for an
+// embedder's own. It records the statements it executes and answers every
+// query with one row describing it.
+type fakeDriver struct{}
+
+// fakeExecs records the statements executed through fakeDriver.
+var fakeExecs struct { //nolint:gochecknoglobals // shared with the driver's connections
+	sync.Mutex
+	stmts []string
+}
+
+// fakeDecimal is a driver-specific value type: an amount in cents.
+type fakeDecimal int64
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) { return &fakeConn{dsn: dsn}, nil }
+
+type fakeConn struct{ dsn string }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return fakeTx{}, nil }
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	fakeExecs.Lock()
+	fakeExecs.stmts = append(fakeExecs.stmts, s.query)
+	fakeExecs.Unlock()
+	return fakeResult{}, nil
+}
+
+// Query returns the columns dsn, query, args (formatted with %v) and amount
+// (a fakeDecimal of database type NUMERIC).
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	row := []driver.Value{s.conn.dsn, s.query, fmt.Sprint(args), fakeDecimal(1250)}
+	return &fakeRows{row: row}, nil
+}
+
+type fakeResult struct{}
+
+func (fakeResult) LastInsertId() (int64, error) { return 0, nil }
+func (fakeResult) RowsAffected() (int64, error) { return 1, nil }
+
+type fakeRows struct {
+	row  []driver.Value
+	done bool
+}
+
+func (r *fakeRows) Columns() []string { return []string{"dsn", "query", "args", "amount"} }
+func (r *fakeRows) Close() error      { return nil }
+func (r *fakeRows) ColumnTypeDatabaseTypeName(i int) string {
+	return []string{"TEXT", "TEXT", "TEXT", "NUMERIC"}[i]
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.row)
+	return nil
+}
+
+// registerFake registers fakeDriver as "ari-fake" and its "fake" URI
+// scheme, once for all tests.
+var registerFake = sync.OnceValue(func() error { //nolint:gochecknoglobals // database/sql drivers register once per process
+	stdsql.Register("ari-fake", fakeDriver{})
+	return goalsql.RegisterScheme("fake", "ari-fake", goalsql.Scheme{
+		DSN:           func(dsn string) (string, error) { return "fake:" + dsn, nil },
+		Placeholders:  goalsql.PlaceholderDollar,
+		TablesSQL:     "SELECT tables",
+		ColumnsSQL:    "SELECT columns WHERE table_name = $1 AND table_schema = $2",
+		DefaultSchema: "public",
+		Types:         map[string]string{"DOUBLE": "DOUBLE PRECISION"},
+		Value: func(v any, dbType string) (any, bool) {
+			if d, ok := v.(fakeDecimal); ok && dbType == "NUMERIC" {
+				return float64(d) / 100, true
+			}
+			return nil, false
+		},
+	})
+})
+
+// ---------------------------------------------------------------------------
+// TestRegisterScheme
+// ---------------------------------------------------------------------------
+
+func TestRegisterScheme(t *testing.T) {
+	if err := registerFake(); err != nil {
+		t.Fatal(err)
+	}
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", eval(t, ctx, `sql.open "fake://orders"`))
+
+	v := eval(t, ctx, `db sql.q["SELECT * FROM t WHERE a = ? AND b <> '?' AND c IN (?)";(1;sql.list 2 3)]`)
+	if got := strCol(t, ctx, v, "dsn"); got[0] != "fake:orders" {
+		t.Errorf("DSN: expected fake:orders, got %q", got[0])
+	}
+	if got := strCol(t, ctx, v, "query"); got[0] != "SELECT * FROM t WHERE a = $1 AND b <> '?' AND c IN ($2, $3)" {
+		t.Errorf("placeholders: got %q", got[0])
+	}
+	if got := strCol(t, ctx, v, "args"); got[0] != "[1 2 3]" {
+		t.Errorf("args: got %q", got[0])
+	}
+	if got := dictLookup(t, ctx, mustDict(t, ctx, v), "amount").Sprint(ctx, true); got != ",12.5" {
+		t.Errorf("Value: expected ,12.5, got %s", got)
+	}
+
+	v = eval(t, ctx, `db sql.q["SELECT * FROM t WHERE a = :a OR b = :a";..[a:7]]`)
+	if got := strCol(t, ctx, v, "query"); got[0] != "SELECT * FROM t WHERE a = $1 OR b = $2" {
+		t.Errorf("named: got %q", got[0])
+	}
+	st := `st: db sql.prepare "SELECT * FROM t WHERE a = ?1"; st sql.q ,5`
+	if got := strCol(t, ctx, eval(t, ctx, st), "query"); got[0] != "SELECT * FROM t WHERE a = $1" {
+		t.Errorf("prepared: got %q", got[0])
+	}
+
+	// Introspection uses the scheme's queries and default schema.
+	if got := strCol(t, ctx, eval(t, ctx, `sql.tables db`), "query"); got[0] != "SELECT tables" {
+		t.Errorf("sql.tables: got %q", got[0])
+	}
+	if got := strCol(t, ctx, eval(t, ctx, `db sql.columns "t"`), "args"); got[0] != "[t public]" {
+		t.Errorf("sql.columns: got %q", got[0])
+	}
+	if msg := evalPanic(t, ctx, `db sql.indexes "t"`); !strings.Contains(msg, "not supported") {
+		t.Errorf("sql.indexes: expected not supported, got %s", msg)
+	}
+
+	// Statements the verbs build follow the scheme too.
+	fakeExecs.Lock()
+	fakeExecs.stmts = nil
+	fakeExecs.Unlock()
+	eval(t, ctx, `sql.register[db;"prices";..[id:1 2;price:1.5 2.5]]`)
+	fakeExecs.Lock()
+	stmts := slices.Clone(fakeExecs.stmts)
+	fakeExecs.Unlock()
+	for _, want := range []string{
+		`CREATE TABLE "prices" ("id" BIGINT, "price" DOUBLE PRECISION)`,
+		`INSERT INTO "prices" ("id", "price") VALUES ($1, $2)`,
+	} {
+		if !slices.Contains(stmts, want) {
+			t.Errorf("expected statement %s, got %q", want, stmts)
+		}
+	}
+}
+
+func TestRegisterSchemeErrors(t *testing.T) {
+	if err := registerFake(); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ scheme, driver, want string }{
+		{"fake", "ari-fake", "already registered"},
+		{"sqlite", "sqlite", "already registered"},
+		{"pg", "no-such-driver", "unknown database/sql driver"},
+		{"a:b", "ari-fake", "invalid scheme"},
+		{"", "ari-fake", "invalid scheme"},
+	} {
+		err := goalsql.RegisterScheme(tt.scheme, tt.driver, goalsql.Scheme{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("RegisterScheme(%q, %q): expected error containing %q, got %v", tt.scheme, tt.driver, tt.want, err)
+		}
+	}
+}
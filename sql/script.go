@@ -0,0 +1,329 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// sql.script  (dyad: conn sql.script "src"  or  sql.script[conn;"src";opts])
+// ---------------------------------------------------------------------------
+
+// vfScript splits SQL text into statements and executes them in order.
+//
+// Returns a columnar dict with one row per executed statement: "index"
+// (position in the script, from 0), "rowsAffected" and "error" (the error
+// message, or "" on success). Execution stops at the first failing
+// statement. An opts dict (see scriptOptions) changes this:
+//
+//	Tx               i  – run the script in one transaction, rolled back if
+//	                      any statement fails (0/1)
+//	ContinueOnError  i  – run the remaining statements after a failure (0/1)
+//
+// An interruption or timeout between two statements fails the next one and
+// stops the script even with ContinueOnError, so that a Tx script rolls
+// back.
+//
+// The statements of a script given a sql.conn run on one connection, so
+// that session state such as BEGIN … COMMIT, PRAGMA, ATTACH or TEMP tables
+// carries from one to the next (as in a sqlite3 .dump). A transaction
+// begun by the script is rolled back if a statement fails.
+//
+// Usage:
+//
+//	r: db sql.script read "schema.sql"
+//	r: sql.script[db;src;..[Tx:1]]
+//
+// conn accepts either sql.conn or sql.tx.
+func vfScript(_ *goal.Context, args []goal.V) goal.V {
+	var opts scriptOptions
+	switch len(args) {
+	case 2:
+		// args[0] = src (right), args[1] = conn (left)
+	case 3:
+		// args[0] = opts, args[1] = src, args[2] = conn
+		if err := parseOptions("sql.script[conn;src;opts]", args[0], &opts); err != nil {
+			return goal.Panicf("%v", err)
+		}
+		args = args[1:]
+	default:
+		return goal.Panicf("conn sql.script src : expected 2 or 3 arguments, got %d", len(args))
+	}
+	src, ok := args[0].BV().(goal.S)
+	if !ok {
+		return goal.Panicf("conn sql.script src : expected string script, got %q", args[0].Type())
+	}
+	q, sch, err := connScheme("conn sql.script src", args[1])
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	c := connOf(args[1])
+	defer c.invalidateCache()
+	stmts := splitStatements(string(src), sch.script)
+
+	ctx, done := callContext(c.timeout)
+	defer done()
+	var gtx *GoalTx
+	var conn *stdsql.Conn
+	if _, isConn := args[1].BV().(*Conn); isConn {
+		if opts.tx {
+			gtx, err = c.begin("sql.script", txOptions{})
+			if err != nil {
+				return goal.Panicf("conn sql.script src : begin: %v", err)
+			}
+			q = gtx.tx
+		} else {
+			var release func()
+			conn, release, err = c.conn(ctx)
+			if err != nil {
+				return goal.Panicf("conn sql.script src : %v", callErr(ctx, err))
+			}
+			defer release()
+			q = conn
+		}
+	}
+
+	var index, affected []int64
+	var errs []string
+	failed, began := false, false
+	for i, stmt := range stmts {
+		index = append(index, int64(i))
+		if err := ctx.Err(); err != nil {
+			// Interrupted or out of time between two statements: the
+			// script is not complete, whatever ContinueOnError says.
+			failed = true
+			affected = append(affected, 0)
+			errs = append(errs, callErr(ctx, err).Error())
+			break
+		}
+		start := time.Now()
+		res, err := q.ExecContext(ctx, stmt)
+		var sum execSummary
+		if err == nil {
+			sum.add(res)
+		}
+		c.observe(stmtEvent{verb: "sql.script", query: stmt, rows: sum.rowsAffected, elapsed: time.Since(start), err: err})
+		if err != nil {
+			failed = true
+			affected = append(affected, 0)
+			errs = append(errs, callErr(ctx, err).Error())
+			if !opts.continueOnError {
+				break
+			}
+			continue
+		}
+		affected = append(affected, sum.rowsAffected)
+		errs = append(errs, "")
+		began = began || beginsTx(stmt)
+	}
+	if conn != nil && failed && began {
+		// The connection goes back to the pool: it must not stay in the
+		// script's transaction. ROLLBACK fails harmlessly if it ended.
+		_ = c.exec(context.Background(), "sql.script", conn, "ROLLBACK")
+	}
+
+	if gtx != nil {
+		if err := gtx.end("sql.script", !failed); err != nil && !failed {
+			return goal.Panicf("conn sql.script src : commit: %v", err)
+		}
+	}
+	keys := goal.NewAS([]string{"index", "rowsAffected", "error"})
+	vals := goal.NewAV([]goal.V{
+		goal.NewAI(nonNil(index)),
+		goal.NewAI(nonNil(affected)),
+		goal.NewAS(nonNil(errs)),
+	})
+	return goal.NewD(keys, vals)
+}
+
+// beginsTx reports whether stmt begins a transaction (BEGIN or START
+// TRANSACTION), skipping leading comments.
+func beginsTx(stmt string) bool {
+	for {
+		stmt = strings.TrimSpace(stmt)
+		switch {
+		case strings.HasPrefix(stmt, "--"):
+			_, stmt, _ = strings.Cut(stmt, "\n")
+		case strings.HasPrefix(stmt, "/*"):
+			_, stmt, _ = strings.Cut(stmt, "*/")
+		default:
+			word := stmt
+			if i := strings.IndexFunc(stmt, func(r rune) bool { return !unicode.IsLetter(r) }); i >= 0 {
+				word = stmt[:i]
+			}
+			return strings.EqualFold(word, "BEGIN") || strings.EqualFold(word, "START")
+		}
+	}
+}
+
+// nonNil returns s, or an empty slice if s is nil, so that empty result
+// columns print as empty arrays.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+// scriptOptions holds the settings of sql.script parsed from an opts dict.
+type scriptOptions struct {
+	tx              bool
+	continueOnError bool
+}
+
+// apply sets a single script option.
+func (opts *scriptOptions) apply(key string, v goal.V) error {
+	var err error
+	switch key {
+	case "Tx":
+		opts.tx, err = boolArg(v, key)
+	case "ContinueOnError":
+		opts.continueOnError, err = boolArg(v, key)
+	default:
+		return fmt.Errorf("unknown option %q", key)
+	}
+	return err
+}
+
+// ---------------------------------------------------------------------------
+// Statement splitting
+// ---------------------------------------------------------------------------
+
+// scriptSyntax describes the driver-specific SQL syntax that matters when
+// splitting a script into statements.
+type scriptSyntax struct {
+	// bracketIdents: `ident` and [ident] quote identifiers (SQLite).
+	bracketIdents bool
+	// dollarQuotes: $$…$$ and $tag$…$tag$ quote strings (DuckDB).
+	dollarQuotes bool
+	// triggers: CREATE TRIGGER bodies hold ;-separated statements between
+	// BEGIN and END (SQLite).
+	triggers bool
+}
+
+// splitStatements splits src at the semicolons that end statements,
+// skipping those inside string literals, quoted identifiers, comments and
+// trigger bodies. Statements are trimmed; empty ones (only whitespace or
+// comments) are dropped.
+func splitStatements(src string, syn scriptSyntax) []string {
+	var stmts []string
+	var words []string // first words of the statement, upper-cased, to detect CREATE TRIGGER
+	start := 0
+	content := false // the statement has more than whitespace and comments
+	depth := 0       // BEGIN/CASE … END nesting inside a trigger body
+	end := func(i int) {
+		if content {
+			stmts = append(stmts, strings.TrimSpace(src[start:i]))
+		}
+		start, content, depth, words = i+1, false, 0, words[:0]
+	}
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '-' && strings.HasPrefix(src[i:], "--"):
+			if j := strings.IndexByte(src[i:], '\n'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(src)
+			}
+			continue
+		case c == '/' && strings.HasPrefix(src[i:], "/*"):
+			if j := strings.Index(src[i+2:], "*/"); j >= 0 {
+				i += j + 4
+			} else {
+				i = len(src)
+			}
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == ';' && depth == 0:
+			end(i)
+			i++
+			continue
+		}
+		content = true
+		switch {
+		case c == '\'' || c == '"':
+			i = skipQuoted(src, i, c)
+		case syn.bracketIdents && c == '`':
+			i = skipQuoted(src, i, c)
+		case syn.bracketIdents && c == '[':
+			if j := strings.IndexByte(src[i:], ']'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(src)
+			}
+		case syn.dollarQuotes && c == '$':
+			i = skipDollarQuoted(src, i)
+		case isNameStart(c):
+			j := i + 1
+			for j < len(src) && isNameChar(src[j]) {
+				j++
+			}
+			if syn.triggers {
+				depth = triggerDepth(&words, strings.ToUpper(src[i:j]), depth)
+			}
+			i = j
+		default:
+			i++
+		}
+	}
+	end(len(src))
+	return stmts
+}
+
+// triggerDepth tracks the BEGIN … END body of a CREATE TRIGGER statement:
+// given the next word of the statement (upper-cased) and the current body
+// nesting depth, it returns the new depth. words collects the first words
+// of the statement.
+func triggerDepth(words *[]string, word string, depth int) int {
+	if len(*words) < 3 {
+		*words = append(*words, word)
+	}
+	switch {
+	case depth > 0 && (word == "CASE" || word == "BEGIN"):
+		return depth + 1
+	case depth > 0 && word == "END":
+		return depth - 1
+	case depth == 0 && word == "BEGIN" && isCreateTrigger(*words):
+		return 1
+	}
+	return depth
+}
+
+// isCreateTrigger reports whether a statement starting with words is a
+// CREATE [TEMP|TEMPORARY] TRIGGER statement.
+func isCreateTrigger(words []string) bool {
+	if len(words) < 2 || words[0] != "CREATE" {
+		return false
+	}
+	if words[1] == "TEMP" || words[1] == "TEMPORARY" {
+		return len(words) > 2 && words[2] == "TRIGGER"
+	}
+	return words[1] == "TRIGGER"
+}
+
+// skipDollarQuoted returns the index just past the dollar-quoted string
+// ($$…$$ or $tag$…$tag$) starting at src[i], or i+1 if src[i] does not
+// start one (e.g. a $1 parameter).
+func skipDollarQuoted(src string, i int) int {
+	j := i + 1
+	for j < len(src) && isNameChar(src[j]) {
+		j++
+	}
+	if j >= len(src) || src[j] != '$' || (j > i+1 && !isNameStart(src[i+1])) {
+		return i + 1
+	}
+	tag := src[i : j+1]
+	if k := strings.Index(src[j+1:], tag); k >= 0 {
+		return j + 1 + k + len(tag)
+	}
+	return len(src)
+}
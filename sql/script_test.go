@@ -0,0 +1,158 @@
+package sql_test
+
+import (
+	"strings"
+	"testing"
+
+	goal "codeberg.org/anaseto/goal"
+
+	goalsql "github.com/semperos/ari/sql"
+)
+
+// ---------------------------------------------------------------------------
+// TestScript
+// ---------------------------------------------------------------------------
+
+const sqliteSchema = `
+-- Schema; with a comment holding a semicolon.
+CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT DEFAULT 'a;b');
+CREATE TABLE log (msg TEXT);
+/* a block comment; still a comment */
+CREATE TRIGGER users_ins AFTER INSERT ON users BEGIN
+    INSERT INTO log VALUES ('new;' || NEW.name);
+    INSERT INTO log VALUES (CASE WHEN NEW.id > 1 THEN 'big' ELSE 'small' END);
+END;
+INSERT INTO users (id, name) VALUES (1, 'x'), (2, 'y');
+;
+`
+
+func TestScriptSQLite(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	ctx.AssignGlobal("src", goal.NewS(sqliteSchema))
+
+	v := eval(t, ctx, `db sql.script src`)
+	d := mustDict(t, ctx, v)
+	if got := dictLookup(t, ctx, d, "index").Sprint(ctx, true); got != "0 1 2 3" {
+		t.Fatalf("index: expected 0 1 2 3, got %s", got)
+	}
+	if got := dictLookup(t, ctx, d, "rowsAffected").Sprint(ctx, true); got != "0 0 0 2" {
+		t.Fatalf("rowsAffected: expected 0 0 0 2, got %s", got)
+	}
+	for i, e := range strCol(t, ctx, v, "error") {
+		if e != "" {
+			t.Errorf("statement %d: unexpected error %s", i, e)
+		}
+	}
+	if n := mustI(t, eval(t, ctx, `#sql.q[db;"SELECT msg FROM log"]"msg"`)); n != 4 {
+		t.Fatalf("trigger: expected 4 log rows, got %d", n)
+	}
+
+	// An empty script runs nothing.
+	if n := mustI(t, eval(t, ctx, `#(db sql.script "  -- nothing;\n")"index"`)); n != 0 {
+		t.Fatalf("empty script: expected 0 statements, got %d", n)
+	}
+}
+
+func TestScriptErrors(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	ctx.AssignGlobal("src", goal.NewS(`CREATE TABLE a (x INTEGER); INSERT INTO nope VALUES (1); CREATE TABLE b (x INTEGER)`))
+
+	// Execution stops at the first failure.
+	errs := strCol(t, ctx, eval(t, ctx, `db sql.script src`), "error")
+	if len(errs) != 2 || errs[0] != "" || errs[1] == "" {
+		t.Fatalf("stop on error: expected [\"\" error], got %q", errs)
+	}
+	if n := mustI(t, eval(t, ctx, `#(sql.tables db)"name"`)); n != 1 {
+		t.Fatalf("stop on error: expected 1 table, got %d", n)
+	}
+
+	// ContinueOnError runs the rest.
+	eval(t, ctx, `sql.exec[db;"DROP TABLE a"]`)
+	errs = strCol(t, ctx, eval(t, ctx, `sql.script[db;src;..[ContinueOnError:1]]`), "error")
+	if len(errs) != 3 || errs[2] != "" {
+		t.Fatalf("continue on error: expected 3 statements, got %q", errs)
+	}
+
+	// In a transaction, a failure undoes the whole script.
+	eval(t, ctx, `sql.exec[db;"DROP TABLE a"]`)
+	eval(t, ctx, `sql.exec[db;"DROP TABLE b"]`)
+	eval(t, ctx, `sql.script[db;src;..[Tx:1]]`)
+	if n := mustI(t, eval(t, ctx, `#(sql.tables db)"name"`)); n != 0 {
+		t.Fatalf("Tx: expected no tables after rollback, got %d", n)
+	}
+
+	evalPanic(t, ctx, `db sql.script 42`)
+	evalPanic(t, ctx, `sql.script[db;src;..[Atomic:1]]`)
+}
+
+func TestScriptSession(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openFile(t, ctx, t.TempDir()+"/s.db", ""))
+	defer eval(t, ctx, `sql.close db`)
+	// The statements share one connection: its transaction and TEMP table.
+	ctx.AssignGlobal("src", goal.NewS(`BEGIN TRANSACTION;
+CREATE TEMP TABLE tmp (x INTEGER);
+INSERT INTO tmp VALUES (1), (2);
+CREATE TABLE t AS SELECT x FROM tmp;
+COMMIT;`))
+	errs := strCol(t, ctx, eval(t, ctx, `db sql.script src`), "error")
+	if strings.Join(errs, "") != "" {
+		t.Fatalf("expected no errors, got %q", errs)
+	}
+	if n := mustI(t, eval(t, ctx, `#(db sql.q "SELECT x FROM t")"x"`)); n != 2 {
+		t.Errorf("expected 2 rows, got %d", n)
+	}
+
+	// A failing script leaves no transaction open on the connection.
+	ctx.AssignGlobal("src", goal.NewS(`BEGIN; CREATE TABLE u (x INTEGER); INSERT INTO nope VALUES (1); COMMIT`))
+	errs = strCol(t, ctx, eval(t, ctx, `db sql.script src`), "error")
+	if errs[len(errs)-1] == "" {
+		t.Fatalf("expected the INSERT to fail, got %q", errs)
+	}
+	evalPanic(t, ctx, `db sql.q "SELECT * FROM u"`)
+	eval(t, ctx, `db sql.exec "INSERT INTO t VALUES (3)"`)
+}
+
+func TestScriptInterrupted(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("interrupt", ctx.RegisterMonad(".interrupt", func(_ *goal.Context, _ []goal.V) goal.V {
+		goalsql.Interrupt()
+		return goal.NewI(1)
+	}))
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	defer eval(t, ctx, `sql.close db`)
+	eval(t, ctx, `sql.func[db;"script_interrupt";{interrupt x}]`)
+	ctx.AssignGlobal("src", goal.NewS(`CREATE TABLE a (x INTEGER); SELECT script_interrupt(1); CREATE TABLE b (x INTEGER)`))
+
+	// The statement after the interruption fails, and the script rolls back.
+	errs := strCol(t, ctx, eval(t, ctx, `sql.script[db;src;..[Tx:1;ContinueOnError:1]]`), "error")
+	if len(errs) != 3 || !strings.Contains(errs[2], "interrupted") {
+		t.Fatalf("expected the last statement to be interrupted, got %q", errs)
+	}
+	if n := mustI(t, eval(t, ctx, `#(sql.tables db)"name"`)); n != 0 {
+		t.Fatalf("expected no tables after rollback, got %d", n)
+	}
+}
+
+func TestScriptDuckDB(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	ctx.AssignGlobal("src", goal.NewS(`
+CREATE TABLE t (s VARCHAR);
+INSERT INTO t VALUES ($$a;b$$), ($tag$c;'d$tag$);
+CREATE MACRO twice(x) AS x * 2;
+INSERT INTO t SELECT CAST(twice(21) AS VARCHAR);
+`))
+	v := eval(t, ctx, `sql.script[db;src;..[Tx:1]]`)
+	for i, e := range strCol(t, ctx, v, "error") {
+		if e != "" {
+			t.Errorf("statement %d: unexpected error %s", i, e)
+		}
+	}
+	got := strCol(t, ctx, eval(t, ctx, `sql.q[db;"SELECT s FROM t ORDER BY s"]`), "s")
+	if len(got) != 3 || got[0] != "42" || got[1] != "a;b" || got[2] != "c;'d" {
+		t.Fatalf("dollar quotes: expected [42 a;b c;'d], got %q", got)
+	}
+}
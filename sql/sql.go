@@ -16,20 +16,78 @@
 //	db: sql.open "duckdb://"           – DuckDB in-memory
 //	db: sql.open "duckdb:///data.db"   – DuckDB file-based
 //
+// An options dict configures the connection pool and the driver: SQLite
+// pragmas or DuckDB settings are set on every pooled connection, and the
+// printed sql.conn shows their effective values:
+//
+//	db: sql.open["sqlite://data.db";..[MaxOpenConns:4;Pragmas:..[journal_mode:"WAL";foreign_keys:1]]]
+//	db: sql.open["duckdb://";..[Settings:..[threads:4;memory_limit:"4GB"]]]
+//
+// SQLite gives each connection to ":memory:" its own database, so a
+// "sqlite://:memory:" sql.conn runs its statements on one connection, unless
+// the SharedCache option shares the database between the connections of the
+// pool, at the cost of table-level locking (see vfOpen).
+//
+// Goal runs one call at a time, so a call needing a connection while open
+// transactions, cursors and sql.rows values hold all MaxOpenConns of them
+// would wait forever: it is an error instead.
+//
 // # Verb summary
 //
 // Monads:
 //
 //	sql.open  "scheme://dsn"  – open a connection; returns sql.conn or error
-//	sql.close db              – close a connection; returns 1i or error
+//	sql.open["scheme://dsn";opts] – open with pool, driver and timeout options
+//	sql.close db              – close a connection, cursor, sql.rows or statement; returns 1i or error
+//	sql.tables db             – tables and views of a database; returns columnar dict
+//	sql.time  micros          – sql.time value(s) to bind as timestamps
+//	sql.meta  ts              – SQL type, zone and micros of a sql.time value
+//	sql.list  x               – bind array x as one parameter (for IN (?))
+//	sql.begin db              – start a transaction; returns sql.tx
+//	sql.commit tx             – commit a sql.begin transaction; returns 1i
+//	sql.rollback tx           – roll back a sql.begin transaction; returns 1i
+//	sql.next r                – next row of a sql.rows as a dict; 0i when exhausted
+//	sql.invalidate db         – drop the cached query results of a connection; returns their number
+//	sql.stats db              – pool and statement statistics of a connection; returns dict
 //
 // Dyads:
 //
 //	db sql.q    "SELECT ..."              – query; returns columnar dict
 //	db sql.q   ["SELECT ... WHERE x=?"; args]  – parameterised query
+//	db sql.q   ["SELECT ... WHERE x=:x"; ..[x:1]]  – named parameters
+//	sql.q[db;"SELECT ...";args;opts]   – query with an options dict
+//	db sql.cached "SELECT ..."          – query through the connection's result cache
 //	db sql.exec "INSERT ..."             – execute statement; returns exec dict
 //	db sql.exec["INSERT ... VALUES(?)"; args]  – parameterised exec
 //	db sql.tx  {[tx] ... }              – lambda-scoped transaction
+//	db sql.cursor "SELECT ..."          – query without scanning; returns sql.cursor
+//	cur sql.fetch n                     – next n rows of a cursor as columnar dict
+//	sql.each[cur;n;f]                   – apply f to each n-row batch of a cursor
+//	db sql.rows "SELECT ..."            – query read row by row with sql.next; returns sql.rows
+//	sql.insert[db;"table";t]            – bulk insert a columnar dict; returns exec dict
+//	db sql.describe "SELECT ..."        – column metadata of a query; returns columnar dict
+//	db sql.explain "SELECT ..."         – plan of a query, one row per node; returns columnar dict
+//	db sql.columns "table"              – columns of a table; returns columnar dict
+//	db sql.prepare "SELECT ... WHERE x=?" – prepare a statement; returns sql.stmt
+//	st sql.q args                       – run a prepared query (st sql.exec for statements)
+//	db sql.indexes "table"              – indexes of a table; returns columnar dict
+//	db sql.script "CREATE …; INSERT …"  – run a multi-statement script; returns columnar dict
+//	db sql.migrate "migrations"         – apply numbered migration files; returns columnar dict
+//	db sql.read "events.csv"            – load a CSV, JSON or Parquet file into a table; returns its name
+//	sql.write[db;"SELECT ...";"t.csv"]  – write a query's result to a file; returns exec dict
+//	sql.register[db;"name";t]           – make a columnar dict queryable as a table; returns name
+//	db sql.unregister "name"            – drop a sql.register table; returns 1i
+//	sql.func[db;"name";f]               – make Goal function f callable from SQL; returns name
+//
+// Each verb's doc comment (and its help entry) describes its options and
+// behaviour in detail.
+//
+// # Parameters
+//
+// An array (or scalar) of parameters binds positional ? placeholders in
+// order; a dict binds :name placeholders by key (see vfQuery). sql.list
+// binds an array as one parameter for IN (?) filters, and sql.time binds
+// timestamps.
 //
 // # QueryResult dict
 //
@@ -37,16 +95,20 @@
 //
 //	t"name"        – column array (AI | AF | AS | AV)
 //	#t"name"       – row count
-//	nan t"age"     – boolean array; 1 at each NULL position
+//	nan t"age"     – boolean array; 1 at each NULL position (numeric columns)
 //
 // Column arrays are specialised:
 //   - All integers, no NULLs        → AI
 //   - All floats, no NULLs          → AF
 //   - All strings, no NULLs         → AS
-//   - Integers + NULLs              → AF (Goal normalises I+NaN → AF)
-//   - Floats + NULLs                → AF (NaN stays in AF)
-//   - Strings + NULLs               → AV (S+NaN cannot be further normalised)
-//   - Mixed types, BLOBs, or others → AV (NULL slots hold 0n in all cases)
+//   - Integers + NULLs              → AF (NULLs are 0n, as Goal normalises I+NaN;
+//     integers beyond 2^53 lose precision)
+//   - Floats + NULLs                → AF (NULLs are 0n)
+//   - Strings + NULLs               → AS (NULLs are "")
+//   - Mixed types, BLOBs, or others → AV (NULL slots hold 0n)
+//
+// sql.cursor, sql.rows and prepared statements return results of the same
+// shape, batch by batch or row by row.
 //
 // # ExecResult dict
 //
@@ -57,12 +119,14 @@
 //
 // # NULL handling
 //
-// SQL NULL maps to Goal's float NaN (0n), the universal null marker.
-// Any column containing at least one NULL is returned as AV.
+// SQL NULL maps to Goal's float NaN (0n), the universal null marker, in
+// numeric columns, which stay flat AF arrays so that arithmetic remains
+// vectorised. NULLs in string columns become "", keeping an AS. The Fill
+// option of sql.q chooses the values replacing NULLs, and NullMask:1
+// returns their positions alongside the data (see queryOptions).
 //
 //	nan col          – boolean array; 1 at each NULL (0n) position
 //	0 nan col        – fill NULLs with 0
-//	"" nan col       – fill NULLs with ""
 //
 // # Type mapping
 //
@@ -75,6 +139,16 @@
 //	SQL BOOLEAN true      → I 1
 //	SQL BOOLEAN false     → I 0
 //	time.Time             → I   (Unix microseconds since 1970-01-01 UTC)
+//	DuckDB LIST / ARRAY   → array (AI | AF | AS | AV, NULL elements 0n)
+//	DuckDB STRUCT         → dict  (field name → value, sorted by name)
+//	DuckDB MAP            → dict  (typed keys, sorted)
+//	DuckDB DECIMAL        → F
+//	DuckDB HUGEINT        → I   (F when beyond 64 bits)
+//	DuckDB UUID           → S   (canonical text form)
+//	DuckDB INTERVAL       → dict ..[months:i;days:i;micros:i]
+//
+// The Temporal option of sql.q returns temporal columns as sql.time values,
+// which keep their SQL type and zone (see vfMeta).
 //
 // # Transactions
 //
@@ -85,23 +159,47 @@
 //	    tx sql.exec["INSERT INTO t (x) VALUES (?)" ; ,42]
 //	}
 //
-// The tx value passed to the lambda accepts sql.q and sql.exec identically to
-// a sql.conn. Nested transactions are not supported.
+// The tx value passed to the lambda accepts the verbs of a sql.conn,
+// sql.tx included, which nests a transaction in a SAVEPOINT (an error on
+// DuckDB, which has no savepoints; see vfTx). At the REPL, sql.begin starts
+// a transaction that stays open across inputs until sql.commit or
+// sql.rollback.
 //
 // # Registered drivers
 //
-// The sqlite URI scheme is registered by importing this package (via the
-// blank import of modernc.org/sqlite in the driver file). Adding a backend
-// requires registering its Go database/sql driver and mapping its URI scheme
-// in the open verb; no other verb changes.
+// The sqlite and duckdb URI schemes are registered by importing this
+// package (via the imports of modernc.org/sqlite and go-duckdb in the driver
+// files). A Go program embedding ari adds its own database/sql driver under
+// a scheme with RegisterScheme, describing its placeholder syntax,
+// introspection queries and type names:
+//
+//	import _ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" driver
+//
+//	err := sql.RegisterScheme("postgres", "pgx", sql.Scheme{
+//		DSN:           func(dsn string) (string, error) { return "postgres://" + dsn, nil },
+//		Placeholders:  sql.PlaceholderDollar,
+//		Savepoints:    true,
+//		DefaultSchema: "public",
+//	})
+//
+// after which sql.open "postgres://user@host/db" connects with it; no verb
+// changes.
 package sql
 
 import (
 	"context"
 	stdsql "database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"math"
+	"math/big"
+	"net/url"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	goal "codeberg.org/anaseto/goal"
@@ -113,32 +211,59 @@ import (
 
 // Conn wraps a *sql.DB as a Goal boxed value (sql.conn).
 type Conn struct {
-	db     *stdsql.DB
-	driver string
-	dsn    string
-	closed bool
+	db          *stdsql.DB
+	driver      string
+	dsn         string
+	timeout     time.Duration            // default bound of each call (TimeoutMilli), or 0
+	settings    []setting                // effective driver settings and pool options given to sql.open
+	txs         map[*GoalTx]struct{}     // open top-level transactions
+	cursorsMu   sync.Mutex               // guards cursors, as sql.rows values are closed by a cleanup
+	cursors     map[*Cursor]struct{}     // open cursors and sql.rows
+	registered  map[string]*registration // TEMP tables of sql.register, on pin
+	pin         *stdsql.Conn             // connection of the registered tables or private database, or nil
+	pinTx       *GoalTx                  // open transaction on pin, or nil
+	funcs       map[string]*goalFunc     // functions registered by sql.func
+	cache       *queryCache              // cached query results (see vfCached), or nil
+	cacheAll    bool                     // sql.q uses the cache (the Cache option)
+	trace       io.Writer                // log of statements (the Trace option), or nil
+	traceParams bool                     // log parameter values (the TraceParams option)
+	stats       connStats                // statements run so far (sql.stats)
+	memory      driver.Conn              // keeps a shared in-memory database alive, or nil
+	private     bool                     // pin holds a private in-memory database
+	closed      bool
 }
 
 func (c *Conn) Append(_ *goal.Context, dst []byte, _ bool) []byte {
-	return append(dst, fmt.Sprintf("sql.conn[%s:%s]", c.driver, c.dsn)...)
+	dst = append(dst, fmt.Sprintf("sql.conn[%s:%s", c.driver, c.dsn)...)
+	for _, st := range c.settings {
+		dst = append(dst, fmt.Sprintf(" %s=%s", st.name, st.value)...)
+	}
+	return append(dst, ']')
 }
 func (c *Conn) Matches(y goal.BV) bool { yv, ok := y.(*Conn); return ok && c == yv }
 func (c *Conn) Type() string           { return "sql.conn" }
 
-// GoalTx wraps a *sql.Tx as a Goal boxed value (sql.tx).
+// GoalTx wraps a *sql.Tx as a Goal boxed value (sql.tx). A sql.tx started
+// inside another one (see vfTx) shares its *sql.Tx and runs in a savepoint.
 type GoalTx struct {
-	tx   *stdsql.Tx
-	done bool
+	tx     *stdsql.Tx
+	conn   *Conn // connection the transaction was started on
+	depth  int   // nesting depth: 0 for a top-level transaction
+	scoped bool  // ended by its sql.tx lambda rather than sql.commit/sql.rollback
+	done   bool
 }
 
 func (t *GoalTx) Append(_ *goal.Context, dst []byte, _ bool) []byte {
+	if t.done {
+		return append(dst, "sql.tx[done]"...)
+	}
 	return append(dst, "sql.tx"...)
 }
 func (t *GoalTx) Matches(y goal.BV) bool { yv, ok := y.(*GoalTx); return ok && t == yv }
 func (t *GoalTx) Type() string           { return "sql.tx" }
 
 // ---------------------------------------------------------------------------
-// querier: common interface for *sql.DB and *sql.Tx
+// querier: common interface for *sql.DB, *sql.Conn and *sql.Tx
 // ---------------------------------------------------------------------------
 
 type querier interface {
@@ -146,12 +271,103 @@ type querier interface {
 	ExecContext(ctx context.Context, query string, args ...any) (stdsql.Result, error)
 }
 
+// connTarget is what the statements of a sql.conn run on outside
+// transactions: its *sql.DB, or the *sql.Conn of its registered tables.
+type connTarget interface {
+	querier
+	PrepareContext(ctx context.Context, query string) (*stdsql.Stmt, error)
+	BeginTx(ctx context.Context, opts *stdsql.TxOptions) (*stdsql.Tx, error)
+}
+
+// target returns what the statements of c run on: the connection holding
+// the TEMP tables of sql.register once there is one (see vfRegister), or a
+// private in-memory database (see vfOpen), so that they see them, unless a
+// transaction is open on it; the pool otherwise.
+func (c *Conn) target() connTarget {
+	if c.pin != nil && c.pinTx == nil {
+		return c.pin
+	}
+	return c.db
+}
+
+// conn returns a connection of the target of c, for the driver APIs that
+// need one, and a function releasing it.
+func (c *Conn) conn(ctx context.Context) (*stdsql.Conn, func(), error) {
+	if c.pin != nil && c.pinTx == nil {
+		return c.pin, func() {}, nil
+	}
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return conn, func() { _ = conn.Close() }, nil
+}
+
+// onConn reports whether q is the target of a sql.conn, rather than a
+// transaction or prepared statement.
+func onConn(q querier) bool {
+	switch q.(type) {
+	case *stdsql.DB, *stdsql.Conn:
+		return true
+	}
+	return false
+}
+
+// addCursor records cur as an open cursor of c, until cur.close.
+func (c *Conn) addCursor(cur *Cursor) {
+	c.cursorsMu.Lock()
+	defer c.cursorsMu.Unlock()
+	if c.cursors == nil {
+		c.cursors = make(map[*Cursor]struct{})
+	}
+	c.cursors[cur] = struct{}{}
+}
+
+// openCursors returns the open cursors of c.
+func (c *Conn) openCursors() []*Cursor {
+	c.cursorsMu.Lock()
+	defer c.cursorsMu.Unlock()
+	return slices.Collect(maps.Keys(c.cursors))
+}
+
+// connOf returns the connection of a sql.conn or sql.tx value, or nil.
+func connOf(v goal.V) *Conn {
+	switch bv := v.BV().(type) {
+	case *Conn:
+		return bv
+	case *GoalTx:
+		return bv.conn
+	}
+	return nil
+}
+
+// checkPool returns an error if a statement on the target of c would wait
+// for a connection forever (see checkConns).
+func (c *Conn) checkPool() error {
+	if c.pin != nil && c.pinTx == nil {
+		return nil
+	}
+	return c.checkConns()
+}
+
+// checkConns returns an error if every connection the pool of c may open is
+// in use, by the open transactions, cursors and sql.rows values of c or the
+// connection of its registered tables: as Goal runs one call at a time,
+// waiting for one would block forever.
+func (c *Conn) checkConns() error {
+	st := c.db.Stats()
+	if st.MaxOpenConnections > 0 && st.InUse >= st.MaxOpenConnections {
+		return fmt.Errorf("all %d connections of the pool (MaxOpenConns) are in use by open transactions, cursors or sql.rows: end or close them first", st.MaxOpenConnections)
+	}
+	return nil
+}
+
 // toQuerier extracts a querier and reports whether the underlying conn is open.
 // Returns (nil, "", false) if v is not a sql.conn or sql.tx.
 func toQuerier(v goal.V) (querier, string, bool) {
 	switch bv := v.BV().(type) {
 	case *Conn:
-		return bv.db, "sql.conn", !bv.closed
+		return bv.target(), "sql.conn", !bv.closed
 	case *GoalTx:
 		return bv.tx, "sql.tx", !bv.done
 	}
@@ -162,11 +378,124 @@ func toQuerier(v goal.V) (querier, string, bool) {
 // URI parsing
 // ---------------------------------------------------------------------------
 
-// driverSchemes maps URI schemes to database/sql driver names.
-// New backends register here; no verb logic changes.
-var driverSchemes = map[string]string{ //nolint:gochecknoglobals // package-level registry initialised once at startup
-	"sqlite": "sqlite",
-	"duckdb": "duckdb",
+// driverScheme describes a registered URI scheme: the database/sql driver it
+// opens and the driver-specific SQL and hooks the verbs need.
+type driverScheme struct {
+	driverName string
+
+	// dsn, if set, rewrites the DSN of a sql.open URI (see Scheme.DSN).
+	dsn func(dsn string) (string, error)
+
+	// memoryDSN, if set, reports whether dsn is an in-memory database
+	// private to each connection, which sql.open serves from one pinned
+	// connection, and returns the DSN of one shared by the connections of
+	// the pool instead, for the SharedCache option (see vfOpen).
+	memoryDSN func(dsn string) (string, bool)
+
+	// connector, if set, returns the connector opening the connections of
+	// the pool, instead of the driver's.
+	connector func(dsn string) (driver.Connector, error)
+
+	// placeholders is the syntax positional ? placeholders are rewritten
+	// to (see positional).
+	placeholders PlaceholderStyle
+
+	// namedParams reports whether the driver binds :name placeholders from
+	// stdsql.Named arguments; otherwise they are rewritten to positional ?.
+	namedParams bool
+
+	// nestedParams reports whether the driver has LIST, STRUCT and MAP
+	// types, so that arrays and dicts nested in the parameters can bind
+	// them (see writeArg).
+	nestedParams bool
+
+	// Schema introspection queries (sql.tables, sql.columns, sql.indexes).
+	// tablesSQL takes no parameters and returns (schema, name, type);
+	// columnsSQL returns (name, type, nullable, default, pk) and indexesSQL
+	// returns (name, unique, primary, columns), both taking the parameters
+	// (table, schema).
+	tablesSQL  string
+	columnsSQL string
+	indexesSQL string
+
+	// defaultSchema is the schema of unqualified table names in
+	// sql.columns and sql.indexes ("main" if empty).
+	defaultSchema string
+
+	// types replaces the column types of the tables the verbs create (see
+	// columnType).
+	types map[string]string
+
+	// scanValue, if set, converts result values before sqlValueToGoal (see
+	// Scheme.Value).
+	scanValue func(v any, dbType string) (any, bool)
+
+	// script is the syntax sql.script needs to split scripts into
+	// statements.
+	script scriptSyntax
+
+	// savepoints reports whether the driver supports SAVEPOINT, which
+	// nested sql.tx calls use.
+	savepoints bool
+
+	// settingsOption is the sql.open opts key of the driver's settings dict
+	// (SQLite pragmas, DuckDB configuration options). withSettings adds the
+	// settings to a DSN, so that every pooled connection gets them, and
+	// settingSQL returns a query reading back the effective value of one.
+	settingsOption string
+	withSettings   func(dsn string, settings []setting) (string, error)
+	settingSQL     func(name string) string
+
+	// queryArrow, if set, runs a query through the driver's Arrow
+	// interface and builds the QueryResult dict from its record batches
+	// (the Arrow option of sql.q).
+	queryArrow func(ctx context.Context, conn *stdsql.Conn, query string, args []any, opts queryOptions) (goal.V, error)
+
+	// readFile, if set, creates the table opts.table from a data file, and
+	// writeFile, if set, writes the result of a query to one, both with the
+	// database's own readers and writers (sql.read, sql.write). Otherwise
+	// CSV and JSON files are read and written in Go.
+	readFile  func(ctx context.Context, q querier, path string, opts fileOptions) error
+	writeFile func(ctx context.Context, q querier, query, path string, opts fileOptions) (int64, error)
+
+	// registerFunc, if set, makes a Goal function callable from the
+	// queries of a connection (sql.func).
+	registerFunc func(ctx context.Context, c *Conn, fn *goalFunc) error
+
+	// unregisterFuncs, if set, releases the functions of registerFunc of a
+	// connection being closed.
+	unregisterFuncs func(c *Conn)
+
+	// staleConn, if set, reports whether conn lacks functions of
+	// registerFunc registered since it was opened, in which case the
+	// connection of the tables of sql.register is replaced.
+	staleConn func(conn *stdsql.Conn) bool
+
+	// snapshot, if set, copies the private in-memory database of conn and
+	// returns a function writing the copy to another connection, so that
+	// replacing a stale connection keeps the database (see Conn.repin).
+	snapshot func(ctx context.Context, conn *stdsql.Conn) (func(*stdsql.Conn) error, error)
+
+	// explain, if set, returns the plan of a query (sql.explain);
+	// explainRuns reports that it runs the query to profile it.
+	explain     func(ctx context.Context, q querier, query string, args []any) ([]planNode, error)
+	explainRuns bool
+
+	// appendRows, if set, bulk-loads rows whose columns match the table's
+	// columns in order (used by sql.insert).
+	appendRows func(ctx context.Context, conn *stdsql.Conn, table string, cols []goal.V, nrows int) error
+
+	// loadTable, if set, loads the rows of a table of sql.register created
+	// on conn in bulk, or returns errors.ErrUnsupported; rows are inserted
+	// otherwise.
+	loadTable func(ctx context.Context, conn *stdsql.Conn, table string, types []string, cols []goal.V, nrows int) error
+}
+
+// driverSchemes maps URI schemes to their driver descriptions.
+// New backends register here, or with RegisterScheme; no verb logic changes.
+var driverSchemes = map[string]driverScheme{ //nolint:gochecknoglobals // package-level registry initialised once at startup
+	"sqlite": sqliteScheme,
+	"duckdb": duckdbScheme,
 }
 
 // parseURI splits "scheme://dsn" into (scheme, dsn).
@@ -182,6 +511,16 @@ func parseURI(uri string) (string, string, error) {
 	return scheme, dsn, nil
 }
 
+// withQuery appends query parameters to a DSN, which drivers use to
+// configure each connection they open.
+func withQuery(dsn string, params url.Values) string {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + params.Encode()
+}
+
 // ---------------------------------------------------------------------------
 // Import
 // ---------------------------------------------------------------------------
@@ -207,38 +546,97 @@ func Import(ctx *goal.Context, pfx string) {
 	}
 
 	// monads
-	reg("sql.open", vfOpen, false)
 	reg("sql.close", vfClose, false)
+	reg("sql.tables", vfTables, false)
+	reg("sql.time", vfTime, false)
+	reg("sql.meta", vfMeta, false)
+	reg("sql.list", vfList, false)
+	reg("sql.next", vfNext, false)
+	reg("sql.invalidate", vfInvalidate, false)
+	reg("sql.stats", vfStats, false)
 
 	// dyads (also accept bracket notation with extra args)
+	// sql.open is registered as dyad so sql.open[uri;opts] works.
+	reg("sql.open", vfOpen, true)
+	reg("sql.begin", vfBegin, true)
+	reg("sql.commit", vfCommit, false)
+	reg("sql.rollback", vfRollback, false)
 	reg("sql.q", vfQuery, true)
+	reg("sql.cached", vfCached, true)
 	reg("sql.exec", vfExec, true)
-	reg("sql.tx", wrapCtxTx(ctx, vfTx), true)
+	reg("sql.tx", wrapCtx(ctx, vfTx), true)
+	reg("sql.cursor", vfCursor, true)
+	reg("sql.fetch", vfFetch, true)
+	reg("sql.rows", vfRows, true)
+	reg("sql.each", wrapCtx(ctx, vfEach), true)
+	reg("sql.insert", vfInsert, true)
+	reg("sql.describe", vfDescribe, true)
+	reg("sql.explain", vfExplain, true)
+	reg("sql.prepare", vfPrepare, true)
+	reg("sql.columns", vfColumns, true)
+	reg("sql.indexes", vfIndexes, true)
+	reg("sql.script", vfScript, true)
+	reg("sql.migrate", vfMigrate, true)
+	reg("sql.read", vfRead, true)
+	reg("sql.write", vfWrite, true)
+	reg("sql.register", vfRegister, true)
+	reg("sql.unregister", vfUnregister, true)
+	reg("sql.func", wrapCtx(ctx, vfFunc), true)
 }
 
-// wrapCtxTx injects the Goal context into sql.tx's closure (needed to call
-// the user-supplied lambda).
-func wrapCtxTx(ctx *goal.Context, f func(*goal.Context, []goal.V) goal.V) goal.VariadicFunc {
+// wrapCtx injects the Goal context into the closure of verbs that call a
+// user-supplied lambda (sql.tx, sql.each, sql.func).
+func wrapCtx(ctx *goal.Context, f func(*goal.Context, []goal.V) goal.V) goal.VariadicFunc {
 	return func(_ *goal.Context, args []goal.V) goal.V { return f(ctx, args) }
 }
 
 // ---------------------------------------------------------------------------
-// sql.open  (monad: sql.open "scheme://dsn")
+// sql.open  (monad: sql.open "scheme://dsn"  or  sql.open["scheme://dsn";opts])
 // ---------------------------------------------------------------------------
 
-// vfOpen opens a database connection from a URI.
+// vfOpen opens a database connection from a URI. An opts dict may follow
+// the URI (see connOptions):
+//
+//	TimeoutMilli          i  – default time limit of each call on the connection
+//	MaxOpenConns          i  – maximum open connections in the pool (0: no limit)
+//	MaxIdleConns          i  – maximum idle connections kept in the pool
+//	ConnMaxLifetimeMilli  i  – maximum time a connection may be reused (0: forever)
+//	ConnMaxIdleTimeMilli  i  – maximum time a connection may be idle (0: forever)
+//	Cache                 i  – sql.q caches its results, as sql.cached does (0/1)
+//	CacheSize             i  – maximum number of cached results (default 64)
+//	CacheTTLMilli         i  – maximum age of a cached result (0: no limit)
+//	Trace                 i  – log each statement to the Goal context's log (0/1)
+//	TraceParams           i  – log parameter values instead of ? (0/1)
+//	SharedCache           i  – share sqlite://:memory: between the connections of the pool (0/1)
+//	Pragmas               d  – SQLite pragmas, e.g. ..[journal_mode:"WAL";foreign_keys:1]
+//	Settings              d  – DuckDB configuration, e.g. ..[threads:4;memory_limit:"1GB"]
+//
+// Pragmas and Settings are set on every connection of the pool. The printed
+// sql.conn shows their effective values along with the pool options given.
+//
+// SQLite gives each connection to ":memory:" a database of its own, so the
+// statements of a "sqlite://:memory:" sql.conn all run on one connection,
+// and a call needing another one, while a transaction holds it, is an
+// error. With SharedCache:1 the connections of the pool share the database
+// instead, but SQLite then locks whole tables: writing to a table that an
+// open cursor or sql.rows reads, or reading one written by an open
+// transaction, fails with SQLITE_LOCKED.
 //
 // Usage:
 //
 //	db: sql.open "sqlite://data.db"
 //	db: sql.open "sqlite://:memory:"
-func vfOpen(_ *goal.Context, args []goal.V) goal.V {
-	if len(args) != 1 {
-		return goal.Panicf("sql.open uri : expected 1 argument, got %d", len(args))
+//	db: sql.open["duckdb://";..[TimeoutMilli:30000]]
+//	db: sql.open["sqlite://data.db";..[Pragmas:..[journal_mode:"WAL";busy_timeout:5000]]]
+func vfOpen(ctx *goal.Context, args []goal.V) goal.V {
+	if len(args) != 1 && len(args) != 2 {
+		return goal.Panicf("sql.open uri : expected 1 or 2 arguments, got %d", len(args))
 	}
-	s, ok := args[0].BV().(goal.S)
+	// args[0] = opts, args[1] = uri in the bracket form
+	uriV := args[len(args)-1]
+	s, ok := uriV.BV().(goal.S)
 	if !ok {
-		return goal.Panicf("sql.open uri : expected string URI, got %q", args[0].Type())
+		return goal.Panicf("sql.open uri : expected string URI, got %q", uriV.Type())
 	}
 	uri := string(s)
 
@@ -247,7 +645,7 @@ func vfOpen(_ *goal.Context, args []goal.V) goal.V {
 		return goal.Panicf("%v", err)
 	}
 
-	driverName, ok := driverSchemes[scheme]
+	sch, ok := driverSchemes[scheme]
 	if !ok {
 		known := make([]string, 0, len(driverSchemes))
 		for k := range driverSchemes {
@@ -256,43 +654,183 @@ func vfOpen(_ *goal.Context, args []goal.V) goal.V {
 		return goal.Panicf("sql.open: unknown URI scheme %q (registered: %s)", scheme, strings.Join(known, ", "))
 	}
 
-	db, err := stdsql.Open(driverName, dsn)
+	opts := newConnOptions(sch)
+	if len(args) == 2 {
+		opts, err = parseConnOptions("sql.open[uri;opts]", args[0], sch)
+		if err != nil {
+			return goal.Panicf("%v", err)
+		}
+	}
+	openDSN, private := dsn, false
+	if sch.memoryDSN != nil {
+		var sharedDSN string
+		if sharedDSN, private = sch.memoryDSN(dsn); private && opts.sharedCache {
+			openDSN, private = sharedDSN, false
+		}
+	}
+	switch {
+	case opts.sharedCache && openDSN == dsn:
+		return goal.Panicf("sql.open %q: the SharedCache option only applies to sqlite://:memory:", uri)
+	case private && opts.maxOpenConns != -1 && opts.maxOpenConns != 1:
+		return goal.Panicf("sql.open %q: MaxOpenConns: the in-memory database is private to one connection (see the SharedCache option)", uri)
+	}
+	if sch.dsn != nil {
+		if openDSN, err = sch.dsn(openDSN); err != nil {
+			return goal.Panicf("sql.open %q: %v", uri, err)
+		}
+	}
+	if len(opts.settings) > 0 {
+		openDSN, err = sch.withSettings(openDSN, opts.settings)
+		if err != nil {
+			return goal.Panicf("sql.open %q: %v", uri, err)
+		}
+	}
+
+	var db *stdsql.DB
+	if sch.connector != nil {
+		var connector driver.Connector
+		if connector, err = sch.connector(openDSN); err == nil {
+			db = stdsql.OpenDB(connector)
+		}
+	} else {
+		db, err = stdsql.Open(sch.driverName, openDSN)
+	}
 	if err != nil {
 		return goal.Panicf("sql.open %q: %v", uri, err)
 	}
+	opts.configurePool(db)
+	if private {
+		db.SetMaxOpenConns(1)
+	}
 	// Ping to surface connection errors immediately.
-	if err := db.PingContext(context.Background()); err != nil {
+	cctx, done := callContext(opts.timeout)
+	defer done()
+	if err := db.PingContext(cctx); err != nil {
 		db.Close()
-		return goal.Panicf("sql.open %q: %v", uri, err)
+		return goal.Panicf("sql.open %q: %v", uri, callErr(cctx, err))
+	}
+
+	c := &Conn{db: db, driver: scheme, dsn: dsn, timeout: opts.timeout, cache: opts.newCache(), cacheAll: opts.cache}
+	if opts.trace {
+		c.trace, c.traceParams = ctx.Log, opts.traceParams
+	}
+	c.settings = append(effectiveSettings(cctx, db, sch, opts.settings), opts.poolSettings()...)
+	// The database lives while a connection to it is open, whereas the pool
+	// may close idle ones.
+	switch {
+	case private:
+		// Every statement runs on the one connection holding it.
+		if c.pin, err = db.Conn(cctx); err != nil {
+			db.Close()
+			return goal.Panicf("sql.open %q: %v", uri, callErr(cctx, err))
+		}
+		c.private = true
+	case opts.sharedCache:
+		// Keep one connection outside the pool.
+		if c.memory, err = db.Driver().Open(openDSN); err != nil {
+			db.Close()
+			return goal.Panicf("sql.open %q: %v", uri, err)
+		}
 	}
+	return goal.NewV(c)
+}
 
-	return goal.NewV(&Conn{db: db, driver: scheme, dsn: dsn})
+// effectiveSettings reads back the values the database uses for the given
+// driver settings, which may differ from the requested ones (e.g. an
+// in-memory SQLite database keeps journal_mode=memory). The requested value
+// is kept for a setting that cannot be read back.
+func effectiveSettings(ctx context.Context, db *stdsql.DB, sch driverScheme, settings []setting) []setting {
+	out := make([]setting, len(settings))
+	for i, st := range settings {
+		out[i] = st
+		var v stdsql.NullString
+		if err := db.QueryRowContext(ctx, sch.settingSQL(st.name)).Scan(&v); err == nil && v.Valid {
+			out[i].value = v.String
+		}
+	}
+	return out
 }
 
 // ---------------------------------------------------------------------------
 // sql.close  (monad: sql.close db)
 // ---------------------------------------------------------------------------
 
-// vfClose closes a database connection.
+// vfClose closes a database connection, a cursor, a sql.rows value or a
+// prepared statement.
+// Transactions still open on a connection (see vfBegin) are rolled back,
+// with a warning on the context's log.
 //
 // Usage:
 //
 //	sql.close db
-func vfClose(_ *goal.Context, args []goal.V) goal.V {
+//	sql.close cur
+//	sql.close r
+//	sql.close st
+func vfClose(ctx *goal.Context, args []goal.V) goal.V {
 	if len(args) != 1 {
 		return goal.Panicf("sql.close conn : expected 1 argument, got %d", len(args))
 	}
+	switch bv := args[0].BV().(type) {
+	case *Cursor:
+		if err := bv.close(); err != nil {
+			return goal.Panicf("sql.close cur : %v", err)
+		}
+		return goal.NewI(1)
+	case *Rows:
+		if err := bv.close(); err != nil {
+			return goal.Panicf("sql.close r : %v", err)
+		}
+		return goal.NewI(1)
+	case *Stmt:
+		if err := bv.close(); err != nil {
+			return goal.Panicf("sql.close st : %v", err)
+		}
+		return goal.NewI(1)
+	}
 	c, ok := args[0].BV().(*Conn)
 	if !ok {
-		return goal.Panicf("sql.close conn : expected sql.conn, got %q", args[0].Type())
+		return goal.Panicf("sql.close conn : expected sql.conn, sql.cursor, sql.rows or sql.stmt, got %q", args[0].Type())
 	}
 	if c.closed {
 		return goal.Panicf("sql.close conn : connection is already closed")
 	}
-	if err := c.db.Close(); err != nil {
-		return goal.Panicf("sql.close conn : %v", err)
+	// Open rows would keep the connection of registered tables from closing.
+	for _, cur := range c.openCursors() {
+		_ = cur.close()
+	}
+	if n := len(c.txs); n > 0 {
+		if ctx.Log != nil {
+			fmt.Fprintf(ctx.Log, "sql.close: rolling back %d open transaction(s) on sql.conn[%s:%s]\n", n, c.driver, c.dsn)
+		}
+		for tx := range c.txs {
+			_ = tx.end("sql.close", false)
+		}
 	}
+	// The connection is closed even if dropping a registered table fails,
+	// which is reported afterwards.
+	var errs []error
+	if c.pin != nil {
+		cctx, done := callContext(c.timeout)
+		for _, name := range slices.Sorted(maps.Keys(c.registered)) {
+			if err := c.unregister(cctx, "sql.close", name); err != nil {
+				errs = append(errs, fmt.Errorf("drop registered table %q: %w", name, callErr(cctx, err)))
+			}
+		}
+		done()
+		errs = append(errs, c.pin.Close())
+	}
+	if sch := driverSchemes[c.driver]; sch.unregisterFuncs != nil {
+		sch.unregisterFuncs(c)
+	}
+	c.invalidateCache()
+	if c.memory != nil {
+		defer c.memory.Close()
+	}
+	errs = append(errs, c.db.Close())
 	c.closed = true
+	if err := errors.Join(errs...); err != nil {
+		return goal.Panicf("sql.close conn : %v", err)
+	}
 	return goal.NewI(1)
 }
 
@@ -310,27 +848,88 @@ func vfClose(_ *goal.Context, args []goal.V) goal.V {
 //
 //	t: db sql.q["SELECT * FROM users WHERE age > ?" ; ,25]
 //	t: db sql.q["SELECT * FROM t WHERE a=? AND b=?" ; (1;"x")]
+//	t: db sql.q["SELECT * FROM t WHERE a=:a AND b=:b" ; ..[a:1;b:"x"]]
+//
+// With options (see queryOptions):
+//
+//	t: sql.q[db;"SELECT * FROM events";();..[Temporal:1]]
 //
-// conn accepts either sql.conn or sql.tx.
+// Prepared statement (see vfPrepare):
+//
+//	t: st sql.q ,42
+//
+// Placeholders inside string literals, quoted identifiers (including
+// SQLite's [name] and `name`) and comments are ignored, as are :: casts and
+// a colon right after [, a name, a number or a quote, such as those of the
+// DuckDB slice x[a:b] and struct literal {'k':v} (write [ :a] for a list of
+// a named parameter). Drivers with native named parameters (SQLite)
+// receive database/sql Named arguments; for the others (DuckDB) the query is
+// rewritten to positional form. A key missing from the dict is an error.
+//
+// On DuckDB, an array or dict nested in the parameters binds a LIST,
+// STRUCT (dict with string keys) or MAP (other keys) value; its
+// placeholder is rewritten to a constructor ([?, ?], {'a': ?} or
+// MAP([?], [?])), so that, as with sql.list, it cannot be bound to prepared
+// statements.
+//
+// conn accepts sql.conn, sql.tx or sql.stmt.
 func vfQuery(_ *goal.Context, args []goal.V) goal.V {
-	conn, query, params, err := parseConnQueryArgs("sql.q", args)
+	call, err := parseConnQueryArgs("sql.q", args)
 	if err != nil {
 		return goal.Panicf("%v", err)
 	}
-	sqlArgs, err := goalToSQLArgs(params)
-	if err != nil {
-		return goal.Panicf("sql.q: %v", err)
-	}
+	return runQuery("sql.q", call)
+}
 
-	rows, err := conn.QueryContext(context.Background(), query, sqlArgs...)
+// runQuery runs the query of a sql.q or sql.cached call and returns its
+// result, from the connection's cache when the call uses it.
+func runQuery(verb string, call queryCall) goal.V {
+	ctx, done := call.context()
+	defer done()
+	start := time.Now()
+	readOnly := readOnlyQuery(call.query, call.scheme.script)
+	if !readOnly {
+		// e.g. INSERT … RETURNING or CREATE TABLE … AS: the statement may
+		// change the data of cached results.
+		defer call.db.invalidateCache()
+	}
+	if call.stmt != nil && isParamTable(call.params) {
+		result, err := call.stmt.queryTable(ctx, verb, call.params, call.opts)
+		call.db.observe(stmtEvent{verb: verb, query: call.query, rows: resultRows(result), elapsed: time.Since(start), err: err})
+		if err != nil {
+			return goal.Panicf("%s %q: %v", verb, call.query, callErr(ctx, err))
+		}
+		return result
+	}
+	query, sqlArgs, err := call.bind()
 	if err != nil {
-		return goal.Panicf("sql.q %q: %v", query, err)
+		return goal.Panicf("%s: %v", verb, err)
+	}
+	var cache *queryCache
+	if readOnly {
+		cache = call.cache()
+	}
+	var key string
+	if cache != nil {
+		key = cacheKey(query, sqlArgs, call.opts)
+		if result, ok := cache.get(key); ok {
+			call.db.observe(stmtEvent{verb: verb, query: query, args: sqlArgs, rows: resultRows(result), elapsed: time.Since(start), cached: true})
+			return result
+		}
 	}
-	defer rows.Close()
 
-	result, err := scanRows(rows)
+	var result goal.V
+	if call.opts.arrow {
+		result, err = call.queryArrow(ctx, query, sqlArgs)
+	} else {
+		result, err = call.queryScan(ctx, query, sqlArgs)
+	}
+	call.db.observe(stmtEvent{verb: verb, query: query, args: sqlArgs, rows: resultRows(result), elapsed: time.Since(start), err: err})
 	if err != nil {
-		return goal.Panicf("sql.q %q: %v", query, err)
+		return goal.Panicf("%s %q: %v", verb, call.query, callErr(ctx, err))
+	}
+	if cache != nil {
+		cache.put(key, result)
 	}
 	return result
 }
@@ -349,105 +948,153 @@ func vfQuery(_ *goal.Context, args []goal.V) goal.V {
 //
 //	r: db sql.exec["INSERT INTO users (name, age) VALUES (?, ?)" ; ("Alice";30)]
 //
-// conn accepts either sql.conn or sql.tx.
+// conn accepts sql.conn, sql.tx or sql.stmt.
 func vfExec(_ *goal.Context, args []goal.V) goal.V {
-	conn, query, params, err := parseConnQueryArgs("sql.exec", args)
+	call, err := parseConnQueryArgs("sql.exec", args)
 	if err != nil {
 		return goal.Panicf("%v", err)
 	}
-	sqlArgs, err := goalToSQLArgs(params)
+	ctx, done := call.context()
+	defer done()
+	start := time.Now()
+	if call.stmt != nil && isParamTable(call.params) {
+		sum, err := call.stmt.execTable(ctx, "sql.exec", call.params)
+		call.db.observe(stmtEvent{verb: "sql.exec", query: call.query, rows: sum.rowsAffected, elapsed: time.Since(start), err: err})
+		call.db.invalidateCache()
+		if err != nil {
+			return goal.Panicf("sql.exec %q: %v", call.query, callErr(ctx, err))
+		}
+		return sum.dict()
+	}
+	query, sqlArgs, err := call.bind()
 	if err != nil {
 		return goal.Panicf("sql.exec: %v", err)
 	}
 
-	res, err := conn.ExecContext(context.Background(), query, sqlArgs...)
+	res, err := call.conn.ExecContext(ctx, query, sqlArgs...)
+	var sum execSummary
+	if err == nil {
+		sum.add(res)
+	}
+	call.db.observe(stmtEvent{verb: "sql.exec", query: query, args: sqlArgs, rows: sum.rowsAffected, elapsed: time.Since(start), err: err})
+	call.db.invalidateCache()
 	if err != nil {
-		return goal.Panicf("sql.exec %q: %v", query, err)
+		return goal.Panicf("sql.exec %q: %v", call.query, callErr(ctx, err))
 	}
-
-	lastID, _ := res.LastInsertId()
-	rowsAff, _ := res.RowsAffected()
-
-	keys := goal.NewAS([]string{"lastInsertId", "rowsAffected"})
-	vals := goal.NewAI([]int64{lastID, rowsAff})
-	return goal.NewD(keys, vals)
+	return sum.dict()
 }
 
 // ---------------------------------------------------------------------------
-// sql.tx  (dyad: conn sql.tx {[tx] ...})
+// Argument parsing helpers
 // ---------------------------------------------------------------------------
 
-// vfTx runs a lambda inside a database transaction.
-//
-// The lambda receives a sql.tx value that accepts sql.q and sql.exec
-// identically to a sql.conn. The transaction commits if the lambda returns a
-// non-error Goal value and rolls back if it returns a Goal error value.
-//
-// Usage:
-//
-//	r: db sql.tx {[tx]
-//	    tx sql.exec["INSERT INTO orders (item) VALUES (?)" ; ,"widget"]
-//	}
-func vfTx(ctx *goal.Context, args []goal.V) goal.V {
-	if len(args) != 2 {
-		return goal.Panicf("conn sql.tx fn : expected 2 arguments, got %d", len(args))
-	}
-	// args[0] = fn (right), args[1] = conn (left)
-	fn := args[0]
-	if !fn.IsFunction() {
-		return goal.Panicf("conn sql.tx fn : expected function in right arg, got %q", fn.Type())
-	}
+// queryCall holds the parsed arguments shared by sql.q, sql.exec and
+// sql.cursor.
+type queryCall struct {
+	conn    querier
+	query   string
+	params  goal.V // zero value = no params
+	opts    queryOptions
+	scheme  driverScheme
+	db      *Conn         // connection of conn
+	stmt    *Stmt         // set when conn is a prepared statement
+	timeout time.Duration // time limit of the call, or 0
+}
 
-	c, ok := args[1].BV().(*Conn)
-	if !ok {
-		if _, isT := args[1].BV().(*GoalTx); isT {
-			return goal.Panicf("conn sql.tx fn : nested transactions are not supported")
-		}
-		return goal.Panicf("conn sql.tx fn : expected sql.conn in left arg, got %q", args[1].Type())
-	}
-	if c.closed {
-		return goal.Panicf("conn sql.tx fn : connection is closed")
+// context returns the context to run the call with (see callContext).
+func (call *queryCall) context() (context.Context, func()) {
+	return callContext(call.timeout)
+}
+
+// bind converts the call's params to driver arguments and returns them with
+// the query to execute (see bindArgs).
+func (call *queryCall) bind() (string, []any, error) {
+	if call.stmt != nil {
+		args, err := call.stmt.bind(call.params)
+		return call.query, args, err
 	}
+	return bindArgs(call.scheme, call.query, call.params)
+}
 
-	tx, err := c.db.BeginTx(context.Background(), nil)
+// queryScan runs the call's query and scans its whole result.
+func (call *queryCall) queryScan(ctx context.Context, query string, args []any) (goal.V, error) {
+	rows, err := call.conn.QueryContext(ctx, query, args...)
 	if err != nil {
-		return goal.Panicf("conn sql.tx fn : begin: %v", err)
+		return goal.V{}, err
 	}
+	defer rows.Close()
+	return scanRows(rows, call.opts)
+}
 
-	txVal := goal.NewV(&GoalTx{tx: tx})
-	result := fn.ApplyAt(ctx, txVal)
-
-	gtx := txVal.BV().(*GoalTx) //nolint:errcheck // type is guaranteed: txVal was just created as *GoalTx above
-	gtx.done = true
+// cache returns the cache of the connection if the call uses it: a query
+// on a sql.conn (not a transaction, which may see its own uncommitted
+// changes, nor a prepared statement), with the Cache option or the
+// connection's.
+func (call *queryCall) cache() *queryCache {
+	if !onConn(call.conn) || call.db.cache == nil {
+		return nil
+	}
+	use := call.db.cacheAll
+	if call.opts.cacheSet {
+		use = call.opts.cache
+	}
+	if !use {
+		return nil
+	}
+	return call.db.cache
+}
 
-	if result.IsPanic() {
-		_ = tx.Rollback()
-		return result
+// queryArrow runs the call's query through the driver's Arrow interface
+// (the Arrow query option).
+func (call *queryCall) queryArrow(ctx context.Context, query string, args []any) (goal.V, error) {
+	if !onConn(call.conn) || call.stmt != nil {
+		return goal.V{}, fmt.Errorf("the Arrow option requires a sql.conn")
 	}
-	if err := tx.Commit(); err != nil {
-		return goal.Panicf("conn sql.tx fn : commit: %v", err)
+	if call.scheme.queryArrow == nil {
+		return goal.V{}, fmt.Errorf("the Arrow option is not supported by the %s driver", call.scheme.driverName)
 	}
-	return result
+	if call.opts.temporal {
+		return goal.V{}, fmt.Errorf("the Arrow and Temporal options cannot be combined")
+	}
+	conn, release, err := call.db.conn(ctx)
+	if err != nil {
+		return goal.V{}, err
+	}
+	defer release()
+	return call.scheme.queryArrow(ctx, conn, query, args, call.opts)
 }
 
-// ---------------------------------------------------------------------------
-// Argument parsing helpers
-// ---------------------------------------------------------------------------
+// setTimeout sets the call's time limit: the TimeoutMilli query option if
+// given, or else the connection's default.
+func (call *queryCall) setTimeout(c *Conn) {
+	call.timeout = c.timeout
+	if call.opts.timeoutSet {
+		call.timeout = call.opts.timeout
+	}
+}
 
-// parseConnQueryArgs handles the two calling conventions shared by sql.q and
-// sql.exec:
+// parseConnQueryArgs handles the calling conventions shared by sql.q,
+// sql.exec and sql.cursor:
 //
 //	len==2: conn verb "query"                   → (conn, query, noParams)
 //	len==3: conn verb["query" ; params]         → (conn, query, params)
-func parseConnQueryArgs(verb string, args []goal.V) (querier, string, goal.V, error) {
-	var connV, queryV, paramsV goal.V
+//	len==4: verb[conn;"query";params;opts]      → (conn, query, params, opts)
+//
+// A sql.stmt in place of conn takes no query (see parseStmtArgs).
+func parseConnQueryArgs(verb string, args []goal.V) (queryCall, error) {
+	if len(args) > 0 {
+		if st, ok := args[len(args)-1].BV().(*Stmt); ok {
+			return parseStmtArgs(verb, st, args)
+		}
+	}
+	var connV, queryV goal.V
+	var call queryCall
 	switch len(args) {
 	case 2:
 		// dyadic: conn verb "query"
 		// args[0] = query (right), args[1] = conn (left)
 		connV = args[1]
 		queryV = args[0]
-		paramsV = goal.V{} // zero value = no params
 	case 3:
 		// bracket: conn verb["query" ; params]
 		// args[0] = params (last bracket arg)
@@ -455,24 +1102,46 @@ func parseConnQueryArgs(verb string, args []goal.V) (querier, string, goal.V, er
 		// args[2] = conn   (implicit left)
 		connV = args[2]
 		queryV = args[1]
-		paramsV = args[0]
+		call.params = args[0]
+	case 4:
+		// bracket: verb[conn;"query";params;opts]
+		// args[0] = opts, args[1] = params, args[2] = query, args[3] = conn
+		connV = args[3]
+		queryV = args[2]
+		call.params = args[1]
+		opts, err := parseQueryOptions(verb, args[0])
+		if err != nil {
+			return call, err
+		}
+		call.opts = opts
 	default:
-		return nil, "", goal.V{}, fmt.Errorf("%s : expected 2 or 3 arguments, got %d", verb, len(args))
+		return call, fmt.Errorf("%s : expected 2 to 4 arguments, got %d", verb, len(args))
 	}
 
 	q, _, isOpen := toQuerier(connV)
 	if q == nil {
-		return nil, "", goal.V{}, fmt.Errorf("%s : expected sql.conn or sql.tx in left arg, got %q", verb, connV.Type())
+		return call, fmt.Errorf("%s : expected sql.conn or sql.tx in left arg, got %q", verb, connV.Type())
 	}
 	if !isOpen {
-		return nil, "", goal.V{}, fmt.Errorf("%s : connection or transaction is closed", verb)
+		return call, fmt.Errorf("%s : connection or transaction is closed", verb)
 	}
+	if c, ok := connV.BV().(*Conn); ok {
+		if err := c.checkPool(); err != nil {
+			return call, fmt.Errorf("%s : %w", verb, err)
+		}
+	}
+	call.conn = q
+	call.db = connOf(connV)
+	call.scheme = driverSchemes[call.db.driver]
+	call.opts.scanValue = call.scheme.scanValue
+	call.setTimeout(call.db)
 
 	qs, ok := queryV.BV().(goal.S)
 	if !ok {
-		return nil, "", goal.V{}, fmt.Errorf("%s : expected string query, got %q", verb, queryV.Type())
+		return call, fmt.Errorf("%s : expected string query, got %q", verb, queryV.Type())
 	}
-	return q, string(qs), paramsV, nil
+	call.query = string(qs)
+	return call, nil
 }
 
 // ---------------------------------------------------------------------------
@@ -482,7 +1151,7 @@ func parseConnQueryArgs(verb string, args []goal.V) (querier, string, goal.V, er
 // goalToSQLArgs converts a Goal value representing query parameters into a
 // []any slice suitable for database/sql.
 //
-// An array (AI, AF, AS, AV) yields one argument per element.
+// An array (AI, AF, AS, AV, sql.time) yields one argument per element.
 // A zero V (no params supplied) yields an empty slice.
 // A scalar value yields a single-element slice.
 func goalToSQLArgs(v goal.V) ([]any, error) {
@@ -528,6 +1197,14 @@ func goalToSQLArgs(v goal.V) ([]any, error) {
 			out[i] = b
 		}
 		return out, nil
+	case *Times:
+		out := make([]any, len(xv.micros))
+		for i := range xv.micros {
+			if t, ok := xv.timeAt(i); ok {
+				out[i] = t
+			}
+		}
+		return out, nil
 	}
 	// Scalar
 	sa, err := goalScalarToSQL(v)
@@ -555,6 +1232,24 @@ func goalScalarToSQL(v goal.V) (any, error) {
 	if ab, ok := v.BV().(*goal.AB); ok {
 		return ab.Slice, nil
 	}
+	if l, ok := v.BV().(*List); ok {
+		return l.arg()
+	}
+	if ts, ok := v.BV().(*Times); ok {
+		if len(ts.micros) != 1 {
+			return nil, fmt.Errorf("sql.time parameter must hold a single value, got %d", len(ts.micros))
+		}
+		if t, ok := ts.timeAt(0); ok {
+			return t, nil
+		}
+		return nil, nil //nolint:nilnil // nil value represents SQL NULL; nil error means no failure
+	}
+	if d, ok := v.BV().(*goal.D); ok {
+		return dictArg(d)
+	}
+	if _, ok := columnLen(v); ok {
+		return arrayArg(v)
+	}
 	return nil, fmt.Errorf("unsupported Goal type %q as SQL parameter", v.Type())
 }
 
@@ -563,56 +1258,112 @@ func goalScalarToSQL(v goal.V) (any, error) {
 // ---------------------------------------------------------------------------
 
 // scanRows scans all rows from *sql.Rows and returns a QueryResult dict.
-func scanRows(rows *stdsql.Rows) (goal.V, error) {
-	cols, err := rows.Columns()
+func scanRows(rows *stdsql.Rows, opts queryOptions) (goal.V, error) {
+	cols, colTypes, err := rowsColumns(rows)
 	if err != nil {
 		return goal.V{}, err
 	}
-	n := len(cols)
+	result, _, err := scanBatch(rows, cols, colTypes, -1, opts)
+	return result, err
+}
 
+// rowsColumns returns the column names and column types of rows.
+func rowsColumns(rows *stdsql.Rows) ([]string, []*stdsql.ColumnType, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
 	colTypes, err := rows.ColumnTypes()
 	if err != nil {
-		return goal.V{}, err
+		return nil, nil, err
 	}
+	return cols, colTypes, nil
+}
 
-	// Accumulate raw driver values per column.
-	colRaw := make([][]any, n)
+// scanBatch scans up to limit rows from rows (all remaining rows when limit
+// is negative) and returns them as a QueryResult dict along with the number
+// of rows scanned. A count below limit means rows is exhausted.
+func scanBatch(rows *stdsql.Rows, cols []string, colTypes []*stdsql.ColumnType, limit int, opts queryOptions) (goal.V, int, error) {
+	capHint := 16
+	if limit >= 0 && limit < capHint {
+		capHint = limit
+	}
+	colRaw := make([][]any, len(cols))
 	for i := range colRaw {
-		colRaw[i] = make([]any, 0, 16)
+		colRaw[i] = make([]any, 0, capHint)
+	}
+	count, err := scanInto(rows, colRaw, limit)
+	if err != nil {
+		return goal.V{}, 0, err
 	}
+	return buildResult(cols, colTypes, colRaw, opts), count, nil
+}
 
+// scanInto appends up to limit rows (all remaining rows when limit is
+// negative) of raw driver values to the per-column slices of colRaw, and
+// returns the number of rows scanned.
+func scanInto(rows *stdsql.Rows, colRaw [][]any, limit int) (int, error) {
+	n := len(colRaw)
 	scanBuf := make([]any, n)
 	ptrs := make([]any, n)
 	for i := range ptrs {
 		ptrs[i] = &scanBuf[i]
 	}
 
-	for rows.Next() {
+	count := 0
+	for ; limit < 0 || count < limit; count++ {
+		if !rows.Next() {
+			break
+		}
 		if err := rows.Scan(ptrs...); err != nil {
-			return goal.V{}, err
+			return 0, err
 		}
 		for i, v := range scanBuf {
 			colRaw[i] = append(colRaw[i], v)
 		}
 	}
 	if err := rows.Err(); err != nil {
-		return goal.V{}, err
+		return 0, err
 	}
+	return count, nil
+}
 
-	// Build per-column Goal arrays.
-	colArrays := make([]goal.V, n)
+// buildResult builds a QueryResult dict from per-column raw driver values.
+func buildResult(cols []string, colTypes []*stdsql.ColumnType, colRaw [][]any, opts queryOptions) goal.V {
+	colArrays := make([]goal.V, len(cols))
 	for i, raw := range colRaw {
-		if len(raw) == 0 {
+		if opts.scanValue != nil {
+			dbType := colTypes[i].DatabaseTypeName()
+			for j, v := range raw {
+				if x, ok := opts.scanValue(v, dbType); ok {
+					raw[j] = x
+				}
+			}
+		}
+		switch {
+		case opts.temporal && isTemporalColumn(raw, colTypes[i].DatabaseTypeName()):
+			colArrays[i] = buildTimes(raw, colTypes[i].DatabaseTypeName())
+		case len(raw) == 0:
 			colArrays[i] = emptyColumnArray(colTypes[i])
-		} else {
-			colArrays[i] = buildColumn(raw)
+		case colTypes[i].DatabaseTypeName() == "UUID":
+			colArrays[i] = buildColumn(uuidStrings(raw), opts.fill)
+		default:
+			colArrays[i] = buildColumn(raw, opts.fill)
 		}
 	}
 
 	// Build result dict: AS(colnames) → AV(arrays).
 	keys := goal.NewAS(cols)
-	vals := goal.NewAV(colArrays)
-	return goal.NewD(keys, vals), nil
+	result := goal.NewD(keys, goal.NewAV(colArrays))
+	if !opts.nullMask {
+		return result
+	}
+	masks := make([]goal.V, len(cols))
+	for i, raw := range colRaw {
+		masks[i] = nullMask(raw)
+	}
+	return goal.NewD(goal.NewAS([]string{"data", "null"}),
+		goal.NewAV([]goal.V{result, goal.NewD(keys, goal.NewAV(masks))}))
 }
 
 // emptyColumnArray returns an appropriately-typed empty array for a column
@@ -642,86 +1393,181 @@ func emptyColumnArray(ct *stdsql.ColumnType) goal.V {
 
 // buildColumn converts a slice of raw driver values (from a single column) to
 // a specialised Goal array according to the SqlToGoalTypeMapping invariant.
-func buildColumn(raw []any) goal.V { //nolint:funlen
-	// First pass: map each value to a Goal V, detect NULLs and mixed types.
-	vals := make([]goal.V, len(raw))
+// NULLs in float and string columns are replaced by the fill values (see
+// nullFill), as are those in integer columns when the "i" fill is set;
+// otherwise integer columns with NULLs become AF.
+func buildColumn(raw []any, fill nullFill) goal.V { //nolint:funlen
+	// First pass: find the common kind of the non-NULL values.
+	kind := kindNull
 	hasNull := false
-	allInt := true
-	allFloat := true
-	allStr := true
-	allBytes := true
-
-	for i, v := range raw {
-		gv := sqlValueToGoal(v)
-		vals[i] = gv
+	for _, v := range raw {
 		if v == nil {
 			hasNull = true
-			allInt = false
-			allFloat = false
-			allStr = false
-			allBytes = false
 			continue
 		}
-		switch v.(type) {
-		case int64, int32, int16, int8, int, uint64, uint32, uint16, uint8, uint, bool:
-			allFloat = false
-			allStr = false
-			allBytes = false
-		case float64, float32:
-			allInt = false
-			allStr = false
-			allBytes = false
-		case string:
-			allInt = false
-			allFloat = false
-			allBytes = false
-		case []byte:
-			allInt = false
-			allFloat = false
-			allStr = false
-		case time.Time:
-			// time.Time maps to int64 (Unix microseconds).
-			allFloat = false
-			allStr = false
-			allBytes = false
-		default:
-			allInt = false
-			allFloat = false
-			allStr = false
-			allBytes = false
+		switch k := kindOf(v); {
+		case kind == kindNull:
+			kind = k
+		case kind != k:
+			kind = kindOther
+		}
+		if kind == kindOther {
+			break
 		}
 	}
 
-	if hasNull {
-		return goal.NewAV(vals)
+	switch kind {
+	case kindInt:
+		if hasNull && !fill.iSet {
+			// Integers + NULLs → AF with 0n, as Goal itself normalises.
+			floats := make([]float64, len(raw))
+			for i, v := range raw {
+				if v == nil {
+					floats[i] = math.NaN()
+				} else {
+					floats[i] = float64(intValue(v))
+				}
+			}
+			return goal.NewAF(floats)
+		}
+		ints := make([]int64, len(raw))
+		for i, v := range raw {
+			if v == nil {
+				ints[i] = fill.i
+			} else {
+				ints[i] = intValue(v)
+			}
+		}
+		return goal.NewAI(ints)
+	case kindFloat, kindNull:
+		floats := make([]float64, len(raw))
+		for i, v := range raw {
+			if v == nil {
+				floats[i] = fill.float()
+			} else {
+				floats[i] = floatValue(v)
+			}
+		}
+		return goal.NewAF(floats)
+	case kindString:
+		strs := make([]string, len(raw))
+		for i, v := range raw {
+			if v == nil {
+				strs[i] = fill.s
+			} else {
+				strs[i] = v.(string) //nolint:errcheck,forcetypeassert // type is guaranteed: kindString was verified in first pass
+			}
+		}
+		return goal.NewAS(strs)
 	}
 
-	_ = allBytes // AV is already the fallback
+	// Mixed types (e.g. untyped SQLite columns), BLOBs and others → AV.
+	vals := make([]goal.V, len(raw))
+	for i, v := range raw {
+		vals[i] = sqlValueToGoal(v)
+	}
+	return goal.NewAV(vals)
+}
 
-	if allInt {
-		ints := make([]int64, len(vals))
-		for i, gv := range vals {
-			ints[i] = gv.I()
+// nullMask returns the NULL mask of a column of raw driver values: 1 at each
+// NULL position.
+func nullMask(raw []any) goal.V {
+	mask := make([]int64, len(raw))
+	for i, v := range raw {
+		if v == nil {
+			mask[i] = 1
 		}
-		return goal.NewAI(ints)
 	}
-	if allFloat {
-		floats := make([]float64, len(vals))
-		for i, gv := range vals {
-			floats[i] = gv.F()
+	return goal.NewAI(mask)
+}
+
+// colKind classifies the non-NULL driver values by the Goal array type they
+// specialise to.
+type colKind int
+
+const (
+	kindNull   colKind = iota // only NULLs seen so far
+	kindInt                   // I: integers, booleans and time.Time
+	kindFloat                 // F
+	kindString                // S
+	kindOther                 // AV: BLOBs, mixed and unknown types
+)
+
+// kindOf returns the kind of a non-NULL driver value.
+func kindOf(v any) colKind {
+	switch x := v.(type) {
+	case int64, int32, int16, int8, int, uint64, uint32, uint16, uint8, uint, bool, time.Time:
+		return kindInt
+	case *big.Int:
+		if x.IsInt64() {
+			return kindInt
 		}
-		return goal.NewAF(floats)
+		return kindOther
+	case float64, float32:
+		return kindFloat
+	case string:
+		return kindString
+	default:
+		return kindOther
+	}
+}
+
+// mergeKind returns the kind of a column holding values of kinds kind and
+// k, where kind is kindNull for no value yet: integers and floats merge to
+// floats, and other different kinds do not mix.
+func mergeKind(kind, k colKind) (colKind, bool) {
+	switch {
+	case kind == kindNull || kind == k:
+		return k, true
+	case (k == kindInt || k == kindFloat) && (kind == kindInt || kind == kindFloat):
+		return kindFloat, true
 	}
-	if allStr {
-		strs := make([]string, len(vals))
-		for i, gv := range vals {
-			strs[i] = string(gv.BV().(goal.S)) //nolint:errcheck // type is guaranteed: allStr was verified in first pass
+	return kind, false
+}
+
+// intValue converts a driver value of kind kindInt to int64, as
+// sqlValueToGoal does.
+func intValue(v any) int64 {
+	switch x := v.(type) {
+	case int64:
+		return x
+	case int32:
+		return int64(x)
+	case int16:
+		return int64(x)
+	case int8:
+		return int64(x)
+	case int:
+		return int64(x)
+	case uint64:
+		return int64(x) //nolint:gosec // G115: intentional widening; overflow risk is documented
+	case uint32:
+		return int64(x)
+	case uint16:
+		return int64(x)
+	case uint8:
+		return int64(x)
+	case uint:
+		return int64(x) //nolint:gosec // G115: intentional widening; overflow only for values > MaxInt64
+	case bool:
+		if x {
+			return 1
 		}
-		return goal.NewAS(strs)
+		return 0
+	case time.Time:
+		return x.UnixMicro()
+	case *big.Int:
+		return x.Int64()
 	}
+	return 0
+}
 
-	// Mixed types (e.g. untyped SQLite columns) → AV.
-	return goal.NewAV(vals)
+// floatValue converts a driver value of kind kindFloat to float64.
+func floatValue(v any) float64 {
+	if x, ok := v.(float32); ok {
+		return float64(x)
+	}
+	return v.(float64) //nolint:errcheck,forcetypeassert // type is guaranteed by kindOf
 }
 
 // ---------------------------------------------------------------------------
@@ -773,7 +1619,18 @@ func sqlValueToGoal(v any) goal.V {
 	case time.Time:
 		// Unix microseconds since 1970-01-01 UTC, following ari's convention.
 		return goal.NewI(x.UnixMicro())
+	case *big.Int:
+		return bigIntToGoal(x)
+	case []any:
+		return nestedArray(x)
+	case map[string]any:
+		return structDict(x)
+	case map[any]any:
+		return mapDict(x)
 	default:
+		if gv, ok := duckdbValueToGoal(x); ok {
+			return gv
+		}
 		// Fallback: represent as a string via fmt.
 		return goal.NewS(fmt.Sprintf("%v", x))
 	}
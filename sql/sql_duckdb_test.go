@@ -16,15 +16,19 @@ package sql_test
 
 import (
 	"math"
+	"strings"
 	"testing"
 
 	goal "codeberg.org/anaseto/goal"
 )
 
-// openDuckDB opens an in-memory DuckDB database and returns the Goal value.
-func openDuckDB(t *testing.T, ctx *goal.Context) goal.V {
+// openDuckDB opens an in-memory DuckDB database and returns the Goal value,
+// after running stmts on it (see seed).
+func openDuckDB(t *testing.T, ctx *goal.Context, stmts ...string) goal.V {
 	t.Helper()
-	return eval(t, ctx, `sql.open["duckdb://"]`)
+	db := eval(t, ctx, `sql.open["duckdb://"]`)
+	seed(t, ctx, db, stmts...)
+	return db
 }
 
 // ---------------------------------------------------------------------------
@@ -59,6 +63,25 @@ func TestDuckDBOpenMemoryAlias(t *testing.T) {
 	}
 }
 
+func TestDuckDBOpenSettings(t *testing.T) {
+	ctx := newCtx(t)
+	db := eval(t, ctx, `sql.open["duckdb://";..[MaxOpenConns:1;Settings:..[threads:2;memory_limit:"512MB"]]]`)
+	ctx.AssignGlobal("db", db)
+	got := db.Sprint(ctx, false)
+	for _, want := range []string{"threads=2", "memory_limit=", "MaxOpenConns=1"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("sql.conn: expected %s in %s", want, got)
+		}
+	}
+	v := eval(t, ctx, `*sql.q[db;"SELECT current_setting('threads') AS n"]"n"`)
+	if n := mustI(t, v); n != 2 {
+		t.Errorf("threads: expected 2, got %d", n)
+	}
+
+	evalPanic(t, ctx, `sql.open["duckdb://";..[Settings:..[no_such_setting:1]]]`)
+	evalPanic(t, ctx, `sql.open["duckdb://";..[Pragmas:..[foreign_keys:1]]]`) // SQLite only
+}
+
 // ---------------------------------------------------------------------------
 // TestDuckDBExecDDL
 // ---------------------------------------------------------------------------
@@ -2,6 +2,8 @@ package sql_test
 
 import (
 	"math"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	goal "codeberg.org/anaseto/goal"
@@ -50,12 +52,52 @@ func evalPanic(t *testing.T, ctx *goal.Context, src string) string {
 	return v.Sprint(ctx, true)
 }
 
-// openMem opens an in-memory SQLite database and returns the Goal value.
-func openMem(t *testing.T, ctx *goal.Context) goal.V {
+// openMem opens an in-memory SQLite database and returns the Goal value,
+// after running stmts on it (see seed).
+func openMem(t *testing.T, ctx *goal.Context, stmts ...string) goal.V {
 	t.Helper()
-	return eval(t, ctx, `sql.open["sqlite://:memory:"]`)
+	db := eval(t, ctx, `sql.open["sqlite://:memory:"]`)
+	seed(t, ctx, db, stmts...)
+	return db
 }
 
+// openFile opens the SQLite database file at path, with the options dict
+// opts unless it is empty, and returns the Goal value after running stmts
+// on it (see seed).
+func openFile(t *testing.T, ctx *goal.Context, path, opts string, stmts ...string) goal.V {
+	t.Helper()
+	uri := `"sqlite://` + path + `"`
+	var db goal.V
+	if opts != "" {
+		db = eval(t, ctx, `sql.open[`+uri+`;`+opts+`]`)
+	} else {
+		db = eval(t, ctx, `sql.open `+uri)
+	}
+	seed(t, ctx, db, stmts...)
+	return db
+}
+
+// seed runs stmts on the sql.conn db, such as the statements creating and
+// filling the tables a test reads.
+func seed(t *testing.T, ctx *goal.Context, db goal.V, stmts ...string) {
+	t.Helper()
+	exec := eval(t, ctx, `sql.exec`)
+	for _, stmt := range stmts {
+		if r := ctx.Apply2(exec, db, goal.NewS(stmt)); r.IsPanic() {
+			t.Fatalf("seed %q: %s", stmt, r.Sprint(ctx, true))
+		}
+	}
+}
+
+// Seed statements of tables shared by tests: t (id, name) holds the rows 1
+// to 5 named "a" to "e", users (id, name) the rows 1 to 3 named "a" to "c".
+const (
+	createT     = `CREATE TABLE t (id INTEGER, name TEXT)`
+	fillT       = `INSERT INTO t VALUES (1,'a'),(2,'b'),(3,'c'),(4,'d'),(5,'e')`
+	createUsers = `CREATE TABLE users (id INTEGER, name TEXT)`
+	fillUsers   = `INSERT INTO users VALUES (1,'a'),(2,'b'),(3,'c')`
+)
+
 // mustI extracts an int64 from a Goal I value.
 func mustI(t *testing.T, v goal.V) int64 {
 	t.Helper()
@@ -172,6 +214,130 @@ func TestOpenBadURI(t *testing.T) {
 	evalPanic(t, ctx, `sql.open "no-scheme-here"`)
 }
 
+func TestOpenOptions(t *testing.T) {
+	ctx := newCtx(t)
+	uri := "sqlite://" + filepath.Join(t.TempDir(), "opts.db")
+	ctx.AssignGlobal("uri", goal.NewS(uri))
+
+	db := eval(t, ctx, `sql.open[uri;..[MaxOpenConns:2;ConnMaxIdleTimeMilli:60000;Pragmas:..[journal_mode:"WAL";foreign_keys:1;busy_timeout:5000]]]`)
+	ctx.AssignGlobal("db", db)
+	got := db.Sprint(ctx, false)
+	for _, want := range []string{"journal_mode=wal", "foreign_keys=1", "busy_timeout=5000", "MaxOpenConns=2", "ConnMaxIdleTimeMilli=60000"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("sql.conn: expected %s in %s", want, got)
+		}
+	}
+
+	// Pragmas apply to every pooled connection.
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE p (id INTEGER PRIMARY KEY)"]`)
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE c (pid INTEGER REFERENCES p(id))"]`)
+	for range 3 {
+		evalPanic(t, ctx, `sql.exec[db;"INSERT INTO c VALUES (42)"]`)
+	}
+
+	// Without options the printed form is unchanged.
+	if got := openMem(t, ctx).Sprint(ctx, false); got != "sql.conn[sqlite::memory:]" {
+		t.Errorf("sql.conn: expected sql.conn[sqlite::memory:], got %s", got)
+	}
+}
+
+func TestOpenOptionErrors(t *testing.T) {
+	ctx := newCtx(t)
+	for _, src := range []string{
+		`sql.open["sqlite://:memory:";..[MaxOpenConns:-1]]`,
+		`sql.open["sqlite://:memory:";..[MaxIdleConns:"2"]]`,
+		`sql.open["sqlite://:memory:";..[Settings:..[threads:2]]]`,            // DuckDB only
+		`sql.open["sqlite://:memory:";..[Pragmas:..[journal_mode:"WAL; x"]]]`, // not a keyword
+		`sql.open["sqlite://:memory:";..[Pragmas:(,"bad name")!,1]]`,
+		`sql.open["sqlite://:memory:";..[Pragmas:"journal_mode=WAL"]]`,
+		`sql.open["sqlite://:memory:";"opts"]`,
+	} {
+		evalPanic(t, ctx, src)
+	}
+}
+
+func TestOpenMemory(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, `CREATE TABLE t (id INTEGER)`, `INSERT INTO t VALUES (1),(2),(3)`))
+
+	// Queries run on the connection of the open cursor, which holds the
+	// database.
+	ctx.AssignGlobal("cur", eval(t, ctx, `sql.cursor[db;"SELECT id FROM t"]`))
+	if n := mustI(t, eval(t, ctx, `#(db sql.q "SELECT id FROM t")"id"`)); n != 3 {
+		t.Fatalf("with open cursor: expected 3 rows, got %d", n)
+	}
+	eval(t, ctx, `sql.close cur`)
+
+	// An open transaction holds it: calls needing another connection fail.
+	ctx.AssignGlobal("tx", eval(t, ctx, `sql.begin db`))
+	if got := evalPanic(t, ctx, `db sql.q "SELECT id FROM t"`); !strings.Contains(got, "MaxOpenConns") {
+		t.Errorf("with open tx: expected MaxOpenConns error, got %s", got)
+	}
+	eval(t, ctx, `sql.rollback tx`)
+
+	// Each sql.open of ":memory:" is a database of its own.
+	ctx.AssignGlobal("db2", openMem(t, ctx))
+	evalPanic(t, ctx, `db2 sql.q "SELECT id FROM t"`)
+
+	for _, src := range []string{
+		`sql.open["sqlite://:memory:";..[MaxOpenConns:2]]`,
+		`sql.open["sqlite://` + t.TempDir() + `/f.db";..[SharedCache:1]]`,
+	} {
+		evalPanic(t, ctx, src)
+	}
+}
+
+func TestOpenMemorySharedCache(t *testing.T) {
+	ctx := newCtx(t)
+	db := eval(t, ctx, `sql.open["sqlite://:memory:";..[SharedCache:1]]`)
+	ctx.AssignGlobal("db", db)
+	seed(t, ctx, db, `CREATE TABLE t (id INTEGER)`, `INSERT INTO t VALUES (1),(2),(3)`)
+	if got := db.Sprint(ctx, false); !strings.Contains(got, "SharedCache=1") {
+		t.Errorf("sql.conn: expected SharedCache=1 in %s", got)
+	}
+
+	// Queries on other connections of the pool see the same database.
+	ctx.AssignGlobal("tx", eval(t, ctx, `sql.begin db`))
+	ctx.AssignGlobal("cur", eval(t, ctx, `sql.cursor[db;"SELECT id FROM t"]`))
+	if n := mustI(t, eval(t, ctx, `#(db sql.q "SELECT id FROM t")"id"`)); n != 3 {
+		t.Fatalf("with open tx and cursor: expected 3 rows, got %d", n)
+	}
+	eval(t, ctx, `sql.rollback tx`)
+
+	// Shared cache locks tables: the cursor reading t keeps it from being
+	// written.
+	eval(t, ctx, `sql.fetch[cur;1]`)
+	if got := evalPanic(t, ctx, `db sql.exec "DELETE FROM t"`); !strings.Contains(got, "locked") {
+		t.Errorf("with open cursor: expected locked error, got %s", got)
+	}
+	eval(t, ctx, `sql.close cur`)
+	eval(t, ctx, `db sql.exec "DELETE FROM t"`)
+}
+
+func TestPoolExhausted(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openFile(t, ctx, t.TempDir()+"/pool.db", `..[MaxOpenConns:1]`,
+		`CREATE TABLE t (id INTEGER)`, `INSERT INTO t VALUES (1),(2),(3)`))
+
+	// The open cursor holds the only connection: calls needing another one
+	// fail instead of waiting forever.
+	ctx.AssignGlobal("cur", eval(t, ctx, `sql.cursor[db;"SELECT id FROM t"]`))
+	for _, src := range []string{
+		`db sql.q "SELECT id FROM t"`,
+		`db sql.exec "DELETE FROM t"`,
+		`sql.begin db`,
+		`sql.tables db`,
+	} {
+		if got := evalPanic(t, ctx, src); !strings.Contains(got, "MaxOpenConns") {
+			t.Errorf("%s: expected MaxOpenConns error, got %s", src, got)
+		}
+	}
+	eval(t, ctx, `sql.close cur`)
+	if n := mustI(t, eval(t, ctx, `#(db sql.q "SELECT id FROM t")"id"`)); n != 3 {
+		t.Fatalf("after sql.close cur: expected 3 rows, got %d", n)
+	}
+}
+
 // ---------------------------------------------------------------------------
 // TestExecDDL
 // ---------------------------------------------------------------------------
@@ -343,12 +509,8 @@ func TestNullHandling(t *testing.T) {
 	d := mustDict(t, ctx, v)
 	valCol := dictLookup(t, ctx, d, "val")
 
-	// An INTEGER column containing NULLs: Goal's NewAV normalises
-	// [I(10), F(NaN), I(30)] to AF because integers and floats share a
-	// common numeric supertype. The NULL is still represented as 0n (NaN).
-	//
-	// A TEXT column with NULLs would produce AV because S and F have no
-	// common scalar type.
+	// An INTEGER column containing NULLs is returned as AF, as Goal
+	// normalises [I(10), F(NaN), I(30)], with the NULL as 0n (NaN).
 	af, ok := valCol.BV().(*goal.AF)
 	if !ok {
 		t.Fatalf("val column (int+NULLs): expected AF, got %q", valCol.Type())
@@ -371,6 +533,71 @@ func TestNullHandling(t *testing.T) {
 	}
 }
 
+func TestNullFill(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id INTEGER, n INTEGER, x REAL, s TEXT)"]`)
+	eval(t, ctx, `sql.exec[db;"INSERT INTO t VALUES (1, 10, 1.5, 'a'), (2, NULL, NULL, NULL), (3, 30, 2.5, '')"]`)
+	q := `"SELECT n, x, s FROM t ORDER BY id"`
+
+	// Defaults: numeric NULLs are 0n, string NULLs "", all flat arrays.
+	v := eval(t, ctx, `sql.q[db;`+q+`]`)
+	d := mustDict(t, ctx, v)
+	for col, want := range map[string]string{"n": "N", "x": "N", "s": "S"} {
+		if got := dictLookup(t, ctx, d, col).Type(); got != want {
+			t.Errorf("column %s: expected type %s, got %s", col, want, got)
+		}
+	}
+	if n := mustI(t, eval(t, ctx, `+/sql.q[db;`+q+`;();..[Fill:..[i:0]]]"n"`)); n != 40 {
+		t.Errorf("+/ over AI column: expected 40, got %d", n)
+	}
+	if got := strCol(t, ctx, v, "s"); got[1] != "" {
+		t.Errorf("string NULL: expected \"\", got %q", got[1])
+	}
+
+	// Fill values per type; integer columns stay AI.
+	v = eval(t, ctx, `sql.q[db;`+q+`;();..[Fill:..[i:-1;n:0;s:"NA"]]]`)
+	d = mustDict(t, ctx, v)
+	for col, want := range map[string]string{"n": "10 -1 30", "x": "1.5 0.0 2.5"} {
+		if got := dictLookup(t, ctx, d, col).Sprint(ctx, true); got != want {
+			t.Errorf("Fill column %s: expected %s, got %s", col, want, got)
+		}
+	}
+	if got := dictLookup(t, ctx, d, "n").Type(); got != "I" {
+		t.Errorf("Fill column n: expected type I, got %s", got)
+	}
+	if got := strCol(t, ctx, v, "s"); got[1] != "NA" || got[2] != "" {
+		t.Errorf("Fill column s: expected NA, got %q", got[1])
+	}
+
+	// NullMask returns the data and a mask per column.
+	d = mustDict(t, ctx, eval(t, ctx, `sql.q[db;`+q+`;();..[NullMask:1]]`))
+	masks := mustDict(t, ctx, dictLookup(t, ctx, d, "null"))
+	for _, col := range []string{"n", "x", "s"} {
+		if got := dictLookup(t, ctx, masks, col).Sprint(ctx, true); got != "0 1 0" {
+			t.Errorf("NullMask column %s: expected 0 1 0, got %s", col, got)
+		}
+	}
+	data := dictLookup(t, ctx, mustDict(t, ctx, dictLookup(t, ctx, d, "data")), "s")
+	if got := data.Type(); got != "S" {
+		t.Errorf("NullMask data: expected type S, got %s", got)
+	}
+	if got := data.Sprint(ctx, true); got != `"a" "" ""` {
+		t.Errorf("NullMask data: expected \"a\" \"\" \"\", got %s", got)
+	}
+
+	// The fill values also apply to cursor batches.
+	v = eval(t, ctx, `(sql.cursor[db;`+q+`;();..[Fill:..[i:0]]]) sql.fetch 10`)
+	if got := dictLookup(t, ctx, mustDict(t, ctx, v), "n").Sprint(ctx, true); got != "10 0 30" {
+		t.Fatalf("cursor fill: expected 10 0 30, got %s", got)
+	}
+
+	evalPanic(t, ctx, `sql.q[db;`+q+`;();..[Fill:-1]]`)
+	evalPanic(t, ctx, `sql.q[db;`+q+`;();..[Fill:..[i:1.5]]]`)
+	evalPanic(t, ctx, `sql.q[db;`+q+`;();..[Fill:..[s:1]]]`)
+	evalPanic(t, ctx, `sql.q[db;`+q+`;();..[Fill:..[b:0]]]`)
+}
+
 // ---------------------------------------------------------------------------
 // TestFloatColumn
 // ---------------------------------------------------------------------------
@@ -462,14 +689,18 @@ func TestTransactionRollback(t *testing.T) {
 
 func TestTransactionNestedError(t *testing.T) {
 	ctx := newCtx(t)
-	ctx.AssignGlobal("db", openMem(t, ctx))
-
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
 	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (x INTEGER)"]`)
 
-	// sql.tx on a sql.tx (not *Conn) must be an error.
-	msg := evalPanic(t, ctx, `sql.tx[db;{[tx2] sql.tx[tx2;{[tx3] 1i}]}]`)
-	if msg == "" {
-		t.Fatal("expected panic for nested transaction, got none")
+	// DuckDB has no savepoints: a nested transaction is an error, which
+	// rolls back the outer transaction.
+	msg := evalPanic(t, ctx, `sql.tx[db;{[tx] tx sql.exec "INSERT INTO t VALUES (1)"
+		sql.tx[tx;{[sp] sp sql.exec "INSERT INTO t VALUES (2)"}]}]`)
+	if !strings.Contains(msg, "savepoints") {
+		t.Fatalf("nested sql.tx: expected savepoints error, got %s", msg)
+	}
+	if n := mustI(t, eval(t, ctx, `#sql.q[db;"SELECT x FROM t"]"x"`)); n != 0 {
+		t.Fatalf("after nested sql.tx error: expected no rows, got %d", n)
 	}
 }
 
@@ -0,0 +1,358 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"fmt"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// BV wrapper: sql.stmt
+// ---------------------------------------------------------------------------
+
+// Stmt wraps a prepared *sql.Stmt as a Goal boxed value (sql.stmt). sql.q and
+// sql.exec accept it in place of a connection, so the SQL is parsed once and
+// executed many times.
+type Stmt struct {
+	stmt   *stdsql.Stmt
+	conn   *Conn        // connection the statement was prepared on
+	tx     *GoalTx      // transaction it was prepared in, or nil
+	pin    *stdsql.Conn // Conn.pin when prepared on it, or nil
+	query  string
+	names  []string // :name placeholders in order of appearance, or nil
+	scheme driverScheme
+	closed bool
+}
+
+func (st *Stmt) Append(_ *goal.Context, dst []byte, _ bool) []byte {
+	return append(dst, fmt.Sprintf("sql.stmt[%s]", st.query)...)
+}
+func (st *Stmt) Matches(y goal.BV) bool { yv, ok := y.(*Stmt); return ok && st == yv }
+func (st *Stmt) Type() string           { return "sql.stmt" }
+
+// check reports an error if the statement can no longer be executed.
+func (st *Stmt) check() error {
+	switch {
+	case st.closed:
+		return fmt.Errorf("statement is closed")
+	case st.conn.closed:
+		return fmt.Errorf("connection is closed")
+	case st.tx != nil && st.tx.done:
+		return fmt.Errorf("transaction is closed")
+	case st.pin != nil && st.pin != st.conn.pin:
+		return fmt.Errorf("the connection the statement was prepared on was replaced by sql.func: prepare it again")
+	case st.pin != nil && st.conn.pinTx != nil:
+		return fmt.Errorf("a transaction is open on the connection the statement was prepared on")
+	case st.tx == nil && st.pin == nil:
+		return st.conn.checkConns()
+	}
+	return nil
+}
+
+// close releases the prepared statement. It is safe to call more than once.
+func (st *Stmt) close() error {
+	if st.closed {
+		return nil
+	}
+	st.closed = true
+	return st.stmt.Close()
+}
+
+// stmtQuerier adapts a prepared statement to the querier interface. The
+// query argument is ignored: the statement already holds its SQL.
+type stmtQuerier struct{ stmt *stdsql.Stmt }
+
+func (q stmtQuerier) QueryContext(ctx context.Context, _ string, args ...any) (*stdsql.Rows, error) {
+	return q.stmt.QueryContext(ctx, args...)
+}
+
+func (q stmtQuerier) ExecContext(ctx context.Context, _ string, args ...any) (stdsql.Result, error) {
+	return q.stmt.ExecContext(ctx, args...)
+}
+
+// parseStmtArgs handles the calling conventions of sql.q and sql.exec when
+// their first argument is a sql.stmt:
+//
+//	len==2: stmt verb params              → (stmt, params)
+//	len==3: verb[stmt;params;opts]        → (stmt, params, opts)
+func parseStmtArgs(verb string, st *Stmt, args []goal.V) (queryCall, error) {
+	call := queryCall{conn: stmtQuerier{st.stmt}, query: st.query, db: st.conn, stmt: st}
+	switch len(args) {
+	case 2:
+		// args[0] = params (right), args[1] = stmt (left)
+		call.params = args[0]
+	case 3:
+		// args[0] = opts, args[1] = params, args[2] = stmt
+		call.params = args[1]
+		opts, err := parseQueryOptions(verb, args[0])
+		if err != nil {
+			return call, err
+		}
+		call.opts = opts
+	default:
+		return call, fmt.Errorf("%s : expected 2 or 3 arguments with sql.stmt, got %d", verb, len(args))
+	}
+	if err := st.check(); err != nil {
+		return call, fmt.Errorf("%s : %w", verb, err)
+	}
+	call.setTimeout(st.conn)
+	call.opts.scanValue = st.scheme.scanValue
+	return call, nil
+}
+
+// isParamTable reports whether params is a parameter table (a columnar
+// dict whose values are all arrays), which runs a statement once per row.
+// A dict of scalars is a single set of named parameters instead.
+func isParamTable(params goal.V) bool {
+	d, ok := params.BV().(*goal.D)
+	if !ok {
+		return false
+	}
+	vav, ok := d.ValueArray().(*goal.AV)
+	if !ok || len(vav.Slice) == 0 {
+		return false
+	}
+	for _, col := range vav.Slice {
+		if _, ok := columnLen(col); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// bind converts params for a single execution of the statement.
+func (st *Stmt) bind(params goal.V) ([]any, error) {
+	d, ok := params.BV().(*goal.D)
+	if !ok {
+		args, err := goalToSQLArgs(params)
+		if err != nil {
+			return nil, err
+		}
+		return args, checkNoList(args)
+	}
+	if st.names == nil {
+		return nil, fmt.Errorf("named parameters given, but statement has no :name placeholders")
+	}
+	lookup, err := dictParams(d)
+	if err != nil {
+		return nil, err
+	}
+	vals, err := namedValues(st.names, lookup)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNoList(vals); err != nil {
+		return nil, err
+	}
+	return namedArgs(st.scheme, st.names, vals), nil
+}
+
+// checkNoList rejects sql.list and nested parameters, which change the SQL
+// text and so cannot be bound to an already prepared statement.
+func checkNoList(args []any) error {
+	if hasList(args) {
+		return fmt.Errorf("sql.list and nested parameters cannot be bound to a prepared statement")
+	}
+	return nil
+}
+
+// rowArgs returns row i of a parameter table as arguments. Columns bind
+// :name placeholders by column name, or positional placeholders in order.
+func (st *Stmt) rowArgs(pnames []string, pcols []goal.V, i int) ([]any, error) {
+	if st.names == nil {
+		args, err := tableRowArgs(pcols, i)
+		if err != nil {
+			return nil, err
+		}
+		return args, checkNoList(args)
+	}
+	vals, err := namedValues(st.names, func(name string) (any, error) {
+		for j, pname := range pnames {
+			if pname == name {
+				v, err := columnValue(pcols[j], i)
+				if err != nil {
+					return nil, fmt.Errorf("row %d, column %q: %w", i, name, err)
+				}
+				return v, nil
+			}
+		}
+		return nil, fmt.Errorf("missing named parameter column %q", name)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkNoList(vals); err != nil {
+		return nil, err
+	}
+	return namedArgs(st.scheme, st.names, vals), nil
+}
+
+// queryTable runs the statement once per row of a parameter table and
+// concatenates the result rows. With zero parameter rows there are no
+// result columns either, so the result is an empty dict.
+func (st *Stmt) queryTable(ctx context.Context, verb string, params goal.V, opts queryOptions) (goal.V, error) {
+	pnames, pcols, nrows, err := parseTable(verb, params)
+	if err != nil {
+		return goal.V{}, err
+	}
+	var cols []string
+	var colTypes []*stdsql.ColumnType
+	var colRaw [][]any
+	for i := range nrows {
+		args, err := st.rowArgs(pnames, pcols, i)
+		if err != nil {
+			return goal.V{}, err
+		}
+		rows, err := st.stmt.QueryContext(ctx, args...)
+		if err != nil {
+			return goal.V{}, fmt.Errorf("row %d: %w", i, err)
+		}
+		if colRaw == nil {
+			cols, colTypes, err = rowsColumns(rows)
+			if err != nil {
+				rows.Close()
+				return goal.V{}, err
+			}
+			colRaw = make([][]any, len(cols))
+		}
+		_, err = scanInto(rows, colRaw, -1)
+		rows.Close()
+		if err != nil {
+			return goal.V{}, fmt.Errorf("row %d: %w", i, err)
+		}
+	}
+	if colRaw == nil {
+		return goal.NewD(goal.NewAS([]string{}), goal.NewAV([]goal.V{})), nil
+	}
+	return buildResult(cols, colTypes, colRaw, opts), nil
+}
+
+// execTable runs the statement once per row of a parameter table. Outside
+// a transaction the rows are executed in a new one, so the whole table is
+// applied or none of it is.
+func (st *Stmt) execTable(ctx context.Context, verb string, params goal.V) (execSummary, error) {
+	pnames, pcols, nrows, err := parseTable(verb, params)
+	if err != nil {
+		return execSummary{}, err
+	}
+	rowArgs := func(i int) ([]any, error) { return st.rowArgs(pnames, pcols, i) }
+	if st.tx != nil {
+		return execRows(ctx, st.stmt, nrows, rowArgs)
+	}
+
+	var begin connTarget = st.conn.db
+	if st.pin != nil {
+		begin = st.pin
+	}
+	tx, err := begin.BeginTx(ctx, nil)
+	if err != nil {
+		return execSummary{}, fmt.Errorf("begin: %w", err)
+	}
+	txStmt := tx.StmtContext(ctx, st.stmt)
+	res, err := execRows(ctx, txStmt, nrows, rowArgs)
+	txStmt.Close()
+	if err != nil {
+		_ = tx.Rollback()
+		return execSummary{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return execSummary{}, fmt.Errorf("commit: %w", err)
+	}
+	return res, nil
+}
+
+// execRows executes stmt once per parameter row, with the arguments of row
+// i given by rowArgs.
+func execRows(ctx context.Context, stmt *stdsql.Stmt, nrows int, rowArgs func(int) ([]any, error)) (execSummary, error) {
+	var res execSummary
+	for i := range nrows {
+		args, err := rowArgs(i)
+		if err != nil {
+			return res, err
+		}
+		r, err := stmt.ExecContext(ctx, args...)
+		if err != nil {
+			return res, fmt.Errorf("row %d: %w", i, err)
+		}
+		res.add(r)
+	}
+	return res, nil
+}
+
+// tableRowArgs returns row i of a parameter table as positional arguments.
+func tableRowArgs(pcols []goal.V, i int) ([]any, error) {
+	args := make([]any, len(pcols))
+	for j, col := range pcols {
+		v, err := columnValue(col, i)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %w", i, err)
+		}
+		args[j] = v
+	}
+	return args, nil
+}
+
+// ---------------------------------------------------------------------------
+// sql.prepare  (dyad: conn sql.prepare "query")
+// ---------------------------------------------------------------------------
+
+// vfPrepare prepares a statement on a connection or transaction and returns
+// it as a sql.stmt. sql.q and sql.exec accept the statement in place of a
+// connection, with the parameters as right argument. A columnar dict of
+// parameters runs the statement once per row: sql.q concatenates the result
+// rows and sql.exec sums rowsAffected. With :name placeholders, parameter
+// dicts and table columns bind by name.
+//
+// Usage:
+//
+//	st: db sql.prepare "SELECT name FROM users WHERE id=?"
+//	st sql.q ,42
+//	st sql.q ..[id:1 2 3]
+//	sql.close st
+func vfPrepare(_ *goal.Context, args []goal.V) goal.V {
+	if len(args) != 2 {
+		return goal.Panicf("conn sql.prepare query : expected 2 arguments, got %d", len(args))
+	}
+	// args[0] = query (right), args[1] = conn (left)
+	qs, ok := args[0].BV().(goal.S)
+	if !ok {
+		return goal.Panicf("conn sql.prepare query : expected string query, got %q", args[0].Type())
+	}
+	query := string(qs)
+
+	q, sch, err := connScheme("conn sql.prepare query", args[1])
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	st := &Stmt{query: query, conn: connOf(args[1]), scheme: sch}
+	if tx, ok := args[1].BV().(*GoalTx); ok {
+		st.tx = tx
+	}
+	prepared := query
+	if names, positional := parseNamed(query, sch.script); names != nil {
+		st.names = names
+		if !sch.namedParams {
+			prepared = positional
+		}
+	}
+	if st.names == nil || !sch.namedParams {
+		prepared = sch.positional(prepared)
+	}
+	ctx, done := callContext(st.conn.timeout)
+	defer done()
+	switch pq := q.(type) {
+	case *stdsql.DB:
+		st.stmt, err = pq.PrepareContext(ctx, prepared)
+	case *stdsql.Conn:
+		st.stmt, err = pq.PrepareContext(ctx, prepared)
+		st.pin = pq
+	case *stdsql.Tx:
+		st.stmt, err = pq.PrepareContext(ctx, prepared)
+	}
+	if err != nil {
+		return goal.Panicf("sql.prepare %q: %v", query, callErr(ctx, err))
+	}
+	return goal.NewV(st)
+}
@@ -0,0 +1,116 @@
+package sql_test
+
+import (
+	"testing"
+)
+
+// ---------------------------------------------------------------------------
+// TestPrepare
+// ---------------------------------------------------------------------------
+
+func TestPrepareQuery(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createUsers, fillUsers))
+	st := eval(t, ctx, `db sql.prepare "SELECT name FROM users WHERE id = ?"`)
+	if st.Type() != "sql.stmt" {
+		t.Fatalf("sql.prepare: expected sql.stmt, got %q", st.Type())
+	}
+	ctx.AssignGlobal("st", st)
+
+	for id, want := range map[string]string{"1": "a", "3": "c"} {
+		got := strCol(t, ctx, eval(t, ctx, `st sql.q ,`+id), "name")
+		if len(got) != 1 || got[0] != want {
+			t.Errorf("st sql.q ,%s: expected [%s], got %v", id, want, got)
+		}
+	}
+	got := strCol(t, ctx, eval(t, ctx, `sql.q[st;,2]`), "name")
+	if len(got) != 1 || got[0] != "b" {
+		t.Errorf("sql.q[st;,2]: expected [b], got %v", got)
+	}
+}
+
+func TestPrepareQueryTable(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createUsers, fillUsers))
+	ctx.AssignGlobal("st", eval(t, ctx, `db sql.prepare "SELECT id, name FROM users WHERE id = ?"`))
+
+	// One execution per parameter row; rows without a match contribute
+	// nothing to the concatenated result.
+	v := eval(t, ctx, `st sql.q ..[id:3 9 1]`)
+	if got := strCol(t, ctx, v, "name"); len(got) != 2 || got[0] != "c" || got[1] != "a" {
+		t.Fatalf("vectorised sql.q: expected [c a], got %v", got)
+	}
+	if got := dictLookup(t, ctx, mustDict(t, ctx, v), "id").Sprint(ctx, true); got != "3 1" {
+		t.Fatalf("vectorised sql.q id: expected 3 1, got %s", got)
+	}
+}
+
+func TestPrepareExecTable(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createUsers, fillUsers))
+	ctx.AssignGlobal("ins", eval(t, ctx, `db sql.prepare "INSERT INTO users VALUES (?, ?)"`))
+
+	_, rowsAff := execResult(t, ctx, eval(t, ctx, `ins sql.exec (4;"d")`))
+	if rowsAff != 1 {
+		t.Fatalf("ins sql.exec: expected rowsAffected=1, got %d", rowsAff)
+	}
+	_, rowsAff = execResult(t, ctx, eval(t, ctx, `ins sql.exec ..[id:5 6;name:("e";"f")]`))
+	if rowsAff != 2 {
+		t.Fatalf("vectorised sql.exec: expected rowsAffected=2, got %d", rowsAff)
+	}
+	if n := mustI(t, eval(t, ctx, `#sql.q[db;"SELECT id FROM users"]"id"`)); n != 6 {
+		t.Fatalf("after inserts: expected 6 rows, got %d", n)
+	}
+}
+
+func TestPrepareExecTableAtomic(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (id INTEGER PRIMARY KEY)"]`)
+	ctx.AssignGlobal("ins", eval(t, ctx, `db sql.prepare "INSERT INTO t VALUES (?)"`))
+
+	evalPanic(t, ctx, `ins sql.exec ..[id:1 2 2]`)
+	if n := mustI(t, eval(t, ctx, `#sql.q[db;"SELECT id FROM t"]"id"`)); n != 0 {
+		t.Fatalf("after failed vectorised exec: expected 0 rows, got %d", n)
+	}
+}
+
+func TestPrepareInTx(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createUsers, fillUsers))
+	v := eval(t, ctx, `sql.tx[db;{[tx] st: tx sql.prepare "DELETE FROM users WHERE id = ?"; st sql.exec ..[id:1 2]}]`)
+	if _, rowsAff := execResult(t, ctx, v); rowsAff != 2 {
+		t.Fatalf("vectorised exec in tx: expected rowsAffected=2, got %d", rowsAff)
+	}
+
+	// The statement cannot outlive its transaction.
+	ctx.AssignGlobal("st", eval(t, ctx, `sql.tx[db;{[tx] tx sql.prepare "SELECT 1"}]`))
+	evalPanic(t, ctx, `st sql.q ()`)
+}
+
+func TestPrepareClose(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createUsers, fillUsers))
+	ctx.AssignGlobal("st", eval(t, ctx, `db sql.prepare "SELECT id FROM users"`))
+
+	if n := mustI(t, eval(t, ctx, `#(st sql.q ())"id"`)); n != 3 {
+		t.Fatalf("st sql.q (): expected 3 rows, got %d", n)
+	}
+	if mustI(t, eval(t, ctx, `sql.close st`)) != 1 {
+		t.Fatal("sql.close st: expected 1")
+	}
+	evalPanic(t, ctx, `st sql.q ()`)
+	evalPanic(t, ctx, `db sql.prepare "SELECT * FROM missing"`)
+	evalPanic(t, ctx, `1 sql.prepare "SELECT 1"`)
+}
+
+func TestDuckDBPrepare(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	ctx.AssignGlobal("st", eval(t, ctx, `db sql.prepare "SELECT ?::INTEGER * 2 AS x"`))
+
+	v := eval(t, ctx, `st sql.q ..[n:1 2 3]`)
+	if got := dictLookup(t, ctx, mustDict(t, ctx, v), "x").Sprint(ctx, true); got != "2 4 6" {
+		t.Fatalf("duckdb vectorised sql.q: expected 2 4 6, got %s", got)
+	}
+}
@@ -0,0 +1,331 @@
+package sql
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// BV wrapper: sql.time
+// ---------------------------------------------------------------------------
+
+// Times is a temporal column returned by sql.q in Temporal mode (sql.time).
+// It keeps the values as Unix microseconds together with the SQL type name
+// and time zone of the column, so they can be bound back as proper
+// timestamps rather than plain integers.
+//
+// For TIME columns micros counts microseconds since midnight; for every other
+// type it counts microseconds since 1970-01-01 UTC.
+type Times struct {
+	micros  []int64
+	null    []bool // nil when no value is NULL
+	sqlType string // upper-cased database type name, e.g. "TIMESTAMPTZ"
+	zone    string // IANA zone name, "UTC", "Local" or a fixed offset "+02:00"
+}
+
+func (ts *Times) Append(_ *goal.Context, dst []byte, _ bool) []byte {
+	dst = append(dst, "sql.time["...)
+	dst = append(dst, ts.sqlType...)
+	if ts.zone != "" && ts.zone != "UTC" {
+		dst = append(dst, ' ')
+		dst = append(dst, ts.zone...)
+	}
+	dst = append(dst, "]("...)
+	for i := range ts.micros {
+		if i > 0 {
+			dst = append(dst, ' ')
+		}
+		t, ok := ts.timeAt(i)
+		if !ok {
+			dst = append(dst, "NULL"...)
+			continue
+		}
+		dst = t.AppendFormat(dst, ts.layout())
+	}
+	return append(dst, ')')
+}
+
+func (ts *Times) Matches(y goal.BV) bool {
+	yv, ok := y.(*Times)
+	if !ok || ts.sqlType != yv.sqlType || ts.zone != yv.zone || len(ts.micros) != len(yv.micros) {
+		return false
+	}
+	for i := range ts.micros {
+		if ts.isNull(i) != yv.isNull(i) || (!ts.isNull(i) && ts.micros[i] != yv.micros[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (ts *Times) Type() string { return "sql.time" }
+
+// isNull reports whether value i is SQL NULL.
+func (ts *Times) isNull(i int) bool { return ts.null != nil && ts.null[i] }
+
+// timeAt returns value i as a time.Time in the column's zone, or false if it
+// is NULL.
+func (ts *Times) timeAt(i int) (time.Time, bool) {
+	if ts.isNull(i) {
+		return time.Time{}, false
+	}
+	if isTimeOfDay(ts.sqlType) {
+		return time.Time{}.Add(time.Duration(ts.micros[i]) * time.Microsecond), true
+	}
+	loc, err := loadZone(ts.zone)
+	if err != nil {
+		loc = time.UTC
+	}
+	return time.UnixMicro(ts.micros[i]).In(loc), true
+}
+
+// layout returns the time layout used to print values of the column's type.
+func (ts *Times) layout() string {
+	switch {
+	case ts.sqlType == "DATE":
+		return time.DateOnly
+	case isTimeOfDay(ts.sqlType):
+		return "15:04:05.999999"
+	case strings.Contains(ts.sqlType, "TZ") || strings.Contains(ts.sqlType, "ZONE"):
+		return "2006-01-02T15:04:05.999999Z07:00"
+	default:
+		return "2006-01-02T15:04:05.999999"
+	}
+}
+
+// ---------------------------------------------------------------------------
+// Temporal column construction
+// ---------------------------------------------------------------------------
+
+// isTemporalType reports whether a database type name denotes a DATE, TIME
+// or TIMESTAMP column (including the DATETIME spelling used by SQLite).
+func isTemporalType(dbType string) bool {
+	dbType = strings.ToUpper(dbType)
+	return strings.HasPrefix(dbType, "DATE") || strings.HasPrefix(dbType, "TIME")
+}
+
+// isTimeOfDay reports whether a database type name denotes a TIME column.
+func isTimeOfDay(dbType string) bool {
+	return strings.HasPrefix(dbType, "TIME") && !strings.HasPrefix(dbType, "TIMESTAMP")
+}
+
+// isTemporalColumn reports whether a scanned column should be returned as
+// sql.time: every non-NULL value is a time.Time, or the column has no
+// non-NULL values and a temporal database type.
+func isTemporalColumn(raw []any, dbType string) bool {
+	seen := false
+	for _, v := range raw {
+		if v == nil {
+			continue
+		}
+		if _, ok := v.(time.Time); !ok {
+			return false
+		}
+		seen = true
+	}
+	return seen || isTemporalType(dbType)
+}
+
+// buildTimes converts a column of time.Time (or nil) driver values to a
+// sql.time value. The zone is taken from the first non-NULL value.
+func buildTimes(raw []any, dbType string) goal.V {
+	ts := &Times{micros: make([]int64, len(raw)), sqlType: strings.ToUpper(dbType), zone: "UTC"}
+	if ts.sqlType == "" {
+		ts.sqlType = "TIMESTAMP"
+	}
+	zoneSet := false
+	for i, v := range raw {
+		t, ok := v.(time.Time)
+		if !ok {
+			if ts.null == nil {
+				ts.null = make([]bool, len(raw))
+			}
+			ts.null[i] = true
+			continue
+		}
+		if !zoneSet {
+			ts.zone = zoneName(t)
+			zoneSet = true
+		}
+		if isTimeOfDay(ts.sqlType) {
+			h, m, s := t.Clock()
+			ts.micros[i] = int64((h*3600+m*60+s)*1e6 + t.Nanosecond()/1e3)
+		} else {
+			ts.micros[i] = t.UnixMicro()
+		}
+	}
+	return goal.NewV(ts)
+}
+
+// zoneName returns a name for t's location that loadZone understands.
+// Unnamed fixed zones (as parsed from "+02:00" offsets) become "+02:00".
+func zoneName(t time.Time) string {
+	if name := t.Location().String(); name != "" {
+		return name
+	}
+	_, off := t.Zone()
+	sign := byte('+')
+	if off < 0 {
+		sign = '-'
+		off = -off
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, off/3600, off/60%60)
+}
+
+// loadZone is the inverse of zoneName.
+func loadZone(name string) (*time.Location, error) {
+	switch name {
+	case "", "UTC":
+		return time.UTC, nil
+	case "Local":
+		return time.Local, nil
+	}
+	if name[0] == '+' || name[0] == '-' {
+		if hh, mm, ok := strings.Cut(name[1:], ":"); ok {
+			h, err1 := strconv.Atoi(hh)
+			m, err2 := strconv.Atoi(mm)
+			if err1 == nil && err2 == nil {
+				off := h*3600 + m*60
+				if name[0] == '-' {
+					off = -off
+				}
+				return time.FixedZone(name, off), nil
+			}
+		}
+	}
+	return time.LoadLocation(name)
+}
+
+// ---------------------------------------------------------------------------
+// sql.time  (monad: sql.time micros  or  sql.time[micros;"TYPE";"zone"])
+// ---------------------------------------------------------------------------
+
+// vfTime builds a sql.time value from Unix microseconds, so that Goal
+// integers can be bound as DATE/TIME/TIMESTAMP parameters. The SQL type
+// defaults to "TIMESTAMP" and the zone to "UTC"; 0n in a float array is NULL.
+//
+// Usage:
+//
+//	ts: sql.time 1704164645000000
+//	ts: sql.time[1704164645000000 1704251045000000;"TIMESTAMPTZ";"Europe/Paris"]
+//	db sql.exec["INSERT INTO events (at) VALUES (?)" ; ,sql.time 1704164645000000]
+func vfTime(_ *goal.Context, args []goal.V) goal.V {
+	const verb = "sql.time[micros;type;zone]"
+	ts := &Times{sqlType: "TIMESTAMP", zone: "UTC"}
+	var microsV goal.V
+	switch len(args) {
+	case 1:
+		microsV = args[0]
+	case 2:
+		// args[0] = type, args[1] = micros
+		microsV = args[1]
+	case 3:
+		// args[0] = zone, args[1] = type, args[2] = micros
+		microsV = args[2]
+		zs, ok := args[0].BV().(goal.S)
+		if !ok {
+			return goal.Panicf("%s : expected string zone, got %q", verb, args[0].Type())
+		}
+		ts.zone = string(zs)
+		if _, err := loadZone(ts.zone); err != nil {
+			return goal.Panicf("%s : %v", verb, err)
+		}
+	default:
+		return goal.Panicf("%s : expected 1 to 3 arguments, got %d", verb, len(args))
+	}
+	if len(args) >= 2 {
+		tv := args[len(args)-2]
+		s, ok := tv.BV().(goal.S)
+		if !ok {
+			return goal.Panicf("%s : expected string SQL type, got %q", verb, tv.Type())
+		}
+		if !isTemporalType(string(s)) {
+			return goal.Panicf("%s : expected DATE, TIME or TIMESTAMP type, got %q", verb, string(s))
+		}
+		ts.sqlType = strings.ToUpper(string(s))
+	}
+
+	switch {
+	case microsV.IsI():
+		ts.micros = []int64{microsV.I()}
+	case microsV.IsF():
+		if err := ts.setFloats([]float64{microsV.F()}); err != nil {
+			return goal.Panicf("%s : %v", verb, err)
+		}
+	default:
+		switch xv := microsV.BV().(type) {
+		case *goal.AI:
+			ts.micros = append([]int64(nil), xv.Slice...)
+		case *goal.AF:
+			if err := ts.setFloats(xv.Slice); err != nil {
+				return goal.Panicf("%s : %v", verb, err)
+			}
+		default:
+			return goal.Panicf("%s : expected integer microseconds, got %q", verb, microsV.Type())
+		}
+	}
+	return goal.NewV(ts)
+}
+
+// setFloats fills micros from integral floats, treating NaN as NULL.
+func (ts *Times) setFloats(fs []float64) error {
+	ts.micros = make([]int64, len(fs))
+	for i, f := range fs {
+		switch {
+		case math.IsNaN(f):
+			if ts.null == nil {
+				ts.null = make([]bool, len(fs))
+			}
+			ts.null[i] = true
+		case f != math.Trunc(f):
+			return fmt.Errorf("expected integer microseconds, got %v", f)
+		default:
+			ts.micros[i] = int64(f)
+		}
+	}
+	return nil
+}
+
+// ---------------------------------------------------------------------------
+// sql.meta  (monad: sql.meta ts)
+// ---------------------------------------------------------------------------
+
+// vfMeta returns the metadata of a sql.time value as a dict:
+//
+//	"type"    – SQL type name, e.g. "TIMESTAMPTZ"
+//	"zone"    – time zone name, e.g. "UTC" or "Europe/Paris"
+//	"micros"  – AI of microseconds (0 at NULL positions)
+//	"null"    – AI with 1 at each NULL position
+//
+// Usage:
+//
+//	t: sql.q[db;"SELECT at FROM events";();..[Temporal:1]]
+//	(sql.meta t"at")"type"
+func vfMeta(_ *goal.Context, args []goal.V) goal.V {
+	if len(args) != 1 {
+		return goal.Panicf("sql.meta x : expected 1 argument, got %d", len(args))
+	}
+	ts, ok := args[0].BV().(*Times)
+	if !ok {
+		return goal.Panicf("sql.meta x : expected sql.time, got %q", args[0].Type())
+	}
+	nulls := make([]int64, len(ts.micros))
+	for i := range nulls {
+		if ts.isNull(i) {
+			nulls[i] = 1
+		}
+	}
+	keys := goal.NewAS([]string{"type", "zone", "micros", "null"})
+	vals := goal.NewAV([]goal.V{
+		goal.NewS(ts.sqlType),
+		goal.NewS(ts.zone),
+		goal.NewAI(append([]int64(nil), ts.micros...)),
+		goal.NewAI(nulls),
+	})
+	return goal.NewD(keys, vals)
+}
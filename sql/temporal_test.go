@@ -0,0 +1,173 @@
+package sql_test
+
+import (
+	"testing"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// metaOf returns the sql.meta dict of column col of the global result t.
+func metaOf(t *testing.T, ctx *goal.Context, col string) *goal.D {
+	t.Helper()
+	return mustDict(t, ctx, eval(t, ctx, `sql.meta t"`+col+`"`))
+}
+
+// metaMicros returns the "micros" entry of a sql.meta dict.
+func metaMicros(t *testing.T, ctx *goal.Context, d *goal.D) []int64 {
+	t.Helper()
+	ms, ok := dictLookup(t, ctx, d, "micros").BV().(*goal.AI)
+	if !ok {
+		t.Fatalf("micros: expected AI, got %q", dictLookup(t, ctx, d, "micros").Type())
+	}
+	return ms.Slice
+}
+
+// metaString returns a string entry of a sql.meta dict.
+func metaString(t *testing.T, ctx *goal.Context, d *goal.D, key string) string {
+	t.Helper()
+	s, ok := dictLookup(t, ctx, d, key).BV().(goal.S)
+	if !ok {
+		t.Fatalf("%s: expected string, got %q", key, dictLookup(t, ctx, d, key).Type())
+	}
+	return string(s)
+}
+
+// ---------------------------------------------------------------------------
+// TestTemporalDuckDB
+// ---------------------------------------------------------------------------
+
+func TestTemporalDuckDB(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	const query = `"SELECT TIMESTAMPTZ '2024-01-02 03:04:05+00' AS tstz, TIMESTAMP '2024-01-02 03:04:05' AS ts, DATE '2024-01-02' AS d, TIME '03:04:05' AS tm"`
+
+	// Without the option, temporal columns stay Unix-microsecond integers.
+	ctx.AssignGlobal("t", eval(t, ctx, `sql.q[db;`+query+`]`))
+	if v := eval(t, ctx, `t"ts"`); v.Type() != "I" {
+		t.Fatalf("default mode: expected I column, got %q", v.Type())
+	}
+
+	ctx.AssignGlobal("t", eval(t, ctx, `sql.q[db;`+query+`;();..[Temporal:1]]`))
+	tests := []struct {
+		col, sqlType string
+		micros       int64
+	}{
+		{"tstz", "TIMESTAMPTZ", 1704164645000000},
+		{"ts", "TIMESTAMP", 1704164645000000},
+		{"d", "DATE", 1704153600000000},
+		{"tm", "TIME", 11045000000},
+	}
+	for _, tt := range tests {
+		if v := eval(t, ctx, `t"`+tt.col+`"`); v.Type() != "sql.time" {
+			t.Fatalf("%s: expected sql.time, got %q", tt.col, v.Type())
+		}
+		d := metaOf(t, ctx, tt.col)
+		if got := metaString(t, ctx, d, "type"); got != tt.sqlType {
+			t.Errorf("%s: expected type %q, got %q", tt.col, tt.sqlType, got)
+		}
+		if got := metaMicros(t, ctx, d); len(got) != 1 || got[0] != tt.micros {
+			t.Errorf("%s: expected micros [%d], got %v", tt.col, tt.micros, got)
+		}
+	}
+}
+
+func TestTemporalDuckDBRoundTrip(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE ev (id INTEGER, at TIMESTAMPTZ, d DATE)"]`)
+	eval(t, ctx, `sql.exec[db;"INSERT INTO ev VALUES (1, '2024-01-02 03:04:05+00', '2024-01-02'), (2, NULL, NULL)"]`)
+
+	// Values read in Temporal mode bind back as timestamps, both as
+	// parameters and through sql.insert.
+	ctx.AssignGlobal("t", eval(t, ctx, `sql.q[db;"SELECT * FROM ev ORDER BY id";();..[Temporal:1]]`))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE ev2 (id INTEGER, at TIMESTAMPTZ, d DATE)"]`)
+	eval(t, ctx, `sql.insert[db;"ev2";t]`)
+
+	v := eval(t, ctx, `sql.q[db;"SELECT count(*) AS n FROM ev JOIN ev2 USING (id) WHERE ev.at = ev2.at AND ev.d = ev2.d"]`)
+	if n := dictLookup(t, ctx, mustDict(t, ctx, v), "n"); n.Sprint(ctx, true) != ",1" {
+		t.Fatalf("round trip: expected 1 matching row, got %v", n.Sprint(ctx, true))
+	}
+	v = eval(t, ctx, `sql.q[db;"SELECT count(*) AS n FROM ev2 WHERE at IS NULL"]`)
+	if n := dictLookup(t, ctx, mustDict(t, ctx, v), "n"); n.Sprint(ctx, true) != ",1" {
+		t.Fatalf("round trip: expected 1 NULL row, got %v", n.Sprint(ctx, true))
+	}
+
+	v = eval(t, ctx, `sql.q[db;"SELECT id FROM ev WHERE at = ?";,sql.time[1704164645000000;"TIMESTAMPTZ";"UTC"]]`)
+	if ids := dictLookup(t, ctx, mustDict(t, ctx, v), "id"); ids.Sprint(ctx, true) != ",1" {
+		t.Fatalf("sql.time param: expected id 1, got %v", ids.Sprint(ctx, true))
+	}
+}
+
+// ---------------------------------------------------------------------------
+// TestTemporalSQLite
+// ---------------------------------------------------------------------------
+
+func TestTemporalSQLite(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE ev (id INTEGER, at DATETIME)"]`)
+	eval(t, ctx, `sql.exec[db;"INSERT INTO ev VALUES (?, ?)";(1;sql.time 1704164645000000)]`)
+	eval(t, ctx, `sql.exec[db;"INSERT INTO ev VALUES (2, NULL)"]`)
+
+	ctx.AssignGlobal("t", eval(t, ctx, `sql.q[db;"SELECT at FROM ev ORDER BY id";();..[Temporal:1]]`))
+	d := metaOf(t, ctx, "at")
+	if got := metaString(t, ctx, d, "type"); got != "DATETIME" {
+		t.Errorf("type: expected DATETIME, got %q", got)
+	}
+	if got := metaMicros(t, ctx, d); len(got) != 2 || got[0] != 1704164645000000 {
+		t.Errorf("micros: expected [1704164645000000 0], got %v", got)
+	}
+	if got := dictLookup(t, ctx, d, "null").Sprint(ctx, true); got != "0 1" {
+		t.Errorf("null: expected 0 1, got %s", got)
+	}
+}
+
+func TestTemporalEmptyResult(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openDuckDB(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE ev (at TIMESTAMP)"]`)
+
+	v := eval(t, ctx, `(sql.q[db;"SELECT at FROM ev";();..[Temporal:1]])"at"`)
+	if v.Type() != "sql.time" {
+		t.Fatalf("empty temporal column: expected sql.time, got %q", v.Type())
+	}
+}
+
+// ---------------------------------------------------------------------------
+// TestSQLTime
+// ---------------------------------------------------------------------------
+
+func TestSQLTime(t *testing.T) {
+	ctx := newCtx(t)
+
+	tests := []struct{ src, want string }{
+		{`sql.time 1704164645000000`, `sql.time[TIMESTAMP](2024-01-02T03:04:05)`},
+		{`sql.time[0 86400000000;"DATE"]`, `sql.time[DATE](1970-01-01 1970-01-02)`},
+		{`sql.time[1704164645000000 0n;"TIMESTAMPTZ";"+02:00"]`, `sql.time[TIMESTAMPTZ +02:00](2024-01-02T05:04:05+02:00 NULL)`},
+		{`sql.time[11045000000;"TIME"]`, `sql.time[TIME](03:04:05)`},
+	}
+	for _, tt := range tests {
+		if got := eval(t, ctx, tt.src).Sprint(ctx, true); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.src, tt.want, got)
+		}
+	}
+
+	if mustI(t, eval(t, ctx, `(sql.time 5)~sql.time 5`)) != 1 {
+		t.Error("sql.time match: expected equal values to match")
+	}
+
+	evalPanic(t, ctx, `sql.time "x"`)
+	evalPanic(t, ctx, `sql.time[1;"INTEGER"]`)
+	evalPanic(t, ctx, `sql.time[1;"TIMESTAMPTZ";"Not/AZone"]`)
+	evalPanic(t, ctx, `sql.time 1.5`)
+	evalPanic(t, ctx, `sql.meta 1`)
+}
+
+func TestQueryBadOptions(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+
+	evalPanic(t, ctx, `sql.q[db;"SELECT 1";();1]`)
+	evalPanic(t, ctx, `sql.q[db;"SELECT 1";();..[Unknown:1]]`)
+	evalPanic(t, ctx, `sql.q[db;"SELECT 1";();..[Temporal:"yes"]]`)
+}
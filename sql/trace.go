@@ -0,0 +1,243 @@
+package sql
+
+import (
+	"context"
+	stdsql "database/sql"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// latencyBuckets is the number of buckets of the sql.stats latency
+// histogram: under 1ms, 10ms, 100ms, 1s and 10s, and the rest; each bound
+// is latencyStep times the previous one.
+const (
+	latencyBuckets = 6
+	latencyStep    = 10
+)
+
+// traceArgMax is the length beyond which traced string parameters are
+// shortened.
+const traceArgMax = 64
+
+// ---------------------------------------------------------------------------
+// Statement tracing and statistics
+// ---------------------------------------------------------------------------
+
+// stmtEvent describes a statement run on a connection.
+type stmtEvent struct {
+	verb    string
+	query   string
+	args    []any
+	rows    int64 // rows returned or affected, or -1 if not known yet
+	elapsed time.Duration
+	cached  bool // result taken from the connection's cache
+	err     error
+}
+
+// connStats accumulates the statements run on a connection (sql.stats).
+type connStats struct {
+	statements int64
+	errors     int64
+	rows       int64
+	cacheHits  int64
+	elapsed    time.Duration
+	latency    [latencyBuckets]int64
+}
+
+// observe records a statement for sql.stats and, with the Trace option,
+// logs it.
+func (c *Conn) observe(ev stmtEvent) {
+	st := &c.stats
+	switch {
+	case ev.cached:
+		// The statement did not run.
+		st.cacheHits++
+	case ev.err != nil:
+		st.statements++
+		st.errors++
+	default:
+		st.statements++
+		st.rows += max(ev.rows, 0)
+	}
+	if !ev.cached {
+		st.elapsed += ev.elapsed
+		st.latency[latencyBucket(ev.elapsed)]++
+	}
+	if c.trace != nil {
+		_, _ = io.WriteString(c.trace, c.traceLine(ev))
+	}
+}
+
+// exec runs a statement that a verb builds itself, e.g. a SAVEPOINT or
+// sql.migrate's bookkeeping, on q, and records it as run by verb.
+func (c *Conn) exec(ctx context.Context, verb string, q querier, query string, args ...any) error {
+	start := time.Now()
+	res, err := q.ExecContext(ctx, query, args...)
+	var sum execSummary
+	if err == nil {
+		sum.add(res)
+	}
+	c.observe(stmtEvent{verb: verb, query: query, args: args, rows: sum.rowsAffected, elapsed: time.Since(start), err: err})
+	return err
+}
+
+// fetched counts n rows read from a cursor or sql.rows value after its
+// query was recorded.
+func (c *Conn) fetched(n int) {
+	c.stats.rows += int64(n)
+}
+
+// latencyBucket returns the index of the latency histogram bucket of d.
+func latencyBucket(d time.Duration) int {
+	i := 0
+	for bound := time.Millisecond; i < latencyBuckets-1 && d >= bound; bound *= latencyStep {
+		i++
+	}
+	return i
+}
+
+// traceLine formats a statement as a logfmt line, e.g.
+//
+//	sql.q dur=1.2ms rows=3 query="SELECT * FROM t WHERE id = ?" args=[?]
+//
+// Parameter values are redacted as ? unless the TraceParams option is set.
+func (c *Conn) traceLine(ev stmtEvent) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s dur=%s", ev.verb, ev.elapsed.Round(time.Microsecond))
+	if ev.rows >= 0 && ev.err == nil {
+		fmt.Fprintf(&sb, " rows=%d", ev.rows)
+	}
+	if ev.cached {
+		sb.WriteString(" cached=1")
+	}
+	fmt.Fprintf(&sb, " query=%q", ev.query)
+	if len(ev.args) > 0 {
+		sb.WriteString(" args=[")
+		for i, a := range ev.args {
+			if i > 0 {
+				sb.WriteByte(' ')
+			}
+			sb.WriteString(traceArg(a, c.traceParams))
+		}
+		sb.WriteByte(']')
+	}
+	if ev.err != nil {
+		fmt.Fprintf(&sb, " error=%q", ev.err.Error())
+	}
+	sb.WriteByte('\n')
+	return sb.String()
+}
+
+// traceArg formats a driver argument for the trace, as ? unless show.
+func traceArg(a any, show bool) string {
+	var name string
+	if na, ok := a.(stdsql.NamedArg); ok {
+		name, a = ":"+na.Name+"=", na.Value
+	}
+	if !show {
+		return name + "?"
+	}
+	switch x := a.(type) {
+	case nil:
+		return name + "NULL"
+	case string:
+		if len(x) > traceArgMax {
+			x = x[:traceArgMax] + "…"
+		}
+		return name + fmt.Sprintf("%q", x)
+	case []byte:
+		return name + fmt.Sprintf("<%d bytes>", len(x))
+	case time.Time:
+		return name + x.Format(time.RFC3339Nano)
+	}
+	return name + fmt.Sprint(a)
+}
+
+// resultRows returns the number of rows of a QueryResult dict (or of its
+// data with the NullMask option), or -1.
+func resultRows(t goal.V) int64 {
+	d, ok := t.BV().(*goal.D)
+	if !ok {
+		return -1
+	}
+	vals, ok := d.ValueArray().(*goal.AV)
+	if !ok || len(vals.Slice) == 0 {
+		return 0
+	}
+	if _, ok := vals.Slice[0].BV().(*goal.D); ok {
+		return resultRows(vals.Slice[0])
+	}
+	if n, ok := columnLen(vals.Slice[0]); ok {
+		return int64(n)
+	}
+	return -1
+}
+
+// ---------------------------------------------------------------------------
+// sql.stats  (monad: sql.stats db)
+// ---------------------------------------------------------------------------
+
+// vfStats returns a dict of the statistics of a connection: those of its
+// pool, from database/sql, and of the statements run through the sql verbs
+// since it was opened:
+//
+//	"openConnections"   – connections open, in use or idle (i)
+//	"inUse", "idle"     – connections in use and idle (i)
+//	"waitCount"         – times a call waited for a connection (i)
+//	"waitMilli"         – total time waited for connections (i)
+//	"maxIdleClosed", "maxIdleTimeClosed", "maxLifetimeClosed"
+//	                    – connections closed by the pool limits (i)
+//	"statements"        – statements run (i)
+//	"errors"            – statements that failed (i)
+//	"rows"              – rows returned by queries (including those fetched
+//	                      from cursors and sql.rows) and affected by
+//	                      statements (i)
+//	"cacheHits"         – sql.q and sql.cached results taken from the cache (i)
+//	"timeMilli"         – total time of the statements (f)
+//	"latency"           – histogram: ..[maxMilli:1 10 100 1000 10000 0w;count:…],
+//	                      count of statements that took less than maxMilli
+//	                      (and at least the previous bound)
+//
+// Usage:
+//
+//	s: sql.stats db
+//	s"latency"
+func vfStats(_ *goal.Context, args []goal.V) goal.V {
+	if len(args) != 1 {
+		return goal.Panicf("sql.stats conn : expected 1 argument, got %d", len(args))
+	}
+	c, ok := args[0].BV().(*Conn)
+	if !ok {
+		return goal.Panicf("sql.stats conn : expected sql.conn, got %q", args[0].Type())
+	}
+	pool := c.db.Stats()
+	st := c.stats
+
+	bounds := make([]float64, latencyBuckets)
+	for i, bound := 0, 1.0; i < latencyBuckets; i, bound = i+1, bound*latencyStep {
+		bounds[i] = bound
+	}
+	bounds[latencyBuckets-1] = math.Inf(1)
+	latency := goal.NewD(goal.NewAS([]string{"maxMilli", "count"}),
+		goal.NewAV([]goal.V{goal.NewAF(bounds), goal.NewAI(st.latency[:])}))
+
+	keys := []string{
+		"openConnections", "inUse", "idle", "waitCount", "waitMilli",
+		"maxIdleClosed", "maxIdleTimeClosed", "maxLifetimeClosed",
+		"statements", "errors", "rows", "cacheHits", "timeMilli", "latency",
+	}
+	vals := []goal.V{
+		goal.NewI(int64(pool.OpenConnections)), goal.NewI(int64(pool.InUse)), goal.NewI(int64(pool.Idle)),
+		goal.NewI(pool.WaitCount), goal.NewI(pool.WaitDuration.Milliseconds()),
+		goal.NewI(pool.MaxIdleClosed), goal.NewI(pool.MaxIdleTimeClosed), goal.NewI(pool.MaxLifetimeClosed),
+		goal.NewI(st.statements), goal.NewI(st.errors), goal.NewI(st.rows), goal.NewI(st.cacheHits),
+		goal.NewF(float64(st.elapsed) / float64(time.Millisecond)),
+		latency,
+	}
+	return goal.NewD(goal.NewAS(keys), goal.NewAV(vals))
+}
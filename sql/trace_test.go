@@ -0,0 +1,141 @@
+package sql_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// TestTrace
+// ---------------------------------------------------------------------------
+
+func TestTrace(t *testing.T) {
+	for _, tt := range []struct {
+		opts, args string
+	}{
+		{"..[Trace:1;MaxOpenConns:1]", `args=[? ?]`},
+		{"..[Trace:1;TraceParams:1;MaxOpenConns:1]", `args=[2 "secret"]`},
+	} {
+		ctx := newCtx(t)
+		var log strings.Builder
+		ctx.Log = &log
+		ctx.AssignGlobal("db", eval(t, ctx, `sql.open["sqlite://:memory:";`+tt.opts+`]`))
+		eval(t, ctx, `db sql.exec "CREATE TABLE t (id INTEGER, name TEXT)"`)
+		eval(t, ctx, `db sql.exec["INSERT INTO t VALUES (?, ?)";(2;"secret")]`)
+		eval(t, ctx, `db sql.q "SELECT * FROM t"`)
+		evalPanic(t, ctx, `db sql.q "SELECT nope FROM t"`)
+
+		lines := strings.Split(strings.TrimSpace(log.String()), "\n")
+		if len(lines) != 4 {
+			t.Fatalf("%s: expected 4 trace lines, got %q", tt.opts, lines)
+		}
+		for i, want := range [][]string{
+			{"sql.exec dur=", "rows=0", `query="CREATE TABLE t (id INTEGER, name TEXT)"`},
+			{"sql.exec dur=", "rows=1", `query="INSERT INTO t VALUES (?, ?)"`, tt.args},
+			{"sql.q dur=", "rows=1", `query="SELECT * FROM t"`},
+			{"sql.q dur=", `error="`},
+		} {
+			for _, w := range want {
+				if !strings.Contains(lines[i], w) {
+					t.Errorf("%s: line %d: expected %s, got %s", tt.opts, i, w, lines[i])
+				}
+			}
+		}
+		if tt.args == `args=[? ?]` && strings.Contains(log.String(), "secret") {
+			t.Errorf("%s: parameter values were not redacted: %s", tt.opts, log.String())
+		}
+	}
+}
+
+// The verbs that run statements other than the query they are given log
+// those too.
+func TestTraceVerbs(t *testing.T) {
+	ctx := newCtx(t)
+	var log strings.Builder
+	ctx.Log = &log
+	ctx.AssignGlobal("db", eval(t, ctx, `sql.open["sqlite://`+t.TempDir()+`/t.db";..[Trace:1]]`))
+	eval(t, ctx, `db sql.exec "CREATE TABLE t (id INTEGER)"`)
+	eval(t, ctx, `db sql.tx {[tx] tx sql.tx {[sp] sp sql.exec "INSERT INTO t VALUES (1)"}}`)
+	eval(t, ctx, `sql.rollback sql.begin db`)
+	eval(t, ctx, `sql.tables db`)
+	eval(t, ctx, `db sql.columns "t"`)
+	eval(t, ctx, `db sql.describe "SELECT id FROM t"`)
+	eval(t, ctx, `db sql.explain "SELECT id FROM t"`)
+	eval(t, ctx, `sql.register[db;"r";..[x:1 2]]`)
+	eval(t, ctx, `db sql.unregister "r"`)
+
+	for _, want := range []string{
+		`sql.tx dur=`, `query="BEGIN"`, `query="SAVEPOINT ari_sp1"`, `query="RELEASE ari_sp1"`, `query="COMMIT"`,
+		`sql.begin dur=`, `sql.rollback dur=`, `query="ROLLBACK"`,
+		`sql.tables dur=`, `sql.columns dur=`, `sql.describe dur=`,
+		`sql.explain dur=`, `query="SELECT id FROM t"`,
+		`sql.register dur=`, `rows=2 query="INSERT INTO \"r\""`, `sql.unregister dur=`,
+	} {
+		if !strings.Contains(log.String(), want) {
+			t.Errorf("expected a trace line with %s, got:\n%s", want, log.String())
+		}
+	}
+}
+
+// ---------------------------------------------------------------------------
+// TestStats
+// ---------------------------------------------------------------------------
+
+func TestStats(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx, createT, fillT)) // two statements
+	eval(t, ctx, `db sql.q "SELECT * FROM t"`)
+	eval(t, ctx, `sql.fetch[db sql.cursor "SELECT * FROM t";10]`)
+	eval(t, ctx, `db sql.cached "SELECT id FROM t WHERE id < 3"`)
+	eval(t, ctx, `db sql.cached "SELECT id FROM t WHERE id < 3"`)
+	evalPanic(t, ctx, `db sql.exec "INSERT INTO nope VALUES (1)"`)
+
+	s := mustDict(t, ctx, eval(t, ctx, `sql.stats db`))
+	for key, want := range map[string]int64{
+		"statements": 6, // the cache hit did not run
+		"errors":     1,
+		"rows":       5 + 5 + 5 + 2,
+		"cacheHits":  1,
+		"inUse":      1, // the connection of the in-memory database
+	} {
+		if got := mustI(t, dictLookup(t, ctx, s, key)); got != want {
+			t.Errorf("%s: expected %d, got %d", key, want, got)
+		}
+	}
+	if open := mustI(t, dictLookup(t, ctx, s, "openConnections")); open < 1 {
+		t.Errorf("openConnections: expected at least 1, got %d", open)
+	}
+
+	latency := mustDict(t, ctx, dictLookup(t, ctx, s, "latency"))
+	counts, ok := dictLookup(t, ctx, latency, "count").BV().(*goal.AI)
+	if !ok || len(counts.Slice) != 6 {
+		t.Fatalf("latency count: expected 6 buckets, got %s", dictLookup(t, ctx, latency, "count").Sprint(ctx, true))
+	}
+	var total int64
+	for _, n := range counts.Slice {
+		total += n
+	}
+	if total != 6 {
+		t.Errorf("latency count: expected 6 statements in all, got %d", total)
+	}
+	bounds, ok := dictLookup(t, ctx, latency, "maxMilli").BV().(*goal.AF)
+	if !ok || bounds.Slice[0] != 1 || !math.IsInf(bounds.Slice[5], 1) {
+		t.Errorf("latency maxMilli: expected 1 … 0w, got %s", dictLookup(t, ctx, latency, "maxMilli").Sprint(ctx, true))
+	}
+}
+
+func TestStatsErrors(t *testing.T) {
+	ctx := newCtx(t)
+
+	for _, tt := range []struct{ src, want string }{
+		{`sql.stats 1`, "expected sql.conn"},
+		{`sql.open["sqlite://:memory:";..[Trace:"yes"]]`, "Trace"},
+	} {
+		if msg := evalPanic(t, ctx, tt.src); !strings.Contains(msg, tt.want) {
+			t.Errorf("%s: expected error containing %q, got %s", tt.src, tt.want, msg)
+		}
+	}
+}
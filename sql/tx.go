@@ -0,0 +1,272 @@
+package sql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// ---------------------------------------------------------------------------
+// sql.tx  (dyad: conn sql.tx {[tx] ...}  or  sql.tx[conn;fn;opts])
+// ---------------------------------------------------------------------------
+
+// vfTx runs a lambda inside a database transaction.
+//
+// The lambda receives a sql.tx value that accepts sql.q and sql.exec
+// identically to a sql.conn. The transaction commits if the lambda returns a
+// non-error Goal value and rolls back if it returns a Goal error value.
+//
+// Given a sql.tx instead of a sql.conn, the lambda runs in a nested
+// transaction: a SAVEPOINT that is released on success and rolled back to on
+// error, leaving the enclosing transaction usable. DuckDB has no
+// savepoints, and its transactions cannot undo part of their writes, so
+// there a nested sql.tx is an error, raised before fn runs.
+//
+// An opts dict (see txOptions) sets the isolation level and read-only mode
+// of a top-level transaction:
+//
+//	Isolation  s  – e.g. "serializable", "read committed"
+//	ReadOnly   i  – 1 for a read-only transaction
+//
+// Usage:
+//
+//	r: db sql.tx {[tx]
+//	    tx sql.exec["INSERT INTO orders (item) VALUES (?)" ; ,"widget"]
+//	}
+//	r: sql.tx[db;{[tx] tx sql.q "SELECT * FROM orders"};..[ReadOnly:1]]
+func vfTx(ctx *goal.Context, args []goal.V) goal.V {
+	var opts txOptions
+	switch len(args) {
+	case 2:
+		// args[0] = fn (right), args[1] = conn (left)
+	case 3:
+		// args[0] = opts, args[1] = fn, args[2] = conn
+		var err error
+		opts, err = parseTxOptions("sql.tx[conn;fn;opts]", args[0])
+		if err != nil {
+			return goal.Panicf("%v", err)
+		}
+		args = args[1:]
+	default:
+		return goal.Panicf("conn sql.tx fn : expected 2 or 3 arguments, got %d", len(args))
+	}
+	fn := args[0]
+	if !fn.IsFunction() {
+		return goal.Panicf("conn sql.tx fn : expected function in right arg, got %q", fn.Type())
+	}
+
+	switch bv := args[1].BV().(type) {
+	case *Conn:
+		if bv.closed {
+			return goal.Panicf("conn sql.tx fn : connection is closed")
+		}
+		return runTx(ctx, bv, fn, opts)
+	case *GoalTx:
+		if bv.done {
+			return goal.Panicf("conn sql.tx fn : transaction is closed")
+		}
+		if opts != (txOptions{}) {
+			return goal.Panicf("conn sql.tx fn : options apply to top-level transactions only")
+		}
+		return runNestedTx(ctx, bv, fn)
+	}
+	return goal.Panicf("conn sql.tx fn : expected sql.conn or sql.tx in left arg, got %q", args[1].Type())
+}
+
+// runTx runs fn in a new transaction on c.
+func runTx(ctx *goal.Context, c *Conn, fn goal.V, opts txOptions) goal.V {
+	gtx, err := c.begin("sql.tx", opts)
+	if err != nil {
+		return goal.Panicf("conn sql.tx fn : begin: %v", err)
+	}
+	gtx.scoped = true
+	result := fn.ApplyAt(ctx, goal.NewV(gtx))
+
+	if result.IsPanic() {
+		_ = gtx.end("sql.tx", false)
+		return result
+	}
+	if err := gtx.end("sql.tx", true); err != nil {
+		return goal.Panicf("conn sql.tx fn : commit: %v", err)
+	}
+	return result
+}
+
+// begin starts a top-level transaction on c for verb and records it as
+// open.
+func (c *Conn) begin(verb string, opts txOptions) (*GoalTx, error) {
+	// The transaction outlives any single call, so only its statements are
+	// bounded by TimeoutMilli and interruptible.
+	if err := c.checkPool(); err != nil {
+		return nil, err
+	}
+	pinned := c.pin != nil && c.pinTx == nil
+	start := time.Now()
+	tx, err := c.target().BeginTx(context.Background(), &opts.TxOptions)
+	c.observe(stmtEvent{verb: verb, query: "BEGIN", elapsed: time.Since(start), err: err})
+	if err != nil {
+		return nil, err
+	}
+	gtx := &GoalTx{tx: tx, conn: c}
+	if c.txs == nil {
+		c.txs = make(map[*GoalTx]struct{})
+	}
+	c.txs[gtx] = struct{}{}
+	if pinned {
+		c.pinTx = gtx
+	}
+	return gtx, nil
+}
+
+// end commits or rolls back a top-level transaction for verb and marks it
+// done.
+func (t *GoalTx) end(verb string, commit bool) error {
+	t.done = true
+	delete(t.conn.txs, t)
+	if t.conn.pinTx == t {
+		t.conn.pinTx = nil
+	}
+	start := time.Now()
+	query, end := "ROLLBACK", t.tx.Rollback
+	if commit {
+		defer t.conn.invalidateCache()
+		query, end = "COMMIT", t.tx.Commit
+	}
+	err := end()
+	t.conn.observe(stmtEvent{verb: verb, query: query, elapsed: time.Since(start), err: err})
+	return err
+}
+
+// runNestedTx runs fn in a transaction nested in parent, using a savepoint.
+func runNestedTx(ctx *goal.Context, parent *GoalTx, fn goal.V) goal.V {
+	if !driverSchemes[parent.conn.driver].savepoints {
+		// Running fn in parent instead would leave no way to undo fn alone.
+		return goal.Panicf("conn sql.tx fn : nested transactions need savepoints, which the %s driver does not support", parent.conn.driver)
+	}
+	sp := &GoalTx{tx: parent.tx, conn: parent.conn, depth: parent.depth + 1, scoped: true}
+
+	name := fmt.Sprintf("ari_sp%d", sp.depth)
+	if err := sp.exec("SAVEPOINT " + name); err != nil {
+		return goal.Panicf("conn sql.tx fn : savepoint: %v", err)
+	}
+	result := fn.ApplyAt(ctx, goal.NewV(sp))
+	sp.done = true
+
+	if result.IsPanic() {
+		// ROLLBACK TO keeps the savepoint on the stack; RELEASE pops it.
+		if err := sp.exec("ROLLBACK TO " + name); err != nil {
+			return goal.Panicf("conn sql.tx fn : rollback to savepoint: %v", err)
+		}
+		_ = sp.exec("RELEASE " + name)
+		return result
+	}
+	if err := sp.exec("RELEASE " + name); err != nil {
+		return goal.Panicf("conn sql.tx fn : release savepoint: %v", err)
+	}
+	return result
+}
+
+// exec runs a savepoint statement of a nested sql.tx.
+func (t *GoalTx) exec(query string) error {
+	ctx, done := callContext(t.conn.timeout)
+	defer done()
+	return callErr(ctx, t.conn.exec(ctx, "sql.tx", t.tx, query))
+}
+
+// ---------------------------------------------------------------------------
+// sql.begin, sql.commit, sql.rollback  (explicit transaction control)
+// ---------------------------------------------------------------------------
+
+// vfBegin starts a transaction that stays open across REPL inputs until
+// sql.commit or sql.rollback ends it, and returns it as a sql.tx. An opts
+// dict sets its isolation level and read-only mode, as for sql.tx.
+//
+// Usage:
+//
+//	tx: sql.begin db
+//	tx sql.exec "UPDATE accounts SET balance = 0"
+//	tx sql.q "SELECT * FROM accounts"
+//	sql.rollback tx
+func vfBegin(_ *goal.Context, args []goal.V) goal.V {
+	var opts txOptions
+	switch len(args) {
+	case 1:
+	case 2:
+		// args[0] = opts, args[1] = conn
+		var err error
+		opts, err = parseTxOptions("sql.begin[conn;opts]", args[0])
+		if err != nil {
+			return goal.Panicf("%v", err)
+		}
+	default:
+		return goal.Panicf("sql.begin conn : expected 1 or 2 arguments, got %d", len(args))
+	}
+	connV := args[len(args)-1]
+	c, ok := connV.BV().(*Conn)
+	if !ok {
+		if _, isT := connV.BV().(*GoalTx); isT {
+			return goal.Panicf("sql.begin conn : expected sql.conn, got sql.tx (use sql.tx for nested transactions)")
+		}
+		return goal.Panicf("sql.begin conn : expected sql.conn, got %q", connV.Type())
+	}
+	if c.closed {
+		return goal.Panicf("sql.begin conn : connection is closed")
+	}
+	gtx, err := c.begin("sql.begin", opts)
+	if err != nil {
+		return goal.Panicf("sql.begin conn : %v", err)
+	}
+	return goal.NewV(gtx)
+}
+
+// vfCommit commits a transaction started by sql.begin and returns 1i.
+//
+// Usage:
+//
+//	sql.commit tx
+func vfCommit(_ *goal.Context, args []goal.V) goal.V {
+	t, err := explicitTx("sql.commit tx", args)
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	if err := t.end("sql.commit", true); err != nil {
+		return goal.Panicf("sql.commit tx : %v", err)
+	}
+	return goal.NewI(1)
+}
+
+// vfRollback rolls back a transaction started by sql.begin and returns 1i.
+//
+// Usage:
+//
+//	sql.rollback tx
+func vfRollback(_ *goal.Context, args []goal.V) goal.V {
+	t, err := explicitTx("sql.rollback tx", args)
+	if err != nil {
+		return goal.Panicf("%v", err)
+	}
+	if err := t.end("sql.rollback", false); err != nil {
+		return goal.Panicf("sql.rollback tx : %v", err)
+	}
+	return goal.NewI(1)
+}
+
+// explicitTx checks the argument of sql.commit and sql.rollback: an open
+// transaction started by sql.begin.
+func explicitTx(verb string, args []goal.V) (*GoalTx, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%s : expected 1 argument, got %d", verb, len(args))
+	}
+	t, ok := args[0].BV().(*GoalTx)
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%s : expected sql.tx, got %q", verb, args[0].Type())
+	case t.done:
+		return nil, fmt.Errorf("%s : transaction is closed", verb)
+	case t.scoped:
+		return nil, fmt.Errorf("%s : transaction is ended by its sql.tx lambda", verb)
+	}
+	return t, nil
+}
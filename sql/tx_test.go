@@ -0,0 +1,150 @@
+package sql_test
+
+import (
+	"strings"
+	"testing"
+
+	goal "codeberg.org/anaseto/goal"
+)
+
+// txRows returns column x of table t as a string, e.g. "1 3".
+func txRows(t *testing.T, ctx *goal.Context) string {
+	t.Helper()
+	v := eval(t, ctx, `sql.q[db;"SELECT x FROM t ORDER BY x"]`)
+	return dictLookup(t, ctx, mustDict(t, ctx, v), "x").Sprint(ctx, true)
+}
+
+// ---------------------------------------------------------------------------
+// TestNestedTx
+// ---------------------------------------------------------------------------
+
+func TestNestedTxSQLite(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (x INTEGER)"]`)
+
+	// Nested transactions commit with the outer one.
+	eval(t, ctx, `sql.tx[db;{[tx] tx sql.exec "INSERT INTO t VALUES (1)"
+		sql.tx[tx;{[sp] sp sql.exec "INSERT INTO t VALUES (2)"
+			sql.tx[sp;{[sp2] sp2 sql.exec "INSERT INTO t VALUES (3)"}]}]}]`)
+	if got := txRows(t, ctx); got != "1 2 3" {
+		t.Fatalf("nested commit: expected 1 2 3, got %s", got)
+	}
+
+	// A failed nested transaction rolls back to its savepoint only.
+	eval(t, ctx, `sql.tx[db;{[tx] tx sql.exec "INSERT INTO t VALUES (4)"
+		.[{[tx] sql.tx[tx;{[sp] sp sql.exec "INSERT INTO t VALUES (5)"; sp sql.exec "INSERT INTO nope VALUES (1)"}]};,tx;{0}]
+		tx sql.exec "INSERT INTO t VALUES (6)"}]`)
+	if got := txRows(t, ctx); got != "1 2 3 4 6" {
+		t.Fatalf("nested rollback: expected 1 2 3 4 6, got %s", got)
+	}
+
+	// Left uncaught, the failure rolls back the outer transaction too.
+	evalPanic(t, ctx, `sql.tx[db;{[tx] tx sql.exec "INSERT INTO t VALUES (7)"
+		sql.tx[tx;{[sp] sp sql.exec "INSERT INTO nope VALUES (1)"}]}]`)
+	if got := txRows(t, ctx); got != "1 2 3 4 6" {
+		t.Fatalf("outer rollback: expected 1 2 3 4 6, got %s", got)
+	}
+
+	// A nested sql.tx value is closed once its lambda returns.
+	ctx.AssignGlobal("keep", goal.NewI(0))
+	evalPanic(t, ctx, `sql.tx[db;{[tx] sql.tx[tx;{[sp] keep::sp; 1}]; keep sql.q "SELECT 1"}]`)
+}
+
+// ---------------------------------------------------------------------------
+// TestTxOptions
+// ---------------------------------------------------------------------------
+
+func TestTxOptions(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	eval(t, ctx, `sql.exec[db;"CREATE TABLE t (x INTEGER)"]`)
+
+	eval(t, ctx, `sql.tx[db;{[tx] tx sql.exec "INSERT INTO t VALUES (1)"};..[Isolation:"Default"]]`)
+	if got := txRows(t, ctx); got != ",1" {
+		t.Fatalf("tx with options: expected ,1, got %s", got)
+	}
+
+	evalPanic(t, ctx, `sql.tx[db;{[tx] 1};..[Isolation:"sometimes"]]`)
+	evalPanic(t, ctx, `sql.tx[db;{[tx] 1};..[ReadOnly:"yes"]]`)
+	evalPanic(t, ctx, `sql.tx[db;{[tx] 1};..[Durable:1]]`)
+	// Options only apply to top-level transactions.
+	evalPanic(t, ctx, `sql.tx[db;{[tx] sql.tx[tx;{[sp] 1};..[ReadOnly:1]]}]`)
+}
+
+// ---------------------------------------------------------------------------
+// TestBeginCommitRollback
+// ---------------------------------------------------------------------------
+
+func TestBeginCommitRollback(t *testing.T) {
+	for _, tt := range []struct {
+		open       func(*testing.T, *goal.Context, ...string) goal.V
+		savepoints bool
+	}{{openMem, true}, {openDuckDB, false}} {
+		ctx := newCtx(t)
+		ctx.AssignGlobal("db", tt.open(t, ctx))
+		eval(t, ctx, `sql.exec[db;"CREATE TABLE t (x INTEGER)"]`)
+
+		// Work spread over several evaluations, then committed.
+		ctx.AssignGlobal("tx", eval(t, ctx, `sql.begin db`))
+		eval(t, ctx, `tx sql.exec "INSERT INTO t VALUES (1)"`)
+		eval(t, ctx, `tx sql.exec "INSERT INTO t VALUES (2)"`)
+		if n := mustI(t, eval(t, ctx, `#(tx sql.q "SELECT x FROM t")"x"`)); n != 2 {
+			t.Fatalf("inside tx: expected 2 rows, got %d", n)
+		}
+		if mustI(t, eval(t, ctx, `sql.commit tx`)) != 1 {
+			t.Fatal("sql.commit: expected 1")
+		}
+		if got := txRows(t, ctx); got != "1 2" {
+			t.Fatalf("after commit: expected 1 2, got %s", got)
+		}
+		evalPanic(t, ctx, `sql.commit tx`)
+		evalPanic(t, ctx, `tx sql.q "SELECT 1"`)
+
+		// Rolled back.
+		ctx.AssignGlobal("tx", eval(t, ctx, `sql.begin db`))
+		eval(t, ctx, `tx sql.exec "DELETE FROM t"`)
+		eval(t, ctx, `sql.rollback tx`)
+		if got := txRows(t, ctx); got != "1 2" {
+			t.Fatalf("after rollback: expected 1 2, got %s", got)
+		}
+		evalPanic(t, ctx, `sql.rollback tx`)
+
+		// Nested sql.tx inside an explicit transaction.
+		ctx.AssignGlobal("tx", eval(t, ctx, `sql.begin db`))
+		if !tt.savepoints {
+			evalPanic(t, ctx, `sql.tx[tx;{[sp] sp sql.exec "INSERT INTO t VALUES (3)"}]`)
+			eval(t, ctx, `sql.rollback tx`)
+			continue
+		}
+		eval(t, ctx, `sql.tx[tx;{[sp] sp sql.exec "INSERT INTO t VALUES (3)"}]`)
+		eval(t, ctx, `sql.commit tx`)
+		if got := txRows(t, ctx); got != "1 2 3" {
+			t.Fatalf("nested in explicit tx: expected 1 2 3, got %s", got)
+		}
+	}
+}
+
+func TestBeginErrors(t *testing.T) {
+	ctx := newCtx(t)
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	evalPanic(t, ctx, `sql.begin 42`)
+	evalPanic(t, ctx, `sql.begin[db;..[ReadOnly:"yes"]]`)
+	evalPanic(t, ctx, `sql.commit db`)
+	// Lambda-scoped transactions end with their lambda.
+	evalPanic(t, ctx, `sql.tx[db;{[tx] sql.commit tx}]`)
+	evalPanic(t, ctx, `sql.tx[db;{[tx] sql.begin tx}]`)
+}
+
+func TestCloseWithOpenTx(t *testing.T) {
+	ctx := newCtx(t)
+	var log strings.Builder
+	ctx.Log = &log
+	ctx.AssignGlobal("db", openMem(t, ctx))
+	ctx.AssignGlobal("tx", eval(t, ctx, `sql.begin db`))
+	eval(t, ctx, `sql.close db`)
+	if !strings.Contains(log.String(), "1 open transaction") {
+		t.Errorf("sql.close: expected open transaction warning, got %q", log.String())
+	}
+	evalPanic(t, ctx, `sql.commit tx`)
+}